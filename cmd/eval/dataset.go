@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goVoice/internal/models"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dataset is a golden set of transcripts and the answers validating them
+// should give.
+type Dataset struct {
+	// Ruleset is the path to the ruleset json, relative to the dataset. Its
+	// validation prompt and AI settings are used, the built-in prompt when
+	// there is none.
+	Ruleset string `yaml:"ruleset"`
+	// Language of the transcripts unless a case says otherwise
+	Language string `yaml:"language"`
+	// Fake are the replies of the AI provider when running offline
+	Fake  []FakeRule `yaml:"fake"`
+	Cases []Case     `yaml:"cases"`
+}
+
+// FakeRule is a reply of the offline AI provider to the requests matching the
+// pattern. The request is the json of the question, purpose and transcript.
+type FakeRule struct {
+	Pattern  string `yaml:"pattern"`
+	Response string `yaml:"response"`
+	Error    string `yaml:"error"`
+}
+
+// Case is a single transcript and what validating it should give. Anything
+// left empty isn't checked.
+type Case struct {
+	// ID tells the case apart in the baseline, <purpose>-<n> by default
+	ID string `yaml:"id"`
+	// Question defaults to the text of the step of the ruleset with the purpose
+	Question   string `yaml:"question"`
+	Purpose    string `yaml:"purpose"`
+	Transcript string `yaml:"transcript"`
+	Language   string `yaml:"language"`
+	// Answers are the answers given before, for prompts that use them
+	Answers map[string]string `yaml:"answers"`
+	// Expected is the normalized answer, compared case insensitive and
+	// ignoring whitespace and the punctuation at the end
+	Expected string `yaml:"expected"`
+	Complete *bool  `yaml:"complete"`
+}
+
+func loadDataset(path string) (*Dataset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dataset Dataset
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&dataset); err != nil {
+		return nil, fmt.Errorf("error parsing dataset %s: %w", path, err)
+	}
+	if len(dataset.Cases) == 0 {
+		return nil, fmt.Errorf("dataset %s has no cases", path)
+	}
+	for i, rule := range dataset.Fake {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("fake rule %d of dataset %s: %w", i+1, path, err)
+		}
+	}
+	if dataset.Ruleset != "" && !filepath.IsAbs(dataset.Ruleset) {
+		dataset.Ruleset = filepath.Join(filepath.Dir(path), dataset.Ruleset)
+	}
+
+	counts := make(map[string]int)
+	seen := make(map[string]bool)
+	for i := range dataset.Cases {
+		c := &dataset.Cases[i]
+		if c.Purpose == "" || c.Transcript == "" {
+			return nil, fmt.Errorf("case %d of dataset %s needs a purpose and a transcript", i+1, path)
+		}
+		counts[c.Purpose]++
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("%s-%d", c.Purpose, counts[c.Purpose])
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("dataset %s has case %s twice", path, c.ID)
+		}
+		seen[c.ID] = true
+		if c.Language == "" {
+			c.Language = dataset.Language
+		}
+	}
+	return &dataset, nil
+}
+
+func loadRuleset(path string) (*models.ConversationRuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ruleset models.ConversationRuleSet
+	if err := json.Unmarshal(data, &ruleset); err != nil {
+		return nil, fmt.Errorf("error parsing ruleset %s: %w", path, err)
+	}
+	if ruleset.ID == "" {
+		ruleset.ID = "evaluation"
+	}
+	return &ruleset, nil
+}
+
+// question is the question of the case, or that of the step of the ruleset
+// with its purpose.
+func question(rules *models.ConversationRuleSet, c *Case) string {
+	if c.Question != "" {
+		return c.Question
+	}
+	for _, step := range rules.Steps {
+		if step.Purpose == c.Purpose {
+			return step.Text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+// Command eval runs a golden dataset of transcripts through the validation of
+// answers, so changes to prompts and models can be compared before they go
+// live:
+//
+//	go run ./cmd/eval -dataset evals/afval.yaml -baseline evals/afval.json
+//
+// It prints the cases that failed and the accuracy by purpose, and exits with
+// 0 when nothing regressed compared with the baseline, 1 when something did
+// and 2 when the evaluation couldn't run. Use -save to store the outcome as
+// the new baseline. By default the AI provider is offline and replies with
+// the fake rules of the dataset; use -ai live to run against the AI provider
+// from the environment, such as a local model with AI_PROVIDER=compatible.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"goVoice/internal/app/conversation"
+	"goVoice/internal/config"
+	"goVoice/internal/models"
+	"goVoice/internal/prompts"
+	"goVoice/pkg/ai"
+	fakeai "goVoice/pkg/ai/fake"
+	"goVoice/pkg/db/memory"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	exitPass   = 0
+	exitFail   = 1
+	exitBroken = 2
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	datasetPath := flag.String("dataset", "", "YAML dataset of transcripts and expected answers")
+	rulesetPath := flag.String("ruleset", "", "ruleset json, overrides the ruleset of the dataset")
+	aiMode := flag.String("ai", "offline", "offline or live")
+	provider := flag.String("provider", "", "named AI provider to use, overrides the ruleset")
+	model := flag.String("model", "", "model to use, overrides the ruleset")
+	baselinePath := flag.String("baseline", "", "baseline json to compare with")
+	savePath := flag.String("save", "", "store the outcome as baseline json")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long to wait for the AI provider per case")
+	verbose := flag.Bool("v", false, "show the logs of the controller")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	if *datasetPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: eval -dataset <dataset.yaml> [-ruleset <ruleset.json>] [-ai offline|live] [-baseline <baseline.json>] [-save <baseline.json>]")
+		return exitBroken
+	}
+
+	dataset, err := loadDataset(*datasetPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitBroken
+	}
+	if *rulesetPath != "" {
+		dataset.Ruleset = *rulesetPath
+	}
+	rules := &models.ConversationRuleSet{ID: "evaluation"}
+	if dataset.Ruleset != "" {
+		if rules, err = loadRuleset(dataset.Ruleset); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitBroken
+		}
+	}
+	if *provider != "" || *model != "" {
+		rules.AI = &models.AISettings{Provider: *provider, Model: *model}
+	}
+
+	var aiProvider ai.AIProvider
+	switch *aiMode {
+	case "offline":
+		aiProvider = offlineProvider(dataset.Fake)
+	case "live":
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading config for the live AI provider: %v\n", err)
+			return exitBroken
+		}
+		aiProvider, err = ai.InitiateAIProvider(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating the live AI provider: %v\n", err)
+			return exitBroken
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -ai %q, use offline or live\n", *aiMode)
+		return exitBroken
+	}
+
+	var baseline *Baseline
+	if *baselinePath != "" {
+		if baseline, err = loadBaseline(*baselinePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitBroken
+		}
+	}
+
+	prompt := rules.ValidationPrompt
+	if prompt == nil {
+		prompt = prompts.Default
+	}
+	fmt.Printf("--- %d cases with prompt %s (%s)\n", len(dataset.Cases), prompts.Version(prompt), *aiMode)
+
+	db := memory.NewClient()
+	ctrl := &conversation.Controller{DB: db, AI: aiProvider}
+	results := make([]*Result, 0, len(dataset.Cases))
+	for i := range dataset.Cases {
+		results = append(results, evaluate(ctrl, db, rules, &dataset.Cases[i], *timeout))
+	}
+	report := newReport(results)
+	report.Print(os.Stdout)
+
+	if *savePath != "" {
+		if err := saveBaseline(*savePath, report.Baseline()); err != nil {
+			fmt.Fprintf(os.Stderr, "error saving the baseline: %v\n", err)
+			return exitBroken
+		}
+	}
+	if baseline == nil {
+		fmt.Println("\n--- DONE")
+		return exitPass
+	}
+	if regressions := report.Regressions(baseline); len(regressions) > 0 {
+		fmt.Printf("\n--- REGRESSED compared with %s\n", *baselinePath)
+		for _, regression := range regressions {
+			fmt.Printf("  %s\n", regression)
+		}
+		return exitFail
+	}
+	fmt.Printf("\n--- PASS compared with %s\n", *baselinePath)
+	return exitPass
+}
+
+// evaluate validates the transcript of the case like it is during a call,
+// on a conversation of its own with the answers of the case.
+func evaluate(ctrl *conversation.Controller, db *memory.MemoryClient, rules *models.ConversationRuleSet, c *Case, timeout time.Duration) *Result {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result := &Result{Case: c}
+	if err := db.AddConversation(ctx, rules.ID, &models.Conversation{ID: c.ID, Responses: c.Answers}); err != nil {
+		result.Err = err
+		return result
+	}
+	state := &models.ClientState{RulesetID: rules.ID, Purpose: c.Purpose, Language: c.Language}
+	step := &models.ConversationStep{Text: question(rules, c), Purpose: c.Purpose}
+	validated, err := ctrl.ValidateAnswer(ctx, c.ID, state, rules, c.Transcript, step)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Answer = validated.Answer
+	result.Complete = validated.Complete
+	return result
+}
+
+// offlineProvider replies following the fake rules of the dataset.
+func offlineProvider(rules []FakeRule) *fakeai.Provider {
+	fakeRules := make([]fakeai.Rule, 0, len(rules))
+	for _, rule := range rules {
+		fakeRule := fakeai.Rule{Pattern: rule.Pattern, Response: rule.Response}
+		if rule.Error != "" {
+			fakeRule.Err = errors.New(rule.Error)
+		}
+		fakeRules = append(fakeRules, fakeRule)
+	}
+	return fakeai.New(fakeRules...)
+}
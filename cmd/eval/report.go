@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Result is what validating a case gave.
+type Result struct {
+	Case     *Case
+	Answer   string
+	Complete *bool
+	Err      error
+}
+
+// answerOK tells whether the answer is the expected one, when one is expected.
+func (r *Result) answerOK() bool {
+	return r.Err == nil && (r.Case.Expected == "" || normalize(r.Answer) == normalize(r.Case.Expected))
+}
+
+// completeOK tells whether the completeness is the expected one, when it is
+// checked. No completeness counts as incomplete.
+func (r *Result) completeOK() bool {
+	if r.Err != nil {
+		return false
+	}
+	if r.Case.Complete == nil {
+		return true
+	}
+	return *r.Case.Complete == (r.Complete != nil && *r.Complete)
+}
+
+func (r *Result) passed() bool {
+	return r.answerOK() && r.completeOK()
+}
+
+// normalize makes answers comparable: lower case, single spaces and without
+// the punctuation at the end.
+func normalize(answer string) string {
+	answer = strings.ToLower(strings.Join(strings.Fields(answer), " "))
+	return strings.TrimRight(answer, ".,!?;: ")
+}
+
+// Score is how the cases of a purpose did.
+type Score struct {
+	Cases    int `json:"cases"`
+	Answers  int `json:"answers"`
+	Complete int `json:"complete"`
+	Errors   int `json:"errors"`
+	Passed   int `json:"passed"`
+}
+
+func (s *Score) add(result *Result) {
+	s.Cases++
+	if result.Err != nil {
+		s.Errors++
+	}
+	if result.answerOK() {
+		s.Answers++
+	}
+	if result.completeOK() {
+		s.Complete++
+	}
+	if result.passed() {
+		s.Passed++
+	}
+}
+
+// Accuracy is the share of cases that passed.
+func (s *Score) Accuracy() float64 {
+	if s.Cases == 0 {
+		return 0
+	}
+	return float64(s.Passed) / float64(s.Cases)
+}
+
+// Baseline is a stored evaluation that later ones are compared with.
+type Baseline struct {
+	Purposes map[string]float64 `json:"purposes"`
+	// Passed has the cases that passed by ID
+	Passed map[string]bool `json:"passed"`
+}
+
+// Report is the outcome of evaluating a dataset.
+type Report struct {
+	Results  []*Result
+	Purposes map[string]*Score
+	Total    Score
+}
+
+func newReport(results []*Result) *Report {
+	report := &Report{Results: results, Purposes: make(map[string]*Score)}
+	for _, result := range results {
+		score, ok := report.Purposes[result.Case.Purpose]
+		if !ok {
+			score = &Score{}
+			report.Purposes[result.Case.Purpose] = score
+		}
+		score.add(result)
+		report.Total.add(result)
+	}
+	return report
+}
+
+func (r *Report) purposes() []string {
+	purposes := make([]string, 0, len(r.Purposes))
+	for purpose := range r.Purposes {
+		purposes = append(purposes, purpose)
+	}
+	sort.Strings(purposes)
+	return purposes
+}
+
+// Baseline returns the report as a baseline to compare later ones with.
+func (r *Report) Baseline() *Baseline {
+	baseline := &Baseline{Purposes: make(map[string]float64), Passed: make(map[string]bool)}
+	for purpose, score := range r.Purposes {
+		baseline.Purposes[purpose] = score.Accuracy()
+	}
+	for _, result := range r.Results {
+		baseline.Passed[result.Case.ID] = result.passed()
+	}
+	return baseline
+}
+
+// Regressions are the purposes whose accuracy dropped and the cases that
+// passed in the baseline but don't anymore.
+func (r *Report) Regressions(baseline *Baseline) []string {
+	var regressions []string
+	for _, purpose := range r.purposes() {
+		before, ok := baseline.Purposes[purpose]
+		if now := r.Purposes[purpose].Accuracy(); ok && now < before {
+			regressions = append(regressions, fmt.Sprintf("%s: accuracy %s, was %s", purpose, percentage(now), percentage(before)))
+		}
+	}
+	for _, result := range r.Results {
+		if baseline.Passed[result.Case.ID] && !result.passed() {
+			regressions = append(regressions, fmt.Sprintf("%s: passed in the baseline, fails now", result.Case.ID))
+		}
+	}
+	return regressions
+}
+
+// Print writes the cases that failed and the scores by purpose.
+func (r *Report) Print(out io.Writer) {
+	for _, result := range r.Results {
+		switch {
+		case result.Err != nil:
+			fmt.Fprintf(out, "ERROR %s: %v\n", result.Case.ID, result.Err)
+		case !result.passed():
+			fmt.Fprintf(out, "FAIL  %s: %q\n", result.Case.ID, result.Case.Transcript)
+			if !result.answerOK() {
+				fmt.Fprintf(out, "        answer %q, expected %q\n", result.Answer, result.Case.Expected)
+			}
+			if !result.completeOK() {
+				fmt.Fprintf(out, "        complete %s, expected %t\n", completeness(result.Complete), *result.Case.Complete)
+			}
+		}
+	}
+
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "purpose\tcases\tanswers\tcomplete\terrors\taccuracy")
+	row := func(name string, score *Score) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", name, score.Cases, score.Answers, score.Complete, score.Errors, percentage(score.Accuracy()))
+	}
+	for _, purpose := range r.purposes() {
+		row(purpose, r.Purposes[purpose])
+	}
+	row("total", &r.Total)
+	w.Flush()
+}
+
+func completeness(complete *bool) string {
+	if complete == nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%t", *complete)
+}
+
+func percentage(accuracy float64) string {
+	return fmt.Sprintf("%.0f%%", accuracy*100)
+}
+
+func loadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("error parsing baseline %s: %w", path, err)
+	}
+	return &baseline, nil
+}
+
+func saveBaseline(path string, baseline *Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegressions(t *testing.T) {
+	yes, no := true, false
+	cases := []*Case{
+		{ID: "adres-1", Purpose: "adres", Expected: "Kerkstraat 1, Leeuwarden", Complete: &yes},
+		{ID: "adres-2", Purpose: "adres", Expected: "Bij de kerk", Complete: &no},
+		{ID: "naam-1", Purpose: "naam", Expected: "Jan de Vries"},
+	}
+	report := newReport([]*Result{
+		{Case: cases[0], Answer: "kerkstraat 1,  Leeuwarden.", Complete: &yes},
+		{Case: cases[1], Answer: "Bij de kerk", Complete: &yes},
+		{Case: cases[2], Err: errors.New("down")},
+	})
+
+	if score := report.Purposes["adres"]; score.Passed != 1 || score.Answers != 2 || score.Complete != 1 {
+		t.Errorf("Unexpected score of adres: %+v", score)
+	}
+	if report.Total.Errors != 1 || report.Total.Passed != 1 {
+		t.Errorf("Unexpected total: %+v", report.Total)
+	}
+
+	baseline := &Baseline{
+		Purposes: map[string]float64{"adres": 1, "naam": 0},
+		Passed:   map[string]bool{"adres-1": true, "adres-2": true},
+	}
+	expected := []string{
+		"adres: accuracy 50%, was 100%",
+		"adres-2: passed in the baseline, fails now",
+	}
+	if regressions := report.Regressions(baseline); !reflect.DeepEqual(regressions, expected) {
+		t.Errorf("Expected regressions %q, got %q", expected, regressions)
+	}
+	if regressions := report.Regressions(report.Baseline()); len(regressions) != 0 {
+		t.Errorf("Expected no regressions compared with itself, got %q", regressions)
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"goVoice/internal/api"
+	"goVoice/internal/billing"
 	"goVoice/internal/config"
 	"goVoice/pkg/ai"
 	"goVoice/pkg/db"
 	"goVoice/pkg/storage"
+	"goVoice/pkg/stt"
 	"log"
 	"net/http"
 	"os"
@@ -32,15 +34,23 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create ai handler: %v", err)
 	}
+	transcriber, err := stt.InitiateTranscriber(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create transcriber: %v", err)
+	}
+	prices, err := billing.LoadPrices(cfg.PricesFile)
+	if err != nil {
+		log.Fatalf("Failed to load prices: %v", err)
+	}
 
 	router := gin.Default()
 	router.GET("/favicon.ico", func(c *gin.Context) {
 		c.Status(http.StatusNoContent)
 	})
-	// Create the API for the UI
-	api.NewWebClientAPI(cfg, storageHandler, dbHandler, router)
 	// Create the API for the call manager
-	api.NewVoiceAPI(cfg, storageHandler, dbHandler, aiHandler, router)
+	voiceAPI := api.NewVoiceAPI(cfg, storageHandler, dbHandler, aiHandler, transcriber, router)
+	// Create the API for the UI
+	api.NewWebClientAPI(cfg, storageHandler, dbHandler, prices, voiceAPI.Conversations, router)
 	if err := router.Run(cfg.ApiPort); err != nil {
 		log.Fatalf("Failed to start web client server: %v", err)
 	}
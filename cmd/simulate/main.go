@@ -0,0 +1,436 @@
+// Command simulate runs a ruleset against a script of caller utterances
+// without telephony, Firestore or email, so ruleset authors can test their
+// flows in CI:
+//
+//	go run ./cmd/simulate -script flows/afval.yaml
+//
+// It prints the dialogue, the answers and the report, and exits with 0 when
+// every expectation of the script holds, 1 when one doesn't and 2 when the
+// simulation couldn't run. By default the AI provider is offline and fails
+// every request, so the controller takes its fallbacks; use -ai live to run
+// against the AI provider from the environment.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"goVoice/internal/app/conversation"
+	"goVoice/internal/config"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai"
+	"goVoice/pkg/ai/chat"
+	"goVoice/pkg/audio/fake"
+	"goVoice/pkg/db/memory"
+	"html"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	exitPass   = 0
+	exitFail   = 1
+	exitBroken = 2
+)
+
+const callID = "simulated-call"
+
+// offlineAI fails every request, the controller falls back as it would when
+// the AI provider is down. Only the language the caller speaks is detected,
+// from the languages in the script.
+type offlineAI struct {
+	// languages maps what the caller says to the language they say it in
+	languages map[string]string
+}
+
+func (o offlineAI) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	if len(request.Messages) > 1 && strings.Contains(request.Messages[0].Content, "detect the language") {
+		if language, ok := o.languages[request.Messages[len(request.Messages)-1].Content]; ok {
+			return &chat.Response{Content: fmt.Sprintf(`{"language": %q}`, language)}, nil
+		}
+	}
+	return nil, errors.New("the AI provider is offline in the simulator")
+}
+
+// mailbox keeps the report instead of emailing it.
+type mailbox struct {
+	to      []string
+	subject string
+	body    string
+	sent    bool
+}
+
+func (m *mailbox) SendEmailWithAttachment(ctx context.Context, to []string, subject string, body string, attachments [][]byte, attachmentNames []string) error {
+	m.to = to
+	m.subject = subject
+	m.body = body
+	m.sent = true
+	return nil
+}
+
+type simulation struct {
+	ctrl    *conversation.Controller
+	calls   *fake.CallProvider
+	db      *memory.MemoryClient
+	mail    *mailbox
+	ruleset *models.ConversationRuleSet
+	out     io.Writer
+	wait    time.Duration
+
+	state *models.ClientState
+	ended bool
+	// snapshot is the conversation as it was when the call ended
+	snapshot *models.Conversation
+	answered []string
+	failures []string
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	scriptPath := flag.String("script", "", "YAML script of what the caller says")
+	rulesetPath := flag.String("ruleset", "", "ruleset json, overrides the ruleset of the script")
+	aiMode := flag.String("ai", "offline", "offline or live")
+	wait := flag.Duration("wait", 10*time.Second, "how long to wait for the agent to reply")
+	verbose := flag.Bool("v", false, "show the logs of the controller")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	if *scriptPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: simulate -script <script.yaml> [-ruleset <ruleset.json>] [-ai offline|live]")
+		return exitBroken
+	}
+
+	script, err := loadScript(*scriptPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitBroken
+	}
+	if *rulesetPath != "" {
+		script.Ruleset = *rulesetPath
+	}
+	if script.Ruleset == "" {
+		fmt.Fprintln(os.Stderr, "no ruleset given in the script or with -ruleset")
+		return exitBroken
+	}
+	ruleset, err := loadRuleset(script.Ruleset)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitBroken
+	}
+
+	languages := make(map[string]string)
+	for _, turn := range script.Turns {
+		if language := turn.language(script); language != "" {
+			languages[turn.Say] = language
+		}
+	}
+	var aiProvider ai.AIProvider = offlineAI{languages: languages}
+	switch *aiMode {
+	case "offline":
+	case "live":
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading config for the live AI provider: %v\n", err)
+			return exitBroken
+		}
+		aiProvider, err = ai.InitiateAIProvider(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating the live AI provider: %v\n", err)
+			return exitBroken
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -ai %q, use offline or live\n", *aiMode)
+		return exitBroken
+	}
+
+	db := memory.NewClient()
+	if err := db.AddRuleset(context.Background(), ruleset); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitBroken
+	}
+	calls := fake.NewCallProvider()
+	mail := &mailbox{}
+	sim := &simulation{
+		ctrl: &conversation.Controller{
+			CallProvider: calls,
+			DB:           db,
+			AI:           aiProvider,
+			Email:        mail,
+		},
+		calls:   calls,
+		db:      db,
+		mail:    mail,
+		ruleset: ruleset,
+		out:     os.Stdout,
+		wait:    *wait,
+	}
+	if !script.At.IsZero() {
+		sim.ctrl.Clock = func() time.Time { return script.At }
+	}
+
+	sim.run(script)
+	sim.expect(script.Expect)
+
+	if len(sim.failures) > 0 {
+		fmt.Fprintln(sim.out, "\n--- FAIL")
+		for _, failure := range sim.failures {
+			fmt.Fprintf(sim.out, "  %s\n", failure)
+		}
+		return exitFail
+	}
+	fmt.Fprintln(sim.out, "\n--- PASS")
+	return exitPass
+}
+
+func (s *simulation) failf(format string, args ...interface{}) {
+	s.failures = append(s.failures, fmt.Sprintf(format, args...))
+}
+
+// next waits for the agent to say something, handling everything the call
+// provider would do in the meantime. It returns nil when the agent stayed
+// silent or the call ended.
+func (s *simulation) next() *fake.Event {
+	timeout := time.After(s.wait)
+	var sentences []string
+	for {
+		select {
+		case event := <-s.calls.Events:
+			switch event.Kind {
+			case fake.EventSpeak, fake.EventInterrupt, fake.EventPlay:
+				fmt.Fprintf(s.out, "Agent:  %s\n", event.Text)
+				s.state = event.State
+				// Speaking is instant here, a streamed step goes on with its
+				// next sentence right away
+				if event.Kind == fake.EventSpeak && s.ctrl.SpeechEnded(callID, event.State) {
+					sentences = append(sentences, event.Text)
+					continue
+				}
+				if len(sentences) > 0 {
+					event.Text = strings.Join(append(sentences, event.Text), " ")
+				}
+				return &event
+			case fake.EventLanguage:
+				fmt.Fprintf(s.out, "        (transcribing %s from now on)\n", event.State.Language)
+			case fake.EventTransfer:
+				fmt.Fprintf(s.out, "        (call transferred to %s)\n", event.To)
+				s.ended = true
+				return nil
+			case fake.EventHangup:
+				fmt.Fprintln(s.out, "        (agent hung up)")
+				s.ended = true
+				return nil
+			}
+		case <-timeout:
+			return nil
+		}
+	}
+}
+
+// finishSpeaking does what the call provider does once the agent is done
+// talking: run the pending action, or hang up after the final step.
+func (s *simulation) finishSpeaking() {
+	if s.ended || s.state == nil {
+		return
+	}
+	if s.state.PendingAction != "" {
+		go s.ctrl.RunPendingAction(context.Background(), callID, s.state)
+		s.next()
+		return
+	}
+	if s.state.CurrentStep == s.state.TotalSteps-1 {
+		s.calls.EndCall(callID)
+		s.next()
+	}
+}
+
+func (s *simulation) run(script *Script) {
+	ctx := context.Background()
+	fmt.Fprintf(s.out, "--- %s\n", s.ruleset.Title)
+
+	go s.ctrl.StartConversation(s.ctrl.OpeningState(s.ruleset.ID), callID, models.CallInfo{
+		From:      script.Caller,
+		To:        "simulated",
+		Direction: models.DirectionInbound,
+		Withheld:  script.Caller == "",
+		StartedAt: time.Now(),
+	})
+	if s.next() == nil && !s.ended {
+		s.failf("the agent didn't open the conversation")
+		s.ended = true
+	}
+
+	for i, turn := range script.Turns {
+		s.finishSpeaking()
+		if s.ended {
+			s.failf("turn %d: the call ended before the caller could say %q", i+1, turn.Say)
+			break
+		}
+		if turn.Hangup {
+			fmt.Fprintln(s.out, "        (caller hung up)")
+			s.ended = true
+			break
+		}
+
+		fmt.Fprintf(s.out, "Caller: %s\n", turn.Say)
+		confidence := turn.Confidence
+		if confidence == 0 {
+			confidence = 1
+		}
+		asked := *s.state
+		go s.ctrl.ProcessTranscription(ctx, callID, &models.TranscriptFragment{
+			Transcript: turn.Say,
+			Confidence: confidence,
+			IsFinal:    true,
+		}, &asked)
+
+		reply := s.next()
+		if reply != nil && reply.State.CurrentStep > asked.CurrentStep {
+			s.answered = append(s.answered, asked.Purpose)
+		}
+		if turn.Expect == "" {
+			continue
+		}
+		if reply == nil {
+			s.failf("turn %d: expected the agent to say %q, but it didn't reply", i+1, turn.Expect)
+		} else if !containsFold(reply.Text, turn.Expect) {
+			s.failf("turn %d: expected the agent to say %q, got %q", i+1, turn.Expect, reply.Text)
+		}
+	}
+	s.finishSpeaking()
+
+	s.settle(ctx)
+	s.takeSnapshot(ctx)
+
+	// Hang up like the call provider does and hand in a recording, so the
+	// report goes out right away.
+	state := s.state
+	if state == nil {
+		state = &models.ClientState{RulesetID: s.ruleset.ID}
+	}
+	s.ctrl.SetConversationDone(ctx, state, callID, time.Now())
+	s.ctrl.ProcessRecording(ctx, s.ruleset.ID, callID, &models.Recording{Url: "simulated"})
+}
+
+// settle waits for the answers that are stored in the background.
+func (s *simulation) settle(ctx context.Context) {
+	deadline := time.Now().Add(s.wait)
+	for time.Now().Before(deadline) {
+		conversation, err := s.db.GetConversation(ctx, s.ruleset.ID, callID)
+		if err != nil {
+			return
+		}
+		stored := true
+		for _, purpose := range s.answered {
+			if _, ok := conversation.Responses[purpose]; !ok {
+				stored = false
+			}
+		}
+		if stored {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (s *simulation) takeSnapshot(ctx context.Context) {
+	conversation, err := s.db.GetConversation(ctx, s.ruleset.ID, callID)
+	if err != nil {
+		s.snapshot = &models.Conversation{}
+		return
+	}
+	s.snapshot = conversation
+
+	fmt.Fprintln(s.out, "\n--- Answers")
+	var purposes []string
+	for purpose := range conversation.Responses {
+		purposes = append(purposes, purpose)
+	}
+	sort.Strings(purposes)
+	for _, purpose := range purposes {
+		fmt.Fprintf(s.out, "%s: %s\n", purpose, conversation.Responses[purpose])
+	}
+}
+
+var (
+	cellBreak = regexp.MustCompile(`</td>\s*<td[^>]*>`)
+	tags      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// reportText turns the html report into plain text, a line per row.
+func reportText(body string) string {
+	text := cellBreak.ReplaceAllString(body, ": ")
+	text = tags.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+func containsFold(text string, part string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(part))
+}
+
+// expect prints the outcome of the call and checks it against the
+// expectations of the script.
+func (s *simulation) expect(expect Expectation) {
+	outcome := ""
+	if s.mail.sent {
+		outcome = outcomeReported
+		fmt.Fprintln(s.out, "\n--- Report")
+		fmt.Fprintf(s.out, "To: %s\nSubject: %s\n\n%s\n", strings.Join(s.mail.to, ", "), s.mail.subject, reportText(s.mail.body))
+	} else if s.db.GetArchived(s.ruleset.ID, callID) != nil {
+		outcome = outcomeArchived
+		if callbacks := s.db.GetCallbacks(s.ruleset.ID); len(callbacks) > 0 {
+			outcome = outcomeCallback
+		}
+		fmt.Fprintf(s.out, "\n--- Not reported, %s\n", outcome)
+	} else {
+		fmt.Fprintln(s.out, "\n--- Not reported")
+	}
+
+	if expect.Outcome != "" && expect.Outcome != outcome {
+		s.failf("expected the call to be %s, but it was %q", expect.Outcome, outcome)
+	}
+	if expect.Subject != "" && !containsFold(s.mail.subject, expect.Subject) {
+		s.failf("expected the subject to contain %q, got %q", expect.Subject, s.mail.subject)
+	}
+	report := reportText(s.mail.body)
+	for _, part := range expect.Report {
+		if !containsFold(report, part) {
+			s.failf("expected the report to contain %q", part)
+		}
+	}
+
+	conversation := s.snapshot
+	purposes := make([]string, 0, len(expect.Answers))
+	for purpose := range expect.Answers {
+		purposes = append(purposes, purpose)
+	}
+	sort.Strings(purposes)
+	for _, purpose := range purposes {
+		want := expect.Answers[purpose]
+		answer, ok := conversation.Responses[purpose]
+		if !ok {
+			s.failf("expected an answer for %s", purpose)
+		} else if !containsFold(answer, want) {
+			s.failf("expected answer %s to contain %q, got %q", purpose, want, answer)
+		}
+	}
+	if expect.Intent != "" && conversation.Intent != expect.Intent {
+		s.failf("expected intent %q, got %q", expect.Intent, conversation.Intent)
+	}
+	if expect.Language != "" && conversation.Language != expect.Language {
+		s.failf("expected language %q, got %q", expect.Language, conversation.Language)
+	}
+	if expect.Urgent != nil && conversation.Urgent != *expect.Urgent {
+		s.failf("expected urgent to be %v, got %v", *expect.Urgent, conversation.Urgent)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goVoice/internal/models"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Script is what the simulated caller says and what the ruleset author
+// expects to come out of it.
+type Script struct {
+	// Ruleset is the path to the ruleset json, relative to the script
+	Ruleset string `yaml:"ruleset"`
+	// Language the caller speaks unless a turn says otherwise, which the
+	// offline AI provider detects
+	Language string `yaml:"language"`
+	// Caller is the number the call comes from, withheld when empty
+	Caller string `yaml:"caller"`
+	// At is when the call is made, for rulesets with a schedule. Defaults
+	// to now.
+	At     time.Time   `yaml:"at"`
+	Turns  []Turn      `yaml:"turns"`
+	Expect Expectation `yaml:"expect"`
+}
+
+// Turn is a single thing the caller does.
+type Turn struct {
+	Say        string  `yaml:"say"`
+	Confidence float64 `yaml:"confidence"`
+	Language   string  `yaml:"language"`
+	// Hangup has the caller hang up instead of saying anything
+	Hangup bool `yaml:"hangup"`
+	// Expect is text the agent's reply should contain
+	Expect string `yaml:"expect"`
+}
+
+// Expectation is checked against the outcome of the call. Text is matched
+// case insensitive and only has to be contained in what it is checked
+// against. Anything left empty isn't checked.
+type Expectation struct {
+	Answers  map[string]string `yaml:"answers"`
+	Intent   string            `yaml:"intent"`
+	Language string            `yaml:"language"`
+	Urgent   *bool             `yaml:"urgent"`
+	// Outcome is one of reported, archived or callback
+	Outcome string   `yaml:"outcome"`
+	Subject string   `yaml:"subject"`
+	Report  []string `yaml:"report"`
+}
+
+// language returns the language the caller speaks in the turn.
+func (t Turn) language(script *Script) string {
+	if t.Language != "" {
+		return t.Language
+	}
+	return script.Language
+}
+
+const (
+	outcomeReported = "reported"
+	outcomeArchived = "archived"
+	outcomeCallback = "callback"
+)
+
+func loadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var script Script
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&script); err != nil {
+		return nil, fmt.Errorf("error parsing script %s: %w", path, err)
+	}
+	if script.Ruleset != "" && !filepath.IsAbs(script.Ruleset) {
+		script.Ruleset = filepath.Join(filepath.Dir(path), script.Ruleset)
+	}
+	return &script, nil
+}
+
+func loadRuleset(path string) (*models.ConversationRuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ruleset models.ConversationRuleSet
+	if err := json.Unmarshal(data, &ruleset); err != nil {
+		return nil, fmt.Errorf("error parsing ruleset %s: %w", path, err)
+	}
+	if len(ruleset.Steps) == 0 {
+		return nil, fmt.Errorf("ruleset %s has no steps", path)
+	}
+	if ruleset.ID == "" {
+		ruleset.ID = "simulation"
+	}
+	return &ruleset, nil
+}
@@ -4,33 +4,46 @@ import (
 	"goVoice/internal/app/conversation"
 	"goVoice/internal/config"
 	"goVoice/internal/email"
+	"goVoice/internal/open311"
+	"goVoice/internal/webhook"
+	"goVoice/internal/zgw"
 	"goVoice/pkg/ai"
 	"goVoice/pkg/audio"
 	"goVoice/pkg/audio/telnyx"
 	"goVoice/pkg/db"
 	"goVoice/pkg/storage"
+	"goVoice/pkg/stt"
 
 	"github.com/gin-gonic/gin"
 )
 
 type VoiceAPI struct {
 	Router *gin.Engine
+	// Conversations is the controller the calls are handled with
+	Conversations *conversation.Controller
 }
 
-func NewVoiceAPI(cfg *config.Config, storage storage.StorageProvider, db db.DbProvider, ai ai.AIProvider, router *gin.Engine) *VoiceAPI {
+func NewVoiceAPI(cfg *config.Config, storage storage.StorageProvider, db db.DbProvider, ai ai.AIProvider, transcriber stt.Transcriber, router *gin.Engine) *VoiceAPI {
 	api := &VoiceAPI{Router: router}
 
 	// We can replace the Telnyx struct with any other provider
 	// as long as they implement the CallProvider interface
 	convCtrl := &conversation.Controller{
-		Storage: storage,
-		DB:      db,
-		AI:      ai,
-		Email:   email.NewEmailProvider(cfg),
+		Storage:  storage,
+		DB:       db,
+		AI:       ai,
+		Email:    email.NewEmailProvider(cfg),
+		Webhooks: webhook.NewDeliverer(db),
+		Open311:  open311.NewExporter(),
+		ZGW:      zgw.NewClient(),
+		STT:      transcriber,
+
+		RecordingDeadline: cfg.RecordingDeadline,
 	}
 	client := telnyx.NewTelnyxClient(cfg, convCtrl)
 	// client.SetBucketCredentials(cfg)
 	convCtrl.CallProvider = client
+	api.Conversations = convCtrl
 
 	api.routes(client)
 	return api
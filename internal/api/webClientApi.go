@@ -1,12 +1,21 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"expvar"
+	"fmt"
+	"goVoice/internal/billing"
 	"goVoice/internal/config"
 	"goVoice/internal/models"
+	"goVoice/internal/prompts"
+	"goVoice/internal/redact"
+	"goVoice/internal/schedule"
+	"goVoice/internal/webhook"
 	"goVoice/pkg/db"
 	"goVoice/pkg/storage"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,10 +24,22 @@ type WebClientAPI struct {
 	Router  *gin.Engine
 	storage storage.StorageProvider
 	db      db.DbProvider
+	hooks   *webhook.Deliverer
+	// AI providers rulesets can pick by name
+	aiProviders map[string]config.AIProviderConfig
+	// Price table the usage endpoint prices usage with
+	prices *billing.Prices
+	// Reports the conversations that weren't reported
+	reporter Reporter
 }
 
-func NewWebClientAPI(cfg *config.Config, storageHandler storage.StorageProvider, dbHandler db.DbProvider, router *gin.Engine) *WebClientAPI {
-	api := &WebClientAPI{Router: router, storage: storageHandler, db: dbHandler}
+// Reporter reports a done conversation again, see conversation.Controller
+type Reporter interface {
+	Report(ctx context.Context, rulesetID string, conversationID string) error
+}
+
+func NewWebClientAPI(cfg *config.Config, storageHandler storage.StorageProvider, dbHandler db.DbProvider, prices *billing.Prices, reporter Reporter, router *gin.Engine) *WebClientAPI {
+	api := &WebClientAPI{Router: router, storage: storageHandler, db: dbHandler, hooks: webhook.NewDeliverer(dbHandler), aiProviders: cfg.AIProviders, prices: prices, reporter: reporter}
 	api.routes()
 	return api
 }
@@ -26,6 +47,16 @@ func NewWebClientAPI(cfg *config.Config, storageHandler storage.StorageProvider,
 func (api *WebClientAPI) routes() {
 	api.Router.GET("/", api.HandleRoot)
 	api.Router.POST("/ruleset", api.apiKeyRequired(), api.HandleRulesetUpload)
+	// Counters such as conversation_failures, see the expvar package
+	api.Router.GET("/metrics", api.apiKeyRequired(), gin.WrapH(expvar.Handler()))
+	// Webhook deliveries that kept failing
+	api.Router.GET("/rulesets/:rulesetId/deadletters", api.apiKeyRequired(), api.HandleDeadLetters)
+	api.Router.POST("/rulesets/:rulesetId/deadletters/:deadLetterId/redeliver", api.apiKeyRequired(), api.HandleRedeliver)
+	// Conversations that are done but whose report wasn't sent
+	api.Router.GET("/rulesets/:rulesetId/unreported", api.apiKeyRequired(), api.HandleUnreported)
+	api.Router.POST("/rulesets/:rulesetId/unreported/:conversationId/report", api.apiKeyRequired(), api.HandleReport)
+	// Usage and cost per ruleset and customer, ?from=2006-01-02&to=2006-01-02
+	api.Router.GET("/usage", api.apiKeyRequired(), api.HandleUsage)
 }
 
 func (api *WebClientAPI) apiKeyRequired() gin.HandlerFunc {
@@ -72,6 +103,46 @@ func (api *WebClientAPI) HandleRulesetUpload(c *gin.Context) {
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
+	for _, hook := range ruleset.Webhooks {
+		if err := webhook.Validate(hook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+	}
+	if ruleset.AI != nil && ruleset.AI.Provider != "" {
+		if _, ok := api.aiProviders[ruleset.AI.Provider]; !ok {
+			err := fmt.Errorf("unknown AI provider %q", ruleset.AI.Provider)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := schedule.Validate(ruleset.Schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if err := prompts.Validate(ruleset.ValidationPrompt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if err := redact.Validate(ruleset.Redact); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
 	context := c.Request.Context()
 	err = api.db.AddRuleset(context, &ruleset)
 	if err != nil {
@@ -85,3 +156,90 @@ func (api *WebClientAPI) HandleRulesetUpload(c *gin.Context) {
 		"message": "Ruleset successfully uploaded",
 	})
 }
+
+func (api *WebClientAPI) HandleDeadLetters(c *gin.Context) {
+	deadLetters, err := api.db.GetDeadLetters(c.Request.Context(), c.Param("rulesetId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error reading dead letters from database",
+		})
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, deadLetters)
+}
+
+func (api *WebClientAPI) HandleRedeliver(c *gin.Context) {
+	err := api.hooks.Redeliver(c.Request.Context(), c.Param("rulesetId"), c.Param("deadLetterId"))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "Error redelivering webhook: " + err.Error(),
+		})
+		c.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook successfully redelivered",
+	})
+}
+
+func (api *WebClientAPI) HandleUnreported(c *gin.Context) {
+	conversations, err := api.db.GetUnreported(c.Request.Context(), c.Param("rulesetId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error reading unreported conversations from database",
+		})
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, conversations)
+}
+
+func (api *WebClientAPI) HandleReport(c *gin.Context) {
+	err := api.reporter.Report(c.Request.Context(), c.Param("rulesetId"), c.Param("conversationId"))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "Error reporting conversation: " + err.Error(),
+		})
+		c.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Conversation successfully reported",
+	})
+}
+
+func (api *WebClientAPI) HandleUsage(c *gin.Context) {
+	// The current month up to today by default
+	now := time.Now()
+	from := c.DefaultQuery("from", now.Format("2006-01")+"-01")
+	to := c.DefaultQuery("to", now.Format("2006-01-02"))
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("invalid day %q, use 2006-01-02", day),
+			})
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	days, err := api.db.GetDailyUsage(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error reading usage from database",
+		})
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if customer := c.Query("customer"); customer != "" {
+		var filtered []models.DailyUsage
+		for _, day := range days {
+			if day.Customer == customer {
+				filtered = append(filtered, day)
+			}
+		}
+		days = filtered
+	}
+	c.JSON(http.StatusOK, billing.Summarize(from, to, days, api.prices))
+}
@@ -0,0 +1,111 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai"
+	"log"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const defaultCallerIDText = "Is {{.Number}} het juiste nummer?"
+
+// confirmations are the words a caller confirms their number with.
+var confirmations = []string{"ja", "jazeker", "jawel", "klopt", "correct", "juist", "precies", "yes"}
+
+// nationalNumber writes a Dutch number in E.164 the way it is dialed within
+// the Netherlands, other numbers are returned as they are.
+func nationalNumber(number string) string {
+	if strings.HasPrefix(number, "+31") {
+		return "0" + strings.TrimPrefix(number, "+31")
+	}
+	return number
+}
+
+// spokenNumber writes the number the way it is read out, splitting off the
+// 06 of mobile numbers so it is read as "nul zes".
+func spokenNumber(number string) string {
+	national := nationalNumber(number)
+	if strings.HasPrefix(national, "06") && len(national) == 10 {
+		return "06-" + national[2:]
+	}
+	return national
+}
+
+func digitCount(text string) int {
+	count := 0
+	for _, r := range text {
+		if unicode.IsDigit(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// confirmsCallerID tells whether the caller agreed their number is right.
+func confirmsCallerID(transcript string) bool {
+	text := normalizeWords(transcript)
+	for _, word := range confirmations {
+		if strings.Contains(text, " "+word+" ") {
+			return !strings.Contains(text, " nee ") && !strings.Contains(text, " niet ")
+		}
+	}
+	return false
+}
+
+// callerIDQuestion returns what the agent asks to have the caller confirm the
+// number they call from.
+func callerIDQuestion(step *models.ConversationStep, number string) string {
+	text := step.CallerIDText
+	if text == "" {
+		text = defaultCallerIDText
+	}
+	tmpl, err := template.New("callerId").Parse(text)
+	if err != nil {
+		log.Printf("Error parsing caller ID text of %s, using default: %v", step.Purpose, err)
+		tmpl = template.Must(template.New("callerId").Parse(defaultCallerIDText))
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, struct{ Number string }{spokenNumber(number)}); err != nil {
+		log.Printf("Error executing caller ID text of %s: %v", step.Purpose, err)
+		return strings.ReplaceAll(defaultCallerIDText, "{{.Number}}", spokenNumber(number))
+	}
+	return sb.String()
+}
+
+// confirmCallerID handles the reply to the question whether the number the
+// caller calls from is right. It returns the answer to store for the step, or
+// nil when the caller declined and the step was asked as usual instead.
+func (c *Controller) confirmCallerID(ctx context.Context, callID string, answer *bufferedAnswer, state *models.ClientState, rules *models.ConversationRuleSet) *bufferedAnswer {
+	step := rules.Steps[state.CurrentStep]
+	// Callers who read out another number answered the step themselves
+	if digitCount(answer.Transcript) >= 8 {
+		return answer
+	}
+	if confirmsCallerID(answer.Transcript) {
+		return &bufferedAnswer{
+			Transcript: answer.Transcript,
+			Confidence: 1,
+			Validated: &ai.ValidatedAnswer{
+				Question: step.Text,
+				Purpose:  step.Purpose,
+				Answer:   nationalNumber(state.CallerNumber),
+			},
+		}
+	}
+
+	log.Printf("Caller %s declined their number, asking %s", callID, step.Purpose)
+	declined := *state
+	declined.ConfirmingCallerID = false
+	declined.CallerIDDeclined = true
+	done, errChan := c.broadcastNextStep(callID, &declined, &step)
+	select {
+	case <-done:
+	case err := <-errChan:
+		log.Printf("Error asking %s again: %v", step.Purpose, err)
+		c.handleFailure(ctx, callID, state, rules, failure(FailureCallProvider, "broadcast step", err))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package conversation
+
+import (
+	"goVoice/internal/models"
+	"testing"
+)
+
+func TestSpokenNumber(t *testing.T) {
+	tests := []struct {
+		number   string
+		expected string
+	}{
+		{"+31612345678", "06-12345678"},
+		{"+31582331234", "0582331234"},
+		{"0612345678", "06-12345678"},
+		{"+4930123456", "+4930123456"},
+	}
+
+	for _, test := range tests {
+		if got := spokenNumber(test.number); got != test.expected {
+			t.Errorf("spokenNumber(%q) = %q, expected %q", test.number, got, test.expected)
+		}
+	}
+}
+
+func TestConfirmsCallerID(t *testing.T) {
+	tests := []struct {
+		transcript string
+		expected   bool
+	}{
+		{"Ja, dat klopt.", true},
+		{"Jazeker", true},
+		{"Nee, dat klopt niet", false},
+		{"Nee", false},
+		{"Bel me liever op mijn werk", false},
+	}
+
+	for _, test := range tests {
+		if got := confirmsCallerID(test.transcript); got != test.expected {
+			t.Errorf("confirmsCallerID(%q) = %v, expected %v", test.transcript, got, test.expected)
+		}
+	}
+}
+
+func TestCallerIDQuestion(t *testing.T) {
+	step := &models.ConversationStep{Purpose: "telefoon"}
+	if got := callerIDQuestion(step, "+31612345678"); got != "Is 06-12345678 het juiste nummer?" {
+		t.Errorf("Unexpected default question %q", got)
+	}
+	step.CallerIDText = "Mogen we u terugbellen op {{.Number}}?"
+	if got := callerIDQuestion(step, "+31612345678"); got != "Mogen we u terugbellen op 06-12345678?" {
+		t.Errorf("Unexpected question %q", got)
+	}
+}
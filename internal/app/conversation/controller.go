@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"goVoice/internal/email"
 	"goVoice/internal/models"
+	"goVoice/internal/open311"
+	"goVoice/internal/webhook"
+	"goVoice/internal/zgw"
 	"goVoice/pkg/ai"
 	"goVoice/pkg/audio"
 	"goVoice/pkg/db"
 	"goVoice/pkg/storage"
+	"goVoice/pkg/stt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,29 +29,77 @@ type Controller struct {
 	Storage      storage.StorageProvider
 	DB           db.DbProvider
 	AI           ai.AIProvider
-	Email        *email.EmailProvider
+	Email        email.Sender
+	// Webhooks delivers the result of every reported call, it is optional
+	Webhooks *webhook.Deliverer
+	// Open311 files reported calls with rulesets that have an Open311
+	// endpoint, it is optional
+	Open311 *open311.Exporter
+	// ZGW creates zaken for rulesets with ZGW APIs, it is optional
+	ZGW *zgw.Client
+	// STT transcribes the recordings of rulesets that ask for it again after
+	// the call, it is optional
+	STT stt.Transcriber
+	// How long to wait for the recordings of a call before reporting it
+	// without them, defaults to two minutes
+	RecordingDeadline time.Duration
+	// How long to wait before sending a report again when emailing it
+	// failed, doubling with every attempt, defaults to a minute
+	ReportRetryDelay time.Duration
+	// Clock tells the time schedules are checked at, defaults to time.Now
+	Clock func() time.Time
+
+	mu        sync.Mutex
+	buffers   map[string]*answerBuffer
+	escalated map[string]bool
+	deadlines map[string]*time.Timer
+	speeches  map[string]*speech
 }
 
-func (c *Controller) StartConversation(rulesetID string, callID string) {
+// StartConversation opens the conversation of a call that was answered with
+// the given state, see OpeningState.
+func (c *Controller) StartConversation(answered *models.ClientState, callID string, call models.CallInfo) {
+	ctx := context.Background()
+	rulesetID := answered.RulesetID
+	// The conversation goes in first so failures have something to be marked on
+	err := c.DB.AddConversation(ctx, rulesetID, &models.Conversation{
+		ID:                 callID,
+		RulesetID:          rulesetID,
+		Responses:          make(map[string]string),
+		ExpectedRecordings: recordingsPerCall,
+		CallerNumber:       call.From,
+		CallerWithheld:     call.Withheld,
+		DialedNumber:       call.To,
+		Direction:          call.Direction,
+		StartedAt:          call.StartedAt,
+		Closed:             answered.Closed,
+		Exception:          answered.Exception,
+	})
+	if err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error adding conversation to database: %v", err)
+	}
+
 	ruleSet, err := c.getRules(rulesetID)
 	if err != nil {
 		log.Printf("Error getting conversation rules: %v", err)
+		c.handleFailure(ctx, callID, &models.ClientState{RulesetID: rulesetID}, nil, err)
 		return
 	}
 
-	c.DB.AddConversation(context.Background(), rulesetID, &models.Conversation{
-		ID:        callID,
-		RulesetID: rulesetID,
-		Responses: make(map[string]string),
-	})
+	ruleSet = resolveFlow(ruleSet, answered)
 
 	// Grab the first step as conversation opener
 	opener := ruleSet.Steps[0]
 	clientState := models.ClientState{
-		RulesetID:   rulesetID,
-		CurrentStep: 0,
-		Purpose:     opener.Purpose,
-		TotalSteps:  len(ruleSet.Steps),
+		RulesetID:    rulesetID,
+		CurrentStep:  0,
+		Purpose:      opener.Purpose,
+		TotalSteps:   len(ruleSet.Steps),
+		Voice:        ruleSet.Voice,
+		CallerNumber: call.From,
+		Closed:       answered.Closed,
+		Exception:    answered.Exception,
 	}
 	doneChan, errChan := c.broadcastNextStep(callID, &clientState, &opener)
 
@@ -55,48 +108,132 @@ func (c *Controller) StartConversation(rulesetID string, callID string) {
 		log.Printf("Successfully sent conversation opener to caller")
 	case err := <-errChan:
 		log.Printf("Error sending conversation opener to caller: %v", err)
-		// TODO: do we abandon the call?
+		c.recordFailure(ctx, callID, &clientState, failure(FailureCallProvider, "broadcast opener", err))
+		c.CallProvider.EndCall(callID)
+	}
+}
+
+func (c *Controller) ProcessTranscription(ctx context.Context, callID string, fragment *models.TranscriptFragment, state *models.ClientState) {
+	if state.PendingAction != "" {
+		log.Printf("Ignoring transcription for %s while %s is pending", callID, state.PendingAction)
+		return
+	}
+	if strings.TrimSpace(fragment.Transcript) != "" {
+		c.bargeIn(callID)
+	}
+
+	rules, err := c.rulesFor(state)
+	if err != nil {
+		log.Printf("Error getting conversation rules: %v", err)
+		if fragment.IsFinal {
+			c.handleFailure(ctx, callID, state, nil, err)
+		}
+		return
+	}
+
+	if c.checkEmergency(ctx, callID, rules, state, fragment) {
+		return
 	}
+
+	// in case people are still talking after the conversation is over, the
+	// call is ended once the final step has been played.
+	if state.CurrentStep >= len(rules.Steps)-1 {
+		log.Printf("Ignoring transcription for %s after the final step", callID)
+		return
+	}
+
+	c.bufferFragment(ctx, callID, fragment, state, rules)
 }
 
-func (c *Controller) ProcessTranscription(ctx context.Context, callID string, transcript string, state *models.ClientState) {
-	rules, err := c.getRules(state.RulesetID)
+// commitAnswer stores the answer to the current step and moves the caller on
+// to the next step.
+func (c *Controller) commitAnswer(ctx context.Context, callID string, answer *bufferedAnswer, state *models.ClientState) {
+	c.addTranscriptLine(callID, state.RulesetID, models.SpeakerCaller, answer.Transcript)
+
+	rules, err := c.rulesFor(state)
 	if err != nil {
 		log.Printf("Error getting conversation rules: %v", err)
+		c.handleFailure(ctx, callID, state, nil, err)
 		return
 	}
 
-	// in case people are still talking after the conversation is over
-	wasFinalStep := len(rules.Steps) == state.CurrentStep-1
-	if wasFinalStep {
-		done, errChan := c.CallProvider.EndCall(callID)
-		select {
-		case <-done:
+	if state.ConfirmingCallerID {
+		if answer = c.confirmCallerID(ctx, callID, answer, state, rules); answer == nil {
 			return
-		case err := <-errChan:
-			log.Printf("Error ending call: %v", err)
+		}
+	}
+
+	if state.CurrentStep == 0 && state.Language == "" && len(rules.Translations) > 0 {
+		var switched bool
+		state, switched = c.switchLanguage(ctx, callID, rules, state, answer)
+		if switched {
+			// The opener was most likely not understood, ask it again in the
+			// language of the caller.
+			rules = resolveFlow(rules, state)
+			opener := rules.Steps[0]
+			done, errChan := c.broadcastNextStep(callID, state, &opener)
+			select {
+			case <-done:
+			case err := <-errChan:
+				log.Printf("Error broadcasting translated opener: %v", err)
+				c.handleFailure(ctx, callID, state, rules, failure(FailureCallProvider, "broadcast step", err))
+			}
 			return
 		}
 	}
 
-	go c.validateAndStoreAnswer(ctx, transcript, callID, state, rules)
+	if state.CurrentStep == 0 && state.Intent == "" && len(rules.Intents) > 0 {
+		routed := *state
+		routed.Intent = c.detectIntent(ctx, callID, rules, answer.Transcript)
+		state = &routed
+		rules = resolveFlow(rules, state)
+	}
 
-	step, err := c.getResponse(rules, state, transcript)
+	step, err := c.getResponse(ctx, callID, rules, state, answer.Transcript)
 	if err != nil {
 		log.Printf("Error getting response for client: %v", err)
-		// TODO tell the callee that something went wrong and handle gracefully
-		c.CallProvider.EndCall(callID)
+		go c.validateAndStoreAnswer(ctx, answer, callID, state, rules)
+		c.handleFailure(ctx, callID, state, rules, failure(FailureAI, "get response", err))
+		return
+	}
+
+	if step.Prompt != nil {
+		// The text of prompt steps is generated from the answers so far,
+		// including this one.
+		c.validateAndStoreAnswer(ctx, answer, callID, state, rules)
+	} else {
+		go c.validateAndStoreAnswer(ctx, answer, callID, state, rules)
+	}
+
+	if c.isEscalated(callID) {
+		log.Printf("Not moving %s on to the next step, the call was escalated", callID)
 		return
 	}
 
 	nextState := models.ClientState{
-		RulesetID:   state.RulesetID,
-		CurrentStep: state.CurrentStep + 1,
-		TotalSteps:  state.TotalSteps,
-		Purpose:     rules.Steps[state.CurrentStep+1].Purpose,
+		RulesetID:    state.RulesetID,
+		CurrentStep:  state.CurrentStep + 1,
+		TotalSteps:   len(rules.Steps),
+		Purpose:      rules.Steps[state.CurrentStep+1].Purpose,
+		Intent:       state.Intent,
+		Language:     state.Language,
+		Voice:        state.Voice,
+		CallerNumber: state.CallerNumber,
+		Closed:       state.Closed,
+		Exception:    state.Exception,
 	}
 
-	c.broadcastNextStep(callID, &nextState, &step)
+	if c.streamsStep(rules, state, &step) {
+		c.streamNextStep(ctx, callID, rules, &nextState, &step, answer.Transcript)
+		return
+	}
+	done, errChan := c.broadcastNextStep(callID, &nextState, &step)
+	select {
+	case <-done:
+	case err := <-errChan:
+		log.Printf("Error broadcasting next step: %v", err)
+		c.handleFailure(ctx, callID, state, rules, failure(FailureCallProvider, "broadcast step", err))
+	}
 }
 
 func (c *Controller) getRules(rulesetID string) (*models.ConversationRuleSet, error) {
@@ -104,25 +241,20 @@ func (c *Controller) getRules(rulesetID string) (*models.ConversationRuleSet, er
 	ruleSet, err := c.DB.GetRuleSet(context, rulesetID)
 	if err != nil {
 		log.Printf("Error fetching ruleset from DB: %v", err)
-		return &models.ConversationRuleSet{}, err
+		return &models.ConversationRuleSet{}, failure(FailureDB, "get rules", err)
 	}
 
 	return ruleSet, nil
 }
 
-func (c *Controller) getResponse(rules *models.ConversationRuleSet, state *models.ClientState, transcript string) (models.ConversationStep, error) {
+func (c *Controller) getResponse(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, transcript string) (models.ConversationStep, error) {
 	if rules.Simple {
 		return getSimpleResponse(rules, state), nil
 	} else {
-		return getAdvancedResponse(rules, state, transcript)
+		return c.getAdvancedResponse(ctx, callID, rules, state, transcript)
 	}
 }
 
-// get a response using an LLM
-func getAdvancedResponse(rules *models.ConversationRuleSet, state *models.ClientState, transcript string) (models.ConversationStep, error) {
-	panic("unimplemented")
-}
-
 // get a response using a simple call script
 func getSimpleResponse(rules *models.ConversationRuleSet, state *models.ClientState) models.ConversationStep {
 	if len(rules.Steps) >= state.CurrentStep+1 {
@@ -134,102 +266,122 @@ func getSimpleResponse(rules *models.ConversationRuleSet, state *models.ClientSt
 	}
 }
 
-func (c *Controller) EndConversation(ctx context.Context, state *models.ClientState, callID string) error {
+// EndConversation reports the conversation to the clients of the ruleset and
+// removes it. It is called by finalize once the call is done and the
+// recordings are in.
+func (c *Controller) EndConversation(ctx context.Context, rulesetID string, callID string) error {
 	log.Printf("Ending conversation for %v", callID)
-	rulesetID := state.RulesetID
+	c.dropBuffer(callID)
+	c.dropSpeech(callID)
+	c.mu.Lock()
+	delete(c.escalated, callID)
+	c.mu.Unlock()
 
-	time.Sleep(10 * time.Second)
+	ruleset, err := c.DB.GetRuleSet(ctx, rulesetID)
+	if err != nil {
+		log.Printf("Error getting ruleset from database, unable to report %s: %v", callID, err)
+		failureCount.Add(string(FailureDB), 1)
+		return fmt.Errorf("%w: %w", errUnreported, err)
+	}
 
+	// Whatever fails from here on, the caller's answers still get reported,
+	// marked with what went wrong.
 	conversation, err := c.DB.GetConversation(ctx, rulesetID, callID)
 	if err != nil {
 		log.Printf("Error getting conversation from database: %v", err)
-		return err
+		failureCount.Add(string(FailureDB), 1)
+		conversation = &models.Conversation{ID: callID, RulesetID: rulesetID}
+		conversation.Failures = append(conversation.Failures, reportFailure(FailureDB, "get conversation", err))
 	}
 
-	recordings, err := c.DB.GetRecordings(ctx, rulesetID, callID)
-	if err != nil {
-		log.Printf("Error checking if conversation is complete: %v", err)
-		return err
+	recordings := conversation.Recordings
+	if missing := conversation.ExpectedRecordings - len(recordings); missing > 0 {
+		log.Printf("Reporting %s without %d of its recordings", callID, missing)
 	}
 
-	log.Println("Assuming conversation is complete, sending email.")
+	c.recordCallUsage(ctx, ruleset, conversation)
 
-	ruleset, err := c.DB.GetRuleSet(ctx, rulesetID)
-	if err != nil {
-		log.Printf("Error getting ruleset from database: %v", err)
-		return err
+	if !c.handleClosed(ctx, ruleset, conversation) {
+		log.Printf("Conversation %s came in while the line was closed, archived it", callID)
+		return nil
 	}
 
-	body := formatEmailBody(conversation.Responses, rulesetID, ruleset.Title, callID)
-	var attachments [][]byte
+	if !c.handlePartial(ctx, ruleset, conversation) {
+		log.Printf("Conversation %s was archived without reporting it", callID)
+		return nil
+	}
+
+	// The recordings are downloaded first, so they can be transcribed again
+	// before the summary and the exports
+	files := make([][]byte, len(recordings))
 	var attachmentsMutex sync.Mutex
-	var attachmentNames []string
-	var attachmentNamesMutex sync.Mutex
 	var wg sync.WaitGroup
 	wg.Add(len(recordings))
 
-	log.Printf("Body formatting done; Downloading %v recordings", len(recordings))
-	log.Println(recordings)
-
-	errChan := make(chan error, len(recordings))
+	log.Printf("Downloading %v recordings", len(recordings))
 
 	for i, recording := range recordings {
-		go func(rec *models.Recording, i int) {
+		go func(rec models.Recording, i int) {
 			defer wg.Done()
 
-			recChan, recErrChan := c.CallProvider.GetRecordingMp3(rec)
+			recChan, recErrChan := c.CallProvider.GetRecordingMp3(&rec)
 
 			select {
 			case recErr := <-recErrChan:
-				if recErr != nil {
-					log.Printf("Error getting recording: %v", recErr)
-					errChan <- recErr
-					return
-				}
-			case file := <-recChan:
-				log.Printf("Got recording for %v added it to attachments", i)
+				log.Printf("Error getting recording: %v", recErr)
+				failureCount.Add(string(FailureCallProvider), 1)
 				attachmentsMutex.Lock()
-				attachmentNamesMutex.Lock()
-				attachments = append(attachments, file)
-				attachmentNames = append(attachmentNames, fmt.Sprintf("%s-%s-recording-%d.mp3", ruleset.Title, callID, i))
+				conversation.Failures = append(conversation.Failures, reportFailure(FailureCallProvider, "download recording", recErr))
 				attachmentsMutex.Unlock()
-				attachmentNamesMutex.Unlock()
+			case file := <-recChan:
+				log.Printf("Got recording for %v added it to attachments", i)
+				files[i] = file
 			}
-		}(&recording, i)
+		}(recording, i)
 	}
 	log.Println("Waiting for recordings to finish downloading.")
 	wg.Wait()
 
-	close(errChan)
-	if err, ok := <-errChan; ok {
-		log.Printf("Error getting recording: %v", err)
-		return err
+	var attachments [][]byte
+	var attachmentNames []string
+	for i, file := range files {
+		if file == nil {
+			continue
+		}
+		attachments = append(attachments, file)
+		attachmentNames = append(attachmentNames, fmt.Sprintf("%s-%s-recording-%d.mp3", ruleset.Title, callID, i))
+	}
+
+	c.retranscribe(ctx, ruleset, conversation, files)
+
+	log.Println("Conversation is complete, summarizing.")
+	c.addSummary(ctx, ruleset, conversation)
+	c.exportOpen311(ctx, ruleset, conversation)
+	c.exportZGW(ctx, ruleset, conversation)
+
+	if c.Webhooks != nil {
+		result := callResult(ruleset, conversation)
+		go c.Webhooks.DeliverAll(context.Background(), ruleset, result)
 	}
+
 	log.Println("Recordings downloaded, sending email.")
+	body := formatEmailBody(conversation, ruleset.Title, callID)
+	subject := ruleset.Title
+	if conversation.Urgent {
+		subject = "[SPOED] " + subject
+	}
+	if len(conversation.Failures) > 0 {
+		subject += " (onvolledig)"
+	}
 	var emails []string
 	for _, client := range ruleset.Clients {
 		emails = append(emails, client.Email)
 	}
-	err = c.Email.SendEmailWithAttachment(ctx, emails, ruleset.Title, body, attachments, attachmentNames)
-	if err != nil {
-		log.Printf("Error sending email: %v", err)
-		return err
-	}
-	err = c.DB.DeleteConversation(ctx, rulesetID, callID)
-	if err != nil {
-		log.Printf("Error deleting conversation from database: %v", err)
-		return err
-	}
-
-	return nil
-}
-
-func (c *Controller) ProcessRecording(ctx context.Context, rulesetId string, callID string, recording *models.Recording) error {
-	// Set the recording on the conversation
-	err := c.DB.SetRecording(ctx, rulesetId, callID, recording)
-	if err != nil {
-		log.Printf("Error setting recordings on conversation: %v", err)
-		return err
-	}
-	return nil
+	return c.sendReport(ctx, rulesetID, callID, &report{
+		to:              emails,
+		subject:         subject,
+		body:            body,
+		attachments:     attachments,
+		attachmentNames: attachmentNames,
+	})
 }
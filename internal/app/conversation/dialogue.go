@@ -0,0 +1,113 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai/chat"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	dialogueMaxTokens   = 200
+	dialogueTemperature = 0.3
+)
+
+var dialogueFormat = &chat.ResponseFormat{
+	Name:   "next_turn",
+	Schema: json.RawMessage(`{"type": "object", "properties": {"text": {"type": "string"}}, "required": ["text"]}`),
+}
+
+// getAdvancedResponse has the AI provider say the next step of the ruleset in
+// its own words, carrying on from what was said so far. The step itself
+// stays the next one of the ruleset, when the AI provider fails its text is
+// used as is.
+func (c *Controller) getAdvancedResponse(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, transcript string) (models.ConversationStep, error) {
+	step := getSimpleResponse(rules, state)
+	if step.AudioURL != "" || step.Prompt != nil || step.UseCallerID {
+		// These steps say something specific, leave them be
+		return step, nil
+	}
+	if c.streamsStep(rules, state, &step) {
+		// The text is streamed while it is spoken, see streamNextStep
+		return step, nil
+	}
+
+	text, err := c.continueDialogue(ctx, callID, rules, state, transcript, &step)
+	if err != nil {
+		failureCount.Add(string(FailureAI), 1)
+		log.Printf("Error continuing the dialogue of %s, using the text of %s: %v", callID, step.Purpose, err)
+		return step, nil
+	}
+	step.Text = text
+	return step, nil
+}
+
+func (c *Controller) continueDialogue(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, transcript string, step *models.ConversationStep) (string, error) {
+	messages, err := c.dialogueMessages(ctx, callID, rules, state, transcript, step,
+		`Return it in the following json format: {"text": <text>} without any padding or fluff.`)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := c.complete(ctx, callID, rules, &chat.Request{
+		Messages:       messages,
+		Temperature:    chat.Temperature(dialogueTemperature),
+		MaxTokens:      dialogueMaxTokens,
+		ResponseFormat: dialogueFormat,
+	})
+	if err != nil {
+		return "", failure(FailureAI, "continue dialogue", err)
+	}
+	var generated generatedText
+	if err := json.Unmarshal([]byte(response.Content), &generated); err != nil {
+		return "", fmt.Errorf("error unmarshaling next turn: %w", err)
+	}
+	text := strings.TrimSpace(generated.Text)
+	if text == "" {
+		return "", errors.New("next turn is empty")
+	}
+	return truncateSpoken(text, defaultPromptMaxLength), nil
+}
+
+// dialogueMessages has the AI provider carry on the conversation so far by
+// asking the question of the step, replying as the reply instruction says.
+func (c *Controller) dialogueMessages(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, transcript string, step *models.ConversationStep, reply string) ([]chat.Message, error) {
+	system := fmt.Sprintf(`You are the voice assistant of %s taking a report from a caller on the phone. You are
+		given the conversation so far. Respond to what the caller said in a few words when it helps and then
+		ask the next question, which is: %q. It is read out loud by a text-to-speech engine, so use plain spoken %s
+		without any markup, lists or emojis. %s`, rules.Title, step.Text, languageName(rulesetLanguage(rules)), reply)
+
+	messages := []chat.Message{{Role: chat.RoleSystem, Content: system}}
+	conversation, err := c.DB.GetConversation(ctx, state.RulesetID, callID)
+	if err != nil {
+		return nil, failure(FailureDB, "get transcript", err)
+	}
+	return append(messages, dialogue(conversation.Transcript, transcript)...), nil
+}
+
+// dialogue turns the transcript into chat messages, ending with the answer
+// the caller just gave. The transcript is stored in the background, so the
+// answer might not be in it yet.
+func dialogue(transcript []models.TranscriptLine, answer string) []chat.Message {
+	lines := make([]models.TranscriptLine, len(transcript))
+	copy(lines, transcript)
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].At.Before(lines[j].At) })
+
+	var messages []chat.Message
+	for _, line := range lines {
+		role := chat.RoleAssistant
+		if line.Speaker == models.SpeakerCaller {
+			role = chat.RoleUser
+		}
+		messages = append(messages, chat.Message{Role: role, Content: line.Text})
+	}
+	if n := len(messages); n == 0 || messages[n-1].Role != chat.RoleUser || messages[n-1].Content != answer {
+		messages = append(messages, chat.Message{Role: chat.RoleUser, Content: answer})
+	}
+	return messages
+}
@@ -0,0 +1,36 @@
+package conversation
+
+import (
+	"goVoice/internal/models"
+	"goVoice/pkg/ai/chat"
+	"testing"
+	"time"
+)
+
+func TestDialogue(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	transcript := []models.TranscriptLine{
+		{Speaker: models.SpeakerCaller, Text: "De lantaarnpaal is kapot", At: start.Add(2 * time.Second)},
+		{Speaker: models.SpeakerAgent, Text: "Wat wilt u melden?", At: start},
+	}
+
+	messages := dialogue(transcript, "De lantaarnpaal is kapot")
+	expected := []chat.Message{
+		{Role: chat.RoleAssistant, Content: "Wat wilt u melden?"},
+		{Role: chat.RoleUser, Content: "De lantaarnpaal is kapot"},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %v", len(expected), messages)
+	}
+	for i := range expected {
+		if messages[i].Role != expected[i].Role || messages[i].Content != expected[i].Content {
+			t.Errorf("Message %d: expected %v, got %v", i, expected[i], messages[i])
+		}
+	}
+
+	// The answer isn't stored yet
+	messages = dialogue(transcript[1:], "De lantaarnpaal is kapot")
+	if len(messages) != 2 || messages[1].Content != "De lantaarnpaal is kapot" {
+		t.Errorf("Expected the answer to be added, got %v", messages)
+	}
+}
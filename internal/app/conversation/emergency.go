@@ -0,0 +1,189 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"goVoice/internal/models"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const defaultEmergencyMessage = "Is er direct gevaar? Hang dan op en bel 112."
+
+var emergencyCount = expvar.NewMap("emergency_triggers")
+
+type emergencyClassification struct {
+	Emergency bool   `json:"emergency"`
+	Reason    string `json:"reason"`
+}
+
+// normalizeWords lowercases the text and replaces everything but letters and
+// digits by single spaces, padding it with a space on both ends so whole
+// words can be matched with strings.Contains.
+func normalizeWords(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+// matchEmergencyKeyword returns the first keyword of the lexicon found in the
+// transcript, or an empty string.
+func matchEmergencyKeyword(keywords []string, transcript string) string {
+	text := normalizeWords(transcript)
+	for _, keyword := range keywords {
+		prefix := strings.HasSuffix(keyword, "*")
+		normalized := strings.TrimSpace(normalizeWords(strings.TrimSuffix(keyword, "*")))
+		if normalized == "" {
+			continue
+		}
+		if prefix && strings.Contains(text, " "+normalized) {
+			return keyword
+		}
+		if strings.Contains(text, " "+normalized+" ") {
+			return keyword
+		}
+	}
+	return ""
+}
+
+func (c *Controller) classifyEmergency(ctx context.Context, callID string, rules *models.ConversationRuleSet, transcript string) (*emergencyClassification, error) {
+	system := `You monitor calls to the non-emergency phone line of ` + rules.Title + `. You are given a
+		transcription of what a caller said, which might be incorrectly transcribed. Decide whether the caller
+		describes a situation that needs the emergency services right now, such as a fire, a gas smell, an injured
+		person or someone in danger. Return this in the following json format: {"emergency": <true/false>,
+		"reason": <short reason>} without any padding or fluff.`
+
+	reply, err := c.completeJSON(ctx, callID, rules, system, transcript)
+	if err != nil {
+		failureCount.Add(string(FailureAI), 1)
+		return nil, failure(FailureAI, "classify emergency", err)
+	}
+	var classification emergencyClassification
+	if err := json.Unmarshal([]byte(reply), &classification); err != nil {
+		return nil, fmt.Errorf("error unmarshaling emergency classification: %w", err)
+	}
+	return &classification, nil
+}
+
+// checkEmergency matches the fragment against the emergency lexicon of the
+// ruleset and escalates the call on a match. It returns whether the call was
+// escalated. Final fragments are also run by the AI classifier when the
+// ruleset asks for it, which happens in the background so it doesn't delay
+// the conversation.
+func (c *Controller) checkEmergency(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, fragment *models.TranscriptFragment) bool {
+	policy := rules.Emergency
+	if policy == nil || state.Emergency {
+		return false
+	}
+
+	if keyword := matchEmergencyKeyword(policy.Keywords, fragment.Transcript); keyword != "" {
+		c.escalate(ctx, callID, rules, state, &models.EmergencyTrigger{
+			Source:     "keyword",
+			Match:      keyword,
+			Transcript: fragment.Transcript,
+		})
+		return true
+	}
+
+	if policy.Classifier && fragment.IsFinal {
+		go func() {
+			classification, err := c.classifyEmergency(context.Background(), callID, rules, fragment.Transcript)
+			if err != nil {
+				log.Printf("Error classifying emergency for %s: %v", callID, err)
+				return
+			}
+			if classification.Emergency {
+				c.escalate(context.Background(), callID, rules, state, &models.EmergencyTrigger{
+					Source:     "classifier",
+					Match:      classification.Reason,
+					Transcript: fragment.Transcript,
+				})
+			}
+		}()
+	}
+	return false
+}
+
+// isUrgent tells whether the conversation was flagged as an emergency, such
+// calls are always reported.
+func isUrgent(conversation *models.Conversation) bool {
+	return conversation.Urgent || len(conversation.EmergencyTriggers) > 0
+}
+
+func (c *Controller) isEscalated(callID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.escalated[callID]
+}
+
+// unlessEscalated hands a step to the call provider with send, unless the
+// call was escalated. escalate marks the call under the same lock, so a step
+// that was on its way when the emergency came in is either sent before the
+// emergency message interrupts it or not at all.
+func (c *Controller) unlessEscalated(callID string, send func() (chan bool, chan error)) (chan bool, chan error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.escalated[callID] {
+		log.Printf("Not speaking the next step to %s, the call was escalated", callID)
+		done := make(chan bool, 1)
+		done <- true
+		return done, make(chan error, 1)
+	}
+	return send()
+}
+
+// escalate interrupts the conversation with the emergency message, flags the
+// conversation as urgent and transfers or ends the call afterwards.
+func (c *Controller) escalate(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, trigger *models.EmergencyTrigger) {
+	c.mu.Lock()
+	if c.escalated == nil {
+		c.escalated = make(map[string]bool)
+	}
+	if c.escalated[callID] {
+		c.mu.Unlock()
+		return
+	}
+	c.escalated[callID] = true
+	c.mu.Unlock()
+
+	trigger.Step = state.CurrentStep
+	trigger.Purpose = state.Purpose
+	trigger.OccurredAt = time.Now()
+	log.Printf("Emergency trigger source=%s match=%q call=%s ruleset=%s step=%d transcript=%q", trigger.Source, trigger.Match, callID, state.RulesetID, trigger.Step, trigger.Transcript)
+	emergencyCount.Add(trigger.Source, 1)
+
+	c.dropBuffer(callID)
+	c.dropSpeech(callID)
+	if err := c.DB.AddEmergencyTrigger(ctx, state.RulesetID, callID, trigger); err != nil {
+		c.recordFailure(ctx, callID, state, failure(FailureDB, "flag emergency", err))
+	}
+
+	policy := rules.Emergency
+	message := policy.Message
+	if message == "" {
+		message = defaultEmergencyMessage
+	}
+	nextState := *state
+	nextState.Emergency = true
+	nextState.PendingAction = models.PendingHangup
+	if policy.TransferNumber != "" {
+		nextState.PendingAction = models.PendingTransfer
+		nextState.TransferTo = policy.TransferNumber
+	}
+
+	c.addTranscriptLine(callID, state.RulesetID, models.SpeakerAgent, message)
+	done, errChan := c.CallProvider.InterruptAndSpeak(callID, message, &nextState)
+	select {
+	case <-done:
+	case err := <-errChan:
+		// The pending action won't be triggered by the end of the message,
+		// transfer or hang up right away
+		c.recordFailure(ctx, callID, &nextState, failure(FailureCallProvider, "speak emergency message", err))
+		c.RunPendingAction(ctx, callID, &nextState)
+	}
+}
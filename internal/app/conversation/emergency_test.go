@@ -0,0 +1,50 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	fakeaudio "goVoice/pkg/audio/fake"
+	"goVoice/pkg/db/memory"
+	"testing"
+)
+
+func TestMatchEmergencyKeyword(t *testing.T) {
+	keywords := []string{"gaslucht", "brand*", "bel 112"}
+
+	tests := []struct {
+		transcript string
+		expected   string
+	}{
+		{"Ik ruik een sterke Gaslucht in de straat.", "gaslucht"},
+		{"Er is een brandje bij de container", "brand*"},
+		{"Moet ik 112 bellen of bel 112 gewoon?", "bel 112"},
+		{"De afvalbrandstof van de bus", ""},
+		{"De lantaarnpaal is kapot", ""},
+	}
+
+	for _, test := range tests {
+		if got := matchEmergencyKeyword(keywords, test.transcript); got != test.expected {
+			t.Errorf("matchEmergencyKeyword(%q) = %q, expected %q", test.transcript, got, test.expected)
+		}
+	}
+}
+
+func TestEscalateSilencesNextStep(t *testing.T) {
+	calls := fakeaudio.NewCallProvider()
+	c := &Controller{CallProvider: calls, DB: memory.NewClient()}
+	rules := &models.ConversationRuleSet{ID: "afval", Emergency: &models.EmergencyPolicy{Keywords: []string{"gaslucht"}}}
+	state := &models.ClientState{RulesetID: rules.ID, CurrentStep: 1}
+
+	c.escalate(context.Background(), "call", rules, state, &models.EmergencyTrigger{Source: "keyword", Match: "gaslucht"})
+	if event := <-calls.Events; event.Kind != fakeaudio.EventInterrupt || !event.State.Emergency {
+		t.Fatalf("Expected the emergency message, got %+v", event)
+	}
+
+	done, _ := c.broadcastNextStep("call", &models.ClientState{RulesetID: rules.ID, CurrentStep: 2}, &models.ConversationStep{Text: "Wat is uw adres?"})
+	<-done
+	select {
+	case event := <-calls.Events:
+		t.Errorf("Expected nothing to be said after the emergency message, got %+v", event)
+	default:
+	}
+}
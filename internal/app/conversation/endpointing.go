@@ -0,0 +1,249 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai"
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultMaxWait is how long an answer is waited on for steps whose policy
+// has no MaxWait, so an answer held back by MinWords or the AI check is still
+// committed when the caller says nothing more.
+const defaultMaxWait = 15 * time.Second
+
+// answerBuffer collects the transcription fragments a caller speaks during a
+// single step until the endpointing policy of that step decides the answer is
+// complete.
+type answerBuffer struct {
+	step      int
+	state     *models.ClientState
+	fragments []models.TranscriptFragment
+	// version is bumped on every fragment so timers and AI checks that were
+	// started for an older version of the buffer can tell they are stale.
+	version      int
+	silenceTimer *time.Timer
+	maxWaitTimer *time.Timer
+	checking     bool
+	// recheck is set when the answer changed during the AI check, which then
+	// checks it again
+	recheck bool
+}
+
+// bufferedAnswer is the single answer committed for a step.
+type bufferedAnswer struct {
+	Transcript string
+	Confidence float64
+	// Validated is set when the AI completeness check already validated the
+	// answer, so it does not have to be validated a second time.
+	Validated *ai.ValidatedAnswer
+}
+
+func (b *answerBuffer) finalFragments() []models.TranscriptFragment {
+	var finals []models.TranscriptFragment
+	for _, fragment := range b.fragments {
+		if fragment.IsFinal {
+			finals = append(finals, fragment)
+		}
+	}
+	return finals
+}
+
+func (b *answerBuffer) answer() *bufferedAnswer {
+	finals := b.finalFragments()
+	if len(finals) == 0 {
+		// Nothing was marked final, fall back to the latest interim result
+		// as it contains everything the caller said so far.
+		if len(b.fragments) == 0 {
+			return &bufferedAnswer{}
+		}
+		finals = b.fragments[len(b.fragments)-1:]
+	}
+
+	var parts []string
+	var confidence float64
+	for _, fragment := range finals {
+		if text := strings.TrimSpace(fragment.Transcript); text != "" {
+			parts = append(parts, text)
+		}
+		confidence += fragment.Confidence
+	}
+	return &bufferedAnswer{
+		Transcript: strings.Join(parts, " "),
+		Confidence: confidence / float64(len(finals)),
+	}
+}
+
+func (b *answerBuffer) stopTimers() {
+	if b.silenceTimer != nil {
+		b.silenceTimer.Stop()
+	}
+	if b.maxWaitTimer != nil {
+		b.maxWaitTimer.Stop()
+	}
+}
+
+func wordCount(text string) int {
+	return len(strings.Fields(text))
+}
+
+func maxWait(policy *models.EndpointingPolicy) time.Duration {
+	if policy.MaxWait > 0 {
+		return time.Duration(policy.MaxWait) * time.Millisecond
+	}
+	return defaultMaxWait
+}
+
+// bufferFragment adds a fragment to the answer buffer of the call and commits
+// the answer once the endpointing policy of the current step is satisfied.
+func (c *Controller) bufferFragment(ctx context.Context, callID string, fragment *models.TranscriptFragment, state *models.ClientState, rules *models.ConversationRuleSet) {
+	step := rules.Steps[state.CurrentStep]
+	policy := step.Endpointing
+
+	c.mu.Lock()
+	if c.buffers == nil {
+		c.buffers = make(map[string]*answerBuffer)
+	}
+	buffer, ok := c.buffers[callID]
+	if !ok || buffer.step != state.CurrentStep {
+		if ok {
+			log.Printf("Discarding buffered fragments of step %d for %s", buffer.step, callID)
+			buffer.stopTimers()
+		}
+		buffer = &answerBuffer{step: state.CurrentStep, state: state}
+		c.buffers[callID] = buffer
+	}
+	buffer.fragments = append(buffer.fragments, *fragment)
+	buffer.version++
+	version := buffer.version
+
+	// Confirming the number the caller calls from takes a single word, which
+	// the policy for the step itself would keep waiting on.
+	if policy == nil || state.ConfirmingCallerID {
+		if !fragment.IsFinal {
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+		c.commitBuffer(ctx, callID, version, nil)
+		return
+	}
+
+	if buffer.maxWaitTimer == nil {
+		buffer.maxWaitTimer = time.AfterFunc(maxWait(policy), func() {
+			log.Printf("Max wait passed for step %d of %s, committing answer", state.CurrentStep, callID)
+			c.commitBuffer(context.Background(), callID, 0, nil)
+		})
+	}
+
+	// A new fragment means the caller is still talking, so any silence
+	// countdown starts over.
+	if buffer.silenceTimer != nil {
+		buffer.silenceTimer.Stop()
+	}
+	if policy.SilenceGap > 0 {
+		buffer.silenceTimer = time.AfterFunc(time.Duration(policy.SilenceGap)*time.Millisecond, func() {
+			c.endpoint(context.Background(), callID, version, rules, &step)
+		})
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	if fragment.IsFinal {
+		c.endpoint(ctx, callID, version, rules, &step)
+	}
+}
+
+// endpoint decides whether the buffered fragments form a complete answer and
+// commits it if so. It is a no-op when newer fragments arrived in the meantime.
+func (c *Controller) endpoint(ctx context.Context, callID string, version int, rules *models.ConversationRuleSet, step *models.ConversationStep) {
+	policy := step.Endpointing
+
+	c.mu.Lock()
+	buffer, ok := c.buffers[callID]
+	if !ok || buffer.version != version {
+		c.mu.Unlock()
+		return
+	}
+	if buffer.checking {
+		buffer.recheck = true
+		c.mu.Unlock()
+		return
+	}
+	answer := buffer.answer()
+	if wordCount(answer.Transcript) < policy.MinWords {
+		log.Printf("Answer for %s has fewer than %d words, waiting for more", step.Purpose, policy.MinWords)
+		c.mu.Unlock()
+		return
+	}
+	if !policy.AICheck {
+		c.mu.Unlock()
+		c.commitBuffer(ctx, callID, version, nil)
+		return
+	}
+	buffer.checking = true
+	c.mu.Unlock()
+
+	validated, err := c.validateAnswer(ctx, callID, buffer.state, rules, answer.Transcript, step)
+
+	c.mu.Lock()
+	buffer.checking = false
+	recheck := buffer.recheck
+	buffer.recheck = false
+	current := buffer.version
+	c.mu.Unlock()
+
+	if current != version {
+		// The caller said more while the answer was checked, what was
+		// checked is outdated
+		if recheck {
+			c.endpoint(ctx, callID, current, rules, step)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking answer completeness, committing answer: %v", err)
+		c.commitBuffer(ctx, callID, version, nil)
+		return
+	}
+	if validated.Complete != nil && !*validated.Complete {
+		log.Printf("Answer for %s is incomplete, waiting for more", step.Purpose)
+		return
+	}
+	c.commitBuffer(ctx, callID, version, validated)
+}
+
+// commitBuffer removes the buffer of the call and processes it as the single
+// answer to the step. A version of 0 commits regardless of newer fragments.
+func (c *Controller) commitBuffer(ctx context.Context, callID string, version int, validated *ai.ValidatedAnswer) {
+	c.mu.Lock()
+	buffer, ok := c.buffers[callID]
+	if !ok || (version != 0 && buffer.version != version) {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.buffers, callID)
+	buffer.stopTimers()
+	c.mu.Unlock()
+
+	answer := buffer.answer()
+	if answer.Transcript == "" {
+		log.Printf("Nothing to commit for step %d of %s", buffer.step, callID)
+		return
+	}
+	answer.Validated = validated
+	c.commitAnswer(ctx, callID, answer, buffer.state)
+}
+
+// dropBuffer forgets anything buffered for the call, e.g. when it hangs up.
+func (c *Controller) dropBuffer(callID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if buffer, ok := c.buffers[callID]; ok {
+		buffer.stopTimers()
+		delete(c.buffers, callID)
+	}
+}
@@ -0,0 +1,99 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	fakeai "goVoice/pkg/ai/fake"
+	"goVoice/pkg/audio/fake"
+	"goVoice/pkg/db/memory"
+	"testing"
+	"time"
+)
+
+func TestAnswerBufferJoinsFinalFragments(t *testing.T) {
+	buffer := &answerBuffer{fragments: []models.TranscriptFragment{
+		{Transcript: "de lantaarnpaal", Confidence: 0.8, IsFinal: true},
+		{Transcript: "bij de", Confidence: 0.3, IsFinal: false},
+		{Transcript: " bij de kerk is kapot ", Confidence: 0.6, IsFinal: true},
+	}}
+
+	answer := buffer.answer()
+	if answer.Transcript != "de lantaarnpaal bij de kerk is kapot" {
+		t.Errorf("Expected joined final fragments, got %q", answer.Transcript)
+	}
+	if answer.Confidence < 0.69 || answer.Confidence > 0.71 {
+		t.Errorf("Expected mean confidence of final fragments 0.7, got %v", answer.Confidence)
+	}
+}
+
+func TestAnswerBufferFallsBackToLatestInterim(t *testing.T) {
+	buffer := &answerBuffer{fragments: []models.TranscriptFragment{
+		{Transcript: "de lantaarn", Confidence: 0.4},
+		{Transcript: "de lantaarnpaal is kapot", Confidence: 0.5},
+	}}
+
+	answer := buffer.answer()
+	if answer.Transcript != "de lantaarnpaal is kapot" {
+		t.Errorf("Expected latest interim fragment, got %q", answer.Transcript)
+	}
+	if wordCount(answer.Transcript) != 4 {
+		t.Errorf("Expected 4 words, got %d", wordCount(answer.Transcript))
+	}
+}
+
+// endpointingController has the first step of the test rules answered with
+// the policy, and replies to validation requests with the rule.
+func endpointingController(t *testing.T, policy *models.EndpointingPolicy, rule fakeai.Rule) (*Controller, *fake.CallProvider, *models.ConversationRuleSet) {
+	t.Helper()
+	db := memory.NewClient()
+	rules := testRules()
+	rules.Simple = true
+	rules.Steps[0].Endpointing = policy
+	db.AddRuleset(context.Background(), rules)
+	db.AddConversation(context.Background(), rules.ID, &models.Conversation{ID: "call"})
+	calls := fake.NewCallProvider()
+	return &Controller{AI: fakeai.New(rule), DB: db, CallProvider: calls}, calls, rules
+}
+
+// expectNextStep waits for the answer to be committed, which moves the call
+// on to the next step.
+func expectNextStep(t *testing.T, calls *fake.CallProvider, within time.Duration) {
+	t.Helper()
+	select {
+	case event := <-calls.Events:
+		if event.State.CurrentStep != 1 {
+			t.Errorf("Expected the call to move on to step 1, got %d", event.State.CurrentStep)
+		}
+	case <-time.After(within):
+		t.Fatalf("Expected the answer to be committed within %v", within)
+	}
+}
+
+func TestHeldBackAnswerIsCommittedEventually(t *testing.T) {
+	c, calls, rules := endpointingController(t, &models.EndpointingPolicy{MinWords: 3, MaxWait: 30}, fakeai.Rule{Err: errDown})
+	state := &models.ClientState{RulesetID: rules.ID, Purpose: "melding"}
+
+	c.bufferFragment(context.Background(), "call", &models.TranscriptFragment{Transcript: "lantaarnpaal", IsFinal: true}, state, rules)
+
+	select {
+	case event := <-calls.Events:
+		t.Fatalf("Expected an answer with too few words to be held back, got %+v", event)
+	case <-time.After(10 * time.Millisecond):
+	}
+	expectNextStep(t, calls, time.Second)
+}
+
+func TestFragmentDuringCheckIsChecked(t *testing.T) {
+	complete := fakeai.Rule{Response: `{"answer": "De lantaarnpaal is kapot.", "purpose": "melding", "complete": true}`, Latency: 50 * time.Millisecond}
+	c, calls, rules := endpointingController(t, &models.EndpointingPolicy{AICheck: true, MaxWait: 10000}, complete)
+	state := &models.ClientState{RulesetID: rules.ID, Purpose: "melding"}
+
+	go c.bufferFragment(context.Background(), "call", &models.TranscriptFragment{Transcript: "de lantaarnpaal", IsFinal: true}, state, rules)
+	time.Sleep(10 * time.Millisecond)
+	// Arrives while the first fragment is being checked
+	go c.bufferFragment(context.Background(), "call", &models.TranscriptFragment{Transcript: "is kapot", IsFinal: true}, state, rules)
+
+	// Well before the max wait of 10 seconds
+	expectNextStep(t, calls, time.Second)
+	c.dropBuffer("call")
+}
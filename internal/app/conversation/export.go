@@ -0,0 +1,78 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/internal/open311"
+	"goVoice/internal/zgw"
+	"log"
+	"time"
+)
+
+// exportOpen311 files the conversation as service request with the Open311
+// endpoint of the ruleset and stores the ID it got on the conversation. When
+// that fails the conversation is marked with the failure, so the report
+// tells the backoffice to file it by hand. A conversation that is reported
+// again is only filed again when that failed the first time.
+func (c *Controller) exportOpen311(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) {
+	if rules.Open311 == nil || c.Open311 == nil || conversation.ExternalReferences[open311.System] != "" {
+		return
+	}
+	id, err := c.Open311.Export(ctx, rules.Open311, conversation)
+	if err != nil {
+		log.Printf("Error exporting %s to Open311: %v", conversation.ID, err)
+		failureCount.Add(string(FailureExport), 1)
+		conversation.Failures = append(conversation.Failures, reportFailure(FailureExport, "open311 export", err))
+		return
+	}
+	log.Printf("Exported %s to Open311 as %s", conversation.ID, id)
+	c.setExternalReference(ctx, rules, conversation, open311.System, id)
+}
+
+// exportZGW creates a zaak for the conversation in the ZGW APIs of the
+// ruleset with the transcript as document, and stores the identificatie of
+// the zaak on the conversation. A conversation that is reported again is only
+// exported again when that failed the first time.
+func (c *Controller) exportZGW(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) {
+	if rules.ZGW == nil || c.ZGW == nil || conversation.ExternalReferences[zgw.System] != "" {
+		return
+	}
+	filed := &zgw.Case{
+		Omschrijving: rules.Title,
+		Document: zgw.Document{
+			Titel:         "Transcript " + rules.Title,
+			Bestandsnaam:  conversation.ID + ".txt",
+			Inhoud:        []byte(formatTranscript(conversation, rules.Title)),
+			Formaat:       "text/plain",
+			Creatiedatum:  time.Now(),
+			Vertrouwelijk: true,
+		},
+	}
+	if summary := conversation.Summary; summary != nil {
+		filed.Omschrijving = summary.Summary
+		filed.Category = summary.Category
+		filed.Toelichting = summary.Address
+	}
+
+	identificatie, err := c.ZGW.CreateCase(ctx, rules.ZGW, filed)
+	if identificatie != "" {
+		log.Printf("Created zaak %s for %s", identificatie, conversation.ID)
+		c.setExternalReference(ctx, rules, conversation, zgw.System, identificatie)
+	}
+	if err != nil {
+		log.Printf("Error creating zaak for %s: %v", conversation.ID, err)
+		failureCount.Add(string(FailureExport), 1)
+		conversation.Failures = append(conversation.Failures, reportFailure(FailureExport, "zgw export", err))
+	}
+}
+
+func (c *Controller) setExternalReference(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation, system string, reference string) {
+	if conversation.ExternalReferences == nil {
+		conversation.ExternalReferences = make(map[string]string)
+	}
+	conversation.ExternalReferences[system] = reference
+	if err := c.DB.SetExternalReference(ctx, rules.ID, conversation.ID, system, reference); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing %s reference of %s: %v", system, conversation.ID, err)
+	}
+}
@@ -0,0 +1,188 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"goVoice/internal/models"
+	"log"
+	"time"
+)
+
+// FailureKind is the taxonomy of things that can go wrong during a call, it
+// shows up in the logs, the failures metric and the report.
+type FailureKind string
+
+const (
+	FailureAI           FailureKind = "ai_unavailable"
+	FailureDB           FailureKind = "db_unavailable"
+	FailureCallProvider FailureKind = "call_provider_error"
+	FailureExport       FailureKind = "export_failed"
+	FailureTranscribe   FailureKind = "transcription_failed"
+)
+
+var failureCount = expvar.NewMap("conversation_failures")
+
+// ConversationError wraps an error with the kind of failure and the
+// operation that failed.
+type ConversationError struct {
+	Kind      FailureKind
+	Operation string
+	Err       error
+}
+
+func (e *ConversationError) Error() string {
+	return fmt.Sprintf("%s during %s: %v", e.Kind, e.Operation, e.Err)
+}
+
+func (e *ConversationError) Unwrap() error {
+	return e.Err
+}
+
+func failure(kind FailureKind, operation string, err error) *ConversationError {
+	return &ConversationError{Kind: kind, Operation: operation, Err: err}
+}
+
+// reportFailure builds a failure marker for failures that happen after the
+// call, when there is no step to attribute them to.
+func reportFailure(kind FailureKind, operation string, err error) models.Failure {
+	return models.Failure{
+		Kind:       string(kind),
+		Operation:  operation,
+		Message:    err.Error(),
+		Step:       -1,
+		OccurredAt: time.Now(),
+	}
+}
+
+var defaultRecovery = models.RecoveryPolicy{
+	ApologyText:  "Excuses, er ging aan onze kant iets mis.",
+	RetryText:    "Wilt u uw antwoord nog een keer herhalen?",
+	MaxRetries:   1,
+	TransferText: "Ik verbind u door met een medewerker.",
+	CallbackText: "Wij bellen u zo snel mogelijk terug.",
+	GoodbyeText:  "Probeert u het later nog eens. Tot ziens.",
+}
+
+// recoveryPolicy returns the recovery policy of the ruleset with the defaults
+// filled in. rules may be nil when they could not be loaded.
+func recoveryPolicy(rules *models.ConversationRuleSet) models.RecoveryPolicy {
+	if rules == nil || rules.Recovery == nil {
+		return defaultRecovery
+	}
+	policy := *rules.Recovery
+	if policy.ApologyText == "" {
+		policy.ApologyText = defaultRecovery.ApologyText
+	}
+	if policy.RetryText == "" {
+		policy.RetryText = defaultRecovery.RetryText
+	}
+	if policy.TransferText == "" {
+		policy.TransferText = defaultRecovery.TransferText
+	}
+	if policy.CallbackText == "" {
+		policy.CallbackText = defaultRecovery.CallbackText
+	}
+	if policy.GoodbyeText == "" {
+		policy.GoodbyeText = defaultRecovery.GoodbyeText
+	}
+	return policy
+}
+
+// recordFailure logs the failure, counts it and marks it on the conversation
+// so it ends up in the report.
+func (c *Controller) recordFailure(ctx context.Context, callID string, state *models.ClientState, convErr *ConversationError) {
+	log.Printf("Conversation failure kind=%s operation=%s call=%s step=%d: %v", convErr.Kind, convErr.Operation, callID, state.CurrentStep, convErr.Err)
+	failureCount.Add(string(convErr.Kind), 1)
+
+	err := c.DB.AddFailure(ctx, state.RulesetID, callID, &models.Failure{
+		Kind:       string(convErr.Kind),
+		Operation:  convErr.Operation,
+		Message:    convErr.Err.Error(),
+		Step:       state.CurrentStep,
+		Purpose:    state.Purpose,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error marking failure on conversation %s: %v", callID, err)
+	}
+}
+
+// handleFailure records the failure and tells the caller what happened. The
+// current step is retried while the policy allows it, after that the caller
+// is transferred, offered a callback or the call is ended. rules may be nil
+// when the failure was loading them.
+func (c *Controller) handleFailure(ctx context.Context, callID string, state *models.ClientState, rules *models.ConversationRuleSet, err error) {
+	var convErr *ConversationError
+	if !errors.As(err, &convErr) {
+		convErr = failure(FailureCallProvider, "unknown", err)
+	}
+	c.recordFailure(ctx, callID, state, convErr)
+
+	policy := recoveryPolicy(rules)
+	nextState := *state
+	nextState.PendingAction = ""
+
+	if state.Retries < policy.MaxRetries {
+		nextState.Retries = state.Retries + 1
+		text := policy.ApologyText + " " + policy.RetryText
+		if rules != nil && state.CurrentStep < len(rules.Steps) {
+			text = policy.ApologyText + " " + rules.Steps[state.CurrentStep].Text
+		}
+		log.Printf("Retrying step %d of %s (attempt %d)", state.CurrentStep, callID, nextState.Retries)
+		c.speakRecovery(ctx, callID, &nextState, text)
+		return
+	}
+
+	switch {
+	case policy.TransferNumber != "":
+		nextState.PendingAction = models.PendingTransfer
+		nextState.TransferTo = policy.TransferNumber
+		c.speakRecovery(ctx, callID, &nextState, policy.ApologyText+" "+policy.TransferText)
+	case policy.OfferCallback:
+		if err := c.DB.SetCallbackRequested(ctx, state.RulesetID, callID); err != nil {
+			c.recordFailure(ctx, callID, state, failure(FailureDB, "request callback", err))
+		}
+		nextState.PendingAction = models.PendingHangup
+		c.speakRecovery(ctx, callID, &nextState, policy.ApologyText+" "+policy.CallbackText)
+	default:
+		nextState.PendingAction = models.PendingHangup
+		c.speakRecovery(ctx, callID, &nextState, policy.ApologyText+" "+policy.GoodbyeText)
+	}
+}
+
+func (c *Controller) speakRecovery(ctx context.Context, callID string, state *models.ClientState, text string) {
+	c.addTranscriptLine(callID, state.RulesetID, models.SpeakerAgent, text)
+	done, errChan := c.CallProvider.SpeakText(callID, text, state)
+	select {
+	case <-done:
+	case err := <-errChan:
+		// We can't even tell the caller, so there is nothing left but to hang up
+		c.recordFailure(ctx, callID, state, failure(FailureCallProvider, "speak", err))
+		c.CallProvider.EndCall(callID)
+	}
+}
+
+// RunPendingAction executes the action that was scheduled to run after the
+// last speech or playback ended.
+func (c *Controller) RunPendingAction(ctx context.Context, callID string, state *models.ClientState) {
+	switch state.PendingAction {
+	case models.PendingTransfer:
+		nextState := *state
+		nextState.PendingAction = ""
+		done, errChan := c.CallProvider.TransferCall(callID, state.TransferTo, &nextState)
+		select {
+		case <-done:
+			log.Printf("Transferred %s to %s", callID, state.TransferTo)
+		case err := <-errChan:
+			c.recordFailure(ctx, callID, state, failure(FailureCallProvider, "transfer", err))
+			c.CallProvider.EndCall(callID)
+		}
+	case models.PendingHangup:
+		c.CallProvider.EndCall(callID)
+	default:
+		log.Printf("Unknown pending action %q for %s", state.PendingAction, callID)
+	}
+}
@@ -0,0 +1,237 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goVoice/internal/models"
+	"log"
+	"time"
+)
+
+// The call provider records both channels of a call in a single recording
+const recordingsPerCall = 1
+
+const defaultRecordingDeadline = 2 * time.Minute
+
+const defaultReportRetryDelay = time.Minute
+
+// reportAttempts is how often a report is emailed before giving up on it
+const reportAttempts = 4
+
+// errUnreported is returned by EndConversation when it failed before the
+// report was handed to the email provider
+var errUnreported = errors.New("conversation was not reported")
+
+func (c *Controller) recordingDeadline() time.Duration {
+	if c.RecordingDeadline > 0 {
+		return c.RecordingDeadline
+	}
+	return defaultRecordingDeadline
+}
+
+func (c *Controller) reportRetryDelay() time.Duration {
+	if c.ReportRetryDelay > 0 {
+		return c.ReportRetryDelay
+	}
+	return defaultReportRetryDelay
+}
+
+// SetConversationDone marks the conversation as done once the call hung up.
+// The report is sent as soon as all recordings are in, or when the recording
+// deadline passes, whichever comes first.
+func (c *Controller) SetConversationDone(ctx context.Context, state *models.ClientState, callID string, endedAt time.Time) error {
+	c.dropBuffer(callID)
+	c.dropSpeech(callID)
+
+	err := c.DB.SetConversationDone(ctx, state.RulesetID, callID, endedAt)
+	if err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error setting conversation done: %v", err)
+		return err
+	}
+
+	rulesetID := state.RulesetID
+	c.mu.Lock()
+	if c.deadlines == nil {
+		c.deadlines = make(map[string]*time.Timer)
+	}
+	if _, ok := c.deadlines[callID]; !ok {
+		c.deadlines[callID] = time.AfterFunc(c.recordingDeadline(), func() {
+			log.Printf("Recording deadline passed for %s, reporting with what we have", callID)
+			c.finalize(context.Background(), rulesetID, callID, true)
+		})
+	}
+	c.mu.Unlock()
+
+	c.finalize(ctx, rulesetID, callID, false)
+	return nil
+}
+
+func (c *Controller) ProcessRecording(ctx context.Context, rulesetId string, callID string, recording *models.Recording) error {
+	// Set the recording on the conversation
+	err := c.DB.SetRecording(ctx, rulesetId, callID, recording)
+	if err != nil {
+		log.Printf("Error setting recordings on conversation: %v", err)
+		return err
+	}
+	c.finalize(ctx, rulesetId, callID, false)
+	return nil
+}
+
+// ProcessRecordingError notes that a recording failed, so the report doesn't
+// wait for it.
+func (c *Controller) ProcessRecordingError(ctx context.Context, rulesetID string, callID string, reason string) error {
+	err := c.DB.AddRecordingError(ctx, rulesetID, callID, reason)
+	if err != nil {
+		log.Printf("Error setting recording error on conversation: %v", err)
+		return err
+	}
+	c.finalize(ctx, rulesetID, callID, false)
+	return nil
+}
+
+// finalize sends the report of the conversation once it is done and every
+// expected recording arrived or failed. With force it doesn't wait for the
+// recordings. Only the first caller that finds the conversation ready
+// reports it, however many events race to get here.
+func (c *Controller) finalize(ctx context.Context, rulesetID string, callID string, force bool) {
+	conversation, err := c.DB.GetConversation(ctx, rulesetID, callID)
+	if err != nil {
+		log.Printf("Error getting conversation %s to finalize: %v", callID, err)
+		if !force {
+			return
+		}
+		// The deadline passed, report whatever we can without it
+	} else {
+		if !conversation.ConversationDone || conversation.Reported {
+			return
+		}
+		arrived := len(conversation.Recordings) + len(conversation.RecordingErrors)
+		if !force && arrived < conversation.ExpectedRecordings {
+			log.Printf("Waiting for %d more recordings of %s", conversation.ExpectedRecordings-arrived, callID)
+			return
+		}
+	}
+
+	claimed, err := c.DB.ClaimReport(ctx, rulesetID, callID)
+	if err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error claiming report of %s: %v", callID, err)
+		if !force {
+			return
+		}
+		claimed = true
+	}
+	if !claimed {
+		return
+	}
+
+	c.mu.Lock()
+	if timer, ok := c.deadlines[callID]; ok {
+		timer.Stop()
+		delete(c.deadlines, callID)
+	}
+	c.mu.Unlock()
+
+	if err := c.endClaimed(ctx, rulesetID, callID); err != nil {
+		log.Printf("Error ending conversation %s: %v", callID, err)
+	}
+}
+
+// Report reports a done conversation that wasn't reported yet, such as one
+// whose report couldn't be sent. It doesn't wait for missing recordings.
+func (c *Controller) Report(ctx context.Context, rulesetID string, callID string) error {
+	conversation, err := c.DB.GetConversation(ctx, rulesetID, callID)
+	if err != nil {
+		return err
+	}
+	if !conversation.ConversationDone {
+		return fmt.Errorf("conversation %s is still going on", callID)
+	}
+	claimed, err := c.DB.ClaimReport(ctx, rulesetID, callID)
+	if err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		return err
+	}
+	if !claimed {
+		return fmt.Errorf("conversation %s is already being reported", callID)
+	}
+	return c.endClaimed(ctx, rulesetID, callID)
+}
+
+// endClaimed ends the conversation the report was claimed of, and releases
+// the claim again when the report didn't get to the email provider.
+func (c *Controller) endClaimed(ctx context.Context, rulesetID string, callID string) error {
+	err := c.EndConversation(ctx, rulesetID, callID)
+	if errors.Is(err, errUnreported) {
+		c.releaseReport(ctx, rulesetID, callID)
+	}
+	return err
+}
+
+func (c *Controller) releaseReport(ctx context.Context, rulesetID string, callID string) {
+	if err := c.DB.ReleaseReport(ctx, rulesetID, callID); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error releasing report of %s: %v", callID, err)
+	}
+}
+
+// report is the email a conversation is reported with.
+type report struct {
+	to              []string
+	subject         string
+	body            string
+	attachments     [][]byte
+	attachmentNames []string
+}
+
+// sendReport emails the report and deletes the conversation once it is sent.
+// When the email fails the claim on the report is released, so the
+// conversation is listed as unreported until it is sent, and it is sent
+// again in the background with exponential backoff.
+func (c *Controller) sendReport(ctx context.Context, rulesetID string, callID string, report *report) error {
+	err := c.Email.SendEmailWithAttachment(ctx, report.to, report.subject, report.body, report.attachments, report.attachmentNames)
+	if err != nil {
+		log.Printf("Error sending email of %s, trying again in %v: %v", callID, c.reportRetryDelay(), err)
+		c.releaseReport(ctx, rulesetID, callID)
+		go c.retryReport(rulesetID, callID, report)
+		return err
+	}
+	return c.deleteReported(ctx, rulesetID, callID)
+}
+
+// retryReport emails the report again until it is sent or it runs out of
+// attempts. Every attempt claims the report again, it stops when the
+// conversation was reported some other way in the meantime.
+func (c *Controller) retryReport(rulesetID string, callID string, report *report) {
+	ctx := context.Background()
+	delay := c.reportRetryDelay()
+	for attempt := 2; attempt <= reportAttempts; attempt++ {
+		time.Sleep(delay)
+		claimed, err := c.DB.ClaimReport(ctx, rulesetID, callID)
+		if err != nil || !claimed {
+			log.Printf("Stopped sending the report of %s again, it is reported elsewhere: %v", callID, err)
+			return
+		}
+		err = c.Email.SendEmailWithAttachment(ctx, report.to, report.subject, report.body, report.attachments, report.attachmentNames)
+		if err == nil {
+			log.Printf("Sent the report of %s at attempt %d", callID, attempt)
+			c.deleteReported(ctx, rulesetID, callID)
+			return
+		}
+		log.Printf("Error sending email of %s at attempt %d: %v", callID, attempt, err)
+		c.releaseReport(ctx, rulesetID, callID)
+		delay *= 2
+	}
+	log.Printf("Giving up sending the report of %s, it is left unreported", callID)
+}
+
+func (c *Controller) deleteReported(ctx context.Context, rulesetID string, callID string) error {
+	err := c.DB.DeleteConversation(ctx, rulesetID, callID)
+	if err != nil {
+		log.Printf("Error deleting conversation from database: %v", err)
+		return err
+	}
+	return nil
+}
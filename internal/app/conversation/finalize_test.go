@@ -0,0 +1,131 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"goVoice/internal/models"
+	"goVoice/pkg/db/memory"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyEmail fails the first failures emails it is asked to send.
+type flakyEmail struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (e *flakyEmail) SendEmailWithAttachment(ctx context.Context, to []string, subject string, body string, attachments [][]byte, attachmentNames []string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.attempts++
+	if e.attempts <= e.failures {
+		return errors.New("smtp unavailable")
+	}
+	return nil
+}
+
+func (e *flakyEmail) sent() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.attempts
+}
+
+func TestSendReportRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		attempts int
+		kept     bool
+	}{
+		{"sent", 0, 1, false},
+		{"sent again", 2, 3, false},
+		{"given up", reportAttempts, reportAttempts, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewClient()
+			email := &flakyEmail{failures: tt.failures}
+			c := &Controller{DB: db, Email: email, ReportRetryDelay: time.Millisecond}
+			ctx := context.Background()
+			db.AddConversation(ctx, "afval", &models.Conversation{ID: "call"})
+			db.ClaimReport(ctx, "afval", "call")
+
+			c.sendReport(ctx, "afval", "call", &report{to: []string{"meldingen@example.com"}, subject: "Afval"})
+
+			deadline := time.Now().Add(time.Second)
+			for email.sent() < tt.attempts && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			// The last attempt is followed by deleting or releasing
+			time.Sleep(20 * time.Millisecond)
+			if email.sent() != tt.attempts {
+				t.Fatalf("Expected %d attempts, got %d", tt.attempts, email.sent())
+			}
+
+			conversation, err := db.GetConversation(ctx, "afval", "call")
+			if !tt.kept {
+				if err == nil {
+					t.Errorf("Expected the reported conversation to be deleted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected the unreported conversation to be kept: %v", err)
+			}
+			if conversation.Reported {
+				t.Errorf("Expected the claim on the report to be released")
+			}
+		})
+	}
+}
+
+func TestFinalizeReleasesUnreported(t *testing.T) {
+	db := memory.NewClient()
+	c := &Controller{DB: db, Email: &flakyEmail{}}
+	ctx := context.Background()
+	// Without its ruleset the conversation can't be reported
+	db.AddConversation(ctx, "afval", &models.Conversation{ID: "call", ConversationDone: true})
+
+	c.finalize(ctx, "afval", "call", true)
+
+	unreported, err := db.GetUnreported(ctx, "afval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unreported) != 1 || unreported[0].ID != "call" {
+		t.Errorf("Expected the conversation to be left unreported, got %v", unreported)
+	}
+}
+
+func TestReportAgain(t *testing.T) {
+	db := memory.NewClient()
+	email := &flakyEmail{failures: 1}
+	c := &Controller{DB: db, Email: email, ReportRetryDelay: time.Hour}
+	ctx := context.Background()
+	db.AddRuleset(ctx, &models.ConversationRuleSet{ID: "afval", Title: "Afval", Clients: []*models.Client{{Email: "meldingen@example.com"}}})
+	db.AddConversation(ctx, "afval", &models.Conversation{ID: "call", RulesetID: "afval", ConversationDone: true})
+
+	c.finalize(ctx, "afval", "call", true)
+	unreported, _ := db.GetUnreported(ctx, "afval")
+	if len(unreported) != 1 {
+		t.Fatalf("Expected the conversation of the failed email to be unreported, got %v", unreported)
+	}
+
+	if err := c.Report(ctx, "afval", "call"); err != nil {
+		t.Fatalf("Expected the conversation to be reported: %v", err)
+	}
+	if _, err := db.GetConversation(ctx, "afval", "call"); err == nil {
+		t.Errorf("Expected the reported conversation to be deleted")
+	}
+	if err := c.Report(ctx, "afval", "call"); err == nil {
+		t.Errorf("Expected reporting a deleted conversation to fail")
+	}
+
+	days, _ := db.GetDailyUsage(ctx, "0000-01-01", "9999-12-31")
+	if len(days) != 1 || days[0].Usage.Calls != 1 {
+		t.Errorf("Expected the call to be counted once, got %v", days)
+	}
+}
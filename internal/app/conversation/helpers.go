@@ -5,44 +5,184 @@ import (
 	"encoding/json"
 	"fmt"
 	"goVoice/internal/models"
+	"goVoice/internal/open311"
+	"goVoice/internal/prompts"
+	"goVoice/internal/redact"
+	"goVoice/internal/webhook"
+	"goVoice/internal/zgw"
 	"goVoice/pkg/ai"
+	"goVoice/pkg/ai/chat"
+	"html"
 	"log"
+	"sort"
 	"strings"
+	"time"
 )
 
-func (c *Controller) storeTranscription(ctx context.Context, callID string, state *models.ClientState, ruleSet *models.ConversationRuleSet, transcript string) {
-	log.Printf("Storing transcription: %s", transcript)
+func (c *Controller) storeTranscription(ctx context.Context, callID string, state *models.ClientState, ruleSet *models.ConversationRuleSet, transcript string, confidence float64, promptVersion string) {
+	log.Printf("Storing transcription: %s (confidence %.2f)", transcript, confidence)
 	c.DB.AddResponse(ctx, state.RulesetID, callID, &models.ConversationStepResponse{
-		Purpose:  ruleSet.Steps[state.CurrentStep].Purpose,
-		Response: transcript,
+		Purpose:       ruleSet.Steps[state.CurrentStep].Purpose,
+		Response:      transcript,
+		Confidence:    confidence,
+		PromptVersion: promptVersion,
 	})
 }
 
-func formatEmailBody(responses map[string]string, rulesetID string, rulesetTitle string, callID string) string {
+var urgencyLabels = map[string]string{
+	models.UrgencyLow:    "laag",
+	models.UrgencyNormal: "normaal",
+	models.UrgencyHigh:   "hoog",
+}
+
+var referenceLabels = map[string]string{
+	open311.System: "Open311 melding",
+	zgw.System:     "Zaak",
+}
+
+func formatEmailBody(conversation *models.Conversation, rulesetTitle string, callID string) string {
 	var sb strings.Builder
 	sb.WriteString("<table style='width: 100%; border-collapse: collapse;'>\n")
 	sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>CallID</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", callID))
+	if summary := conversation.Summary; summary != nil {
+		rows := [][2]string{
+			{"Samenvatting", summary.Summary},
+			{"Categorie", summary.Category},
+			{"Urgentie", urgencyLabels[summary.Urgency]},
+			{"Adres", summary.Address},
+		}
+		for _, row := range rows {
+			sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>%s</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", row[0], html.EscapeString(row[1])))
+		}
+	}
+	caller := nationalNumber(conversation.CallerNumber)
+	if conversation.CallerWithheld {
+		caller = "Afgeschermd nummer"
+	}
+	callRows := [][2]string{
+		{"Beller", caller},
+		{"Gebeld nummer", nationalNumber(conversation.DialedNumber)},
+	}
+	if !conversation.StartedAt.IsZero() {
+		callRows = append(callRows, [2]string{"Begin", conversation.StartedAt.Local().Format("02-01-2006 15:04:05")})
+	}
+	if !conversation.EndedAt.IsZero() {
+		callRows = append(callRows, [2]string{"Einde", conversation.EndedAt.Local().Format("02-01-2006 15:04:05")})
+	}
+	for _, row := range callRows {
+		if row[1] == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>%s</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", row[0], html.EscapeString(row[1])))
+	}
+	if conversation.Closed {
+		closed := "Gebeld buiten de openingstijden"
+		if conversation.Exception != "" {
+			closed += " (" + conversation.Exception + ")"
+		}
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #fdd;'><td style='border: 1px solid #ddd; padding: 8px;'>Gesloten</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", closed))
+	}
+	if conversation.Abandoned {
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #fdd;'><td style='border: 1px solid #ddd; padding: 8px;'>&#9888; Afgebroken</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", html.EscapeString(abandonedAt(conversation.Progress))))
+	}
+	if conversation.Language != "" {
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>Taal</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", html.EscapeString(conversation.Language)))
+	}
+	if conversation.Intent != "" {
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>Onderwerp</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", html.EscapeString(conversation.Intent)))
+	}
+	for system, reference := range conversation.ExternalReferences {
+		label, ok := referenceLabels[system]
+		if !ok {
+			label = "Referentie " + system
+		}
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>%s</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", label, html.EscapeString(reference)))
+	}
 	i := 0
-	for purpose, answer := range responses {
-			color := "#f2f2f2"
-			if i%2 == 0 {
-					color = "#ddf"
+	for purpose, answer := range conversation.Responses {
+		color := "#f2f2f2"
+		if i%2 == 0 {
+			color = "#ddf"
+		}
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: %s;'><td style='border: 1px solid #ddd; padding: 8px;'>%s</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", color, purpose, answer))
+		if correction, ok := conversation.Corrections[purpose]; ok {
+			sb.WriteString(fmt.Sprintf("<tr style='background-color: #ffd;'><td style='border: 1px solid #ddd; padding: 8px;'>%s (volgens de opname)</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", purpose, html.EscapeString(correction)))
+		}
+		i++
+	}
+	if len(conversation.RecordingTranscript) > 0 {
+		// The live transcript is only in the report to compare it with the
+		// transcript of the recording
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>Transcript</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", formatTranscriptCell(conversation.Transcript)))
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>Transcript van de opname</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", formatTranscriptCell(conversation.RecordingTranscript)))
+	}
+	if conversation.Abandoned {
+		for _, progress := range conversation.Progress {
+			if progress.Status == models.StepCompleted {
+				continue
 			}
-			sb.WriteString(fmt.Sprintf("<tr style='background-color: %s;'><td style='border: 1px solid #ddd; padding: 8px;'>%s</td><td style='border: 1px solid #ddd; padding: 8px;'>%s</td></tr>\n", color, purpose, answer))
-			i++
+			sb.WriteString(fmt.Sprintf("<tr style='background-color: #f2f2f2;'><td style='border: 1px solid #ddd; padding: 8px;'>%s</td><td style='border: 1px solid #ddd; padding: 8px;'><i>%s</i></td></tr>\n", progress.Purpose, stepStatusLabels[progress.Status]))
+		}
+	}
+	if missing := conversation.ExpectedRecordings - len(conversation.Recordings); missing > 0 {
+		reason := "niet op tijd ontvangen"
+		if len(conversation.RecordingErrors) > 0 {
+			reason = strings.Join(conversation.RecordingErrors, "; ")
+		}
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #fdd;'><td style='border: 1px solid #ddd; padding: 8px;'>&#9888; Opname ontbreekt</td><td style='border: 1px solid #ddd; padding: 8px;'>%d van de %d opnames ontbreken: %s</td></tr>\n", missing, conversation.ExpectedRecordings, html.EscapeString(reason)))
+	}
+	for _, trigger := range conversation.EmergencyTriggers {
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #fdd;'><td style='border: 1px solid #ddd; padding: 8px;'>&#9888; Spoed (%s)</td><td style='border: 1px solid #ddd; padding: 8px;'>%s: &quot;%s&quot; in &quot;%s&quot;</td></tr>\n", trigger.Source, trigger.OccurredAt.Format("15:04:05"), html.EscapeString(trigger.Match), html.EscapeString(trigger.Transcript)))
+	}
+	for _, failure := range conversation.Failures {
+		sb.WriteString(fmt.Sprintf("<tr style='background-color: #fdd;'><td style='border: 1px solid #ddd; padding: 8px;'>&#9888; Fout (%s)</td><td style='border: 1px solid #ddd; padding: 8px;'>%s bij %s: %s</td></tr>\n", failure.Kind, failure.OccurredAt.Format("15:04:05"), html.EscapeString(failure.Operation), html.EscapeString(failure.Message)))
+	}
+	if conversation.CallbackRequested {
+		sb.WriteString("<tr style='background-color: #fdd;'><td style='border: 1px solid #ddd; padding: 8px;'>Terugbellen</td><td style='border: 1px solid #ddd; padding: 8px;'>Er is de beller beloofd dat we terugbellen</td></tr>\n")
 	}
 	sb.WriteString("</table>")
 	return sb.String()
 }
 
-func (c *Controller) validateAnswer(answer string, step *models.ConversationStep) (*ai.ValidatedAnswer, error) {
-	system := `You are a questionaire validator who is given answers in Dutch (quite possibly with a Frisian dialect) in the following format
-		{ question: <question>, purpose: <purpose>, answer: <answer> }. The answers are transscribed from audio and might be incorrectly transcribed.
-		Also they might be incomplete as the user is taking a short pause.
-		I want you to try and interpret the answer in relation to the question and correct them where possible. Then I want you to 
-		give an estimate if the answer is complete or not. Return this in the following json format:
-		{purpose: <purpose>, answer: <answer>, <complete>: <true/false>} without any padding or fluff so I can
-		directly use it in my system. It's essential that you respond in the json format I have given you.`
+// ValidateAnswer validates the answer to the step the way it is during a
+// call, so prompts and models can be evaluated outside of calls.
+func (c *Controller) ValidateAnswer(ctx context.Context, callID string, state *models.ClientState, rules *models.ConversationRuleSet, answer string, step *models.ConversationStep) (*ai.ValidatedAnswer, error) {
+	return c.validateAnswer(ctx, callID, state, rules, answer, step)
+}
+
+// validateAnswer has the AI provider correct the transcribed answer and tell
+// whether it is complete, with the validation prompt of the ruleset or else
+// the default one.
+func (c *Controller) validateAnswer(ctx context.Context, callID string, state *models.ClientState, rules *models.ConversationRuleSet, answer string, step *models.ConversationStep) (*ai.ValidatedAnswer, error) {
+	prompt := rules.ValidationPrompt
+	if prompt == nil {
+		prompt = prompts.Default
+	}
+	data := prompts.Data{
+		Question: step.Text,
+		Purpose:  step.Purpose,
+		Locale:   state.Language,
+		Language: languageName(state.Language),
+	}
+	if data.Locale == "" {
+		data.Locale = rulesetLanguage(rules)
+	}
+	if rules.ValidationPrompt != nil {
+		// The default prompt doesn't use the answers, so they are only read
+		// for the prompt of the ruleset
+		conversation, err := c.DB.GetConversation(ctx, state.RulesetID, callID)
+		if err != nil {
+			failureCount.Add(string(FailureDB), 1)
+			log.Printf("Error getting answers of %s for the validation prompt: %v", callID, err)
+		} else {
+			data.Answers = conversation.Responses
+		}
+	}
+	system, err := prompts.Render(prompt, data)
+	if err != nil {
+		log.Printf("Error rendering validation prompt: %v", err)
+		return nil, err
+	}
 
 	question := ai.ValidatedAnswer{
 		Question: step.Text,
@@ -55,10 +195,11 @@ func (c *Controller) validateAnswer(answer string, step *models.ConversationStep
 		return nil, err
 	}
 
-	reply, err := c.AI.GetSimpleChatCompletion(system, string(questionJSON))
+	reply, err := c.completeJSON(ctx, callID, rules, system, string(questionJSON))
 	if err != nil {
 		log.Printf("Error getting reply from AI: %v", err)
-		return nil, err
+		failureCount.Add(string(FailureAI), 1)
+		return nil, failure(FailureAI, "validate answer", err)
 	}
 
 	validatedAnswer := ai.ValidatedAnswer{}
@@ -67,32 +208,198 @@ func (c *Controller) validateAnswer(answer string, step *models.ConversationStep
 		log.Printf("Error unmarshaling validated answer: %v", err)
 		return nil, err
 	}
+	validatedAnswer.PromptVersion = prompts.Version(prompt)
 
 	return &validatedAnswer, nil
 }
 
+// completeJSON asks the AI provider of the ruleset to answer the text
+// following the system prompt, with a json reply.
+func (c *Controller) completeJSON(ctx context.Context, callID string, rules *models.ConversationRuleSet, system string, text string) (string, error) {
+	response, err := c.complete(ctx, callID, rules, &chat.Request{
+		Messages:       chat.Prompt(system, text),
+		ResponseFormat: chat.JSONObject,
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.Content, nil
+}
+
+// complete sends the request to the AI provider of the ruleset and records
+// the tokens it used on the call. The personal data the ruleset redacts is
+// withheld from the provider and restored in the reply.
+func (c *Controller) complete(ctx context.Context, callID string, rules *models.ConversationRuleSet, request *chat.Request) (*chat.Response, error) {
+	redactor := redact.New(rules.Redact)
+	request = redactRequest(redactor, forRuleset(rules, request))
+	response, err := c.AI.GetChatCompletion(ctx, request)
+	c.auditRedactions(ctx, callID, rules, redactor)
+	if err != nil {
+		return nil, err
+	}
+	restoreResponse(redactor, response)
+	c.recordTokens(ctx, callID, rules, request, response)
+	return response, nil
+}
+
+// forRuleset sends the request to the AI provider and model the ruleset
+// picked, if any.
+func forRuleset(rules *models.ConversationRuleSet, request *chat.Request) *chat.Request {
+	if rules.AI != nil {
+		request.Provider = rules.AI.Provider
+		request.Model = rules.AI.Model
+	}
+	return request
+}
+
 func (c *Controller) broadcastNextStep(conversationID string, state *models.ClientState, step *models.ConversationStep) (chan bool, chan error) {
 	log.Println("Broadcasting next step")
-	var doneChan chan bool
-	var errChan chan error
+	if err := c.DB.SetCurrentStep(context.Background(), state.RulesetID, conversationID, state.CurrentStep, state.TotalSteps); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing current step of %s: %v", conversationID, err)
+	}
+	if step.UseCallerID && state.CallerNumber != "" && !state.CallerIDDeclined {
+		state.ConfirmingCallerID = true
+		text := callerIDQuestion(step, state.CallerNumber)
+		return c.unlessEscalated(conversationID, func() (chan bool, chan error) {
+			c.addTranscriptLine(conversationID, state.RulesetID, models.SpeakerAgent, text)
+			return c.CallProvider.SpeakText(conversationID, text, state)
+		})
+	}
 	if step.AudioURL != "" {
-		c.CallProvider.PlayAudioUrl(conversationID, step, state)
-	} else if step.Prompt != nil {
-		// TODO: implement speak from prompt
+		return c.unlessEscalated(conversationID, func() (chan bool, chan error) {
+			c.addTranscriptLine(conversationID, state.RulesetID, models.SpeakerAgent, step.Text)
+			return c.CallProvider.PlayAudioUrl(conversationID, step, state)
+		})
+	}
+	text := c.speakableText(context.Background(), conversationID, state, step)
+	return c.unlessEscalated(conversationID, func() (chan bool, chan error) {
+		c.addTranscriptLine(conversationID, state.RulesetID, models.SpeakerAgent, text)
+		return c.CallProvider.SpeakText(conversationID, text, state)
+	})
+}
+
+func (c *Controller) validateAndStoreAnswer(ctx context.Context, answer *bufferedAnswer, callID string, state *models.ClientState, rules *models.ConversationRuleSet) {
+	if answer.Validated != nil {
+		log.Println("Answer was validated while endpointing, storing validated answer")
+		c.storeTranscription(ctx, callID, state, rules, answer.Validated.Answer, answer.Confidence, answer.Validated.PromptVersion)
+		return
+	}
+	validatedAnswer, err := c.validateAnswer(ctx, callID, state, rules, answer.Transcript, &rules.Steps[state.CurrentStep])
+	if err != nil {
+		log.Printf("Error validating answer, storing transcript: %v", err)
+		c.storeTranscription(ctx, callID, state, rules, answer.Transcript, answer.Confidence, "")
 	} else {
-		c.CallProvider.SpeakText(conversationID, step.Text, state)
+		log.Println("Validating succesful, storing validated answer")
+		c.storeTranscription(ctx, callID, state, rules, validatedAnswer.Answer, answer.Confidence, validatedAnswer.PromptVersion)
+	}
+}
+
+// callResult is what the webhooks of the ruleset receive about the call.
+func callResult(rules *models.ConversationRuleSet, conversation *models.Conversation) *models.CallResult {
+	recordings := make([]string, 0, len(conversation.Recordings))
+	for _, recording := range conversation.Recordings {
+		recordings = append(recordings, recording.Url)
+	}
+	answers := conversation.Responses
+	if answers == nil {
+		answers = map[string]string{}
 	}
+	return &models.CallResult{
+		Event:              webhook.EventCallCompleted,
+		ConversationID:     conversation.ID,
+		RulesetID:          rules.ID,
+		Title:              rules.Title,
+		Answers:            answers,
+		Confidences:        conversation.Confidences,
+		Intent:             conversation.Intent,
+		Language:           conversation.Language,
+		Urgent:             conversation.Urgent,
+		Summary:            conversation.Summary,
+		Recordings:         recordings,
+		CallbackRequested:  conversation.CallbackRequested,
+		Abandoned:          conversation.Abandoned,
+		Progress:           conversation.Progress,
+		Failures:           conversation.Failures,
+		ExternalReferences: conversation.ExternalReferences,
+		CallerNumber:       conversation.CallerNumber,
+		CallerWithheld:     conversation.CallerWithheld,
+		DialedNumber:       conversation.DialedNumber,
+		Direction:          conversation.Direction,
+		StartedAt:          conversation.StartedAt,
+		EndedAt:            conversation.EndedAt,
+		Closed:             conversation.Closed,
+		PromptVersions:     conversation.PromptVersions,
+		Usage:              conversation.Usage,
+		Redactions:         conversation.Redactions,
+		Corrections:        conversation.Corrections,
+		ReportedAt:         time.Now(),
+	}
+}
 
-	return doneChan, errChan
+// addTranscriptLine records what was said on the conversation. It is stored
+// in the background so it doesn't hold up the call, the lines are put in
+// order by their time when the transcript is read.
+func (c *Controller) addTranscriptLine(callID string, rulesetID string, speaker string, text string) {
+	line := &models.TranscriptLine{Speaker: speaker, Text: text, At: time.Now()}
+	go func() {
+		if err := c.DB.AddTranscriptLine(context.Background(), rulesetID, callID, line); err != nil {
+			failureCount.Add(string(FailureDB), 1)
+			log.Printf("Error storing transcript line of %s: %v", callID, err)
+		}
+	}()
 }
 
-func (c *Controller) validateAndStoreAnswer(ctx context.Context, transcript string, callID string, state *models.ClientState, rules *models.ConversationRuleSet) {
-	validatedAnswer, err := c.validateAnswer(transcript, &rules.Steps[state.CurrentStep])
-		if err != nil {
-			log.Printf("Error validating answer, storing transcript: %v", err)
-			c.storeTranscription(ctx, callID, state, rules, transcript)
-		} else {
-			log.Println("Validating succesful, storing validated answer")
-			c.storeTranscription(ctx, callID, state, rules, validatedAnswer.Answer)
+var speakerLabels = map[string]string{
+	models.SpeakerAgent:   "Assistent",
+	models.SpeakerCaller:  "Beller",
+	models.SpeakerUnknown: "Onbekend",
+}
+
+// formatTranscript writes the conversation as plain text, to be filed with
+// the systems it is exported to.
+func formatTranscript(conversation *models.Conversation, rulesetTitle string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Gesprek %s met %s\n", conversation.ID, rulesetTitle))
+	if summary := conversation.Summary; summary != nil {
+		sb.WriteString(fmt.Sprintf("Samenvatting: %s\n", summary.Summary))
+	}
+
+	sb.WriteString("\nAntwoorden\n")
+	purposes := make([]string, 0, len(conversation.Responses))
+	for purpose := range conversation.Responses {
+		purposes = append(purposes, purpose)
+	}
+	sort.Strings(purposes)
+	for _, purpose := range purposes {
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", purpose, conversation.Responses[purpose]))
+		if correction, ok := conversation.Corrections[purpose]; ok {
+			sb.WriteString(fmt.Sprintf("  volgens de opname: %s\n", correction))
 		}
-}
\ No newline at end of file
+	}
+
+	sb.WriteString("\nTranscript\n")
+	for _, line := range sortedLines(conversation.Transcript) {
+		sb.WriteString(formatLine(line) + "\n")
+	}
+	if len(conversation.RecordingTranscript) > 0 {
+		sb.WriteString("\nTranscript van de opname\n")
+		for _, line := range sortedLines(conversation.RecordingTranscript) {
+			sb.WriteString(formatLine(line) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func formatLine(line models.TranscriptLine) string {
+	return fmt.Sprintf("[%s] %s: %s", line.At.Format("15:04:05"), speakerLabels[line.Speaker], line.Text)
+}
+
+// formatTranscriptCell writes the lines for a cell of the report.
+func formatTranscriptCell(lines []models.TranscriptLine) string {
+	formatted := make([]string, 0, len(lines))
+	for _, line := range sortedLines(lines) {
+		formatted = append(formatted, html.EscapeString(formatLine(line)))
+	}
+	return strings.Join(formatted, "<br>")
+}
@@ -0,0 +1,130 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"goVoice/internal/models"
+	fakeai "goVoice/pkg/ai/fake"
+	"goVoice/pkg/audio/fake"
+	"goVoice/pkg/db/memory"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("down")
+
+func testRules() *models.ConversationRuleSet {
+	return &models.ConversationRuleSet{
+		ID:    "lantaarnpalen",
+		Title: "Lantaarnpalen",
+		Steps: []models.ConversationStep{
+			{Text: "Wat wilt u melden?", Purpose: "melding"},
+			{Text: "Waar staat de lantaarnpaal?", Purpose: "adres"},
+			{Text: "Dank u wel, tot ziens.", Purpose: "afsluiting"},
+		},
+	}
+}
+
+func TestValidateAndStoreAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     fakeai.Rule
+		stored   string
+		version  string
+		aiFailed bool
+	}{
+		{
+			"validated",
+			fakeai.Rule{Response: `{"answer": "De lantaarnpaal is kapot.", "purpose": "melding", "complete": true}`},
+			"De lantaarnpaal is kapot.", "default-1", false,
+		},
+		{"malformed json", fakeai.Rule{Response: `{"answer": "De lantaarn`}, "de lantaarnpaal is kapot", "", false},
+		{"provider down", fakeai.Rule{Err: errDown}, "de lantaarnpaal is kapot", "", true},
+		{"provider too slow", fakeai.Rule{Latency: time.Second}, "de lantaarnpaal is kapot", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := memory.NewClient()
+			rules := testRules()
+			db.AddConversation(context.Background(), rules.ID, &models.Conversation{ID: "call"})
+			provider := fakeai.New(test.rule)
+			c := &Controller{AI: provider, DB: db}
+			state := &models.ClientState{RulesetID: rules.ID, Purpose: "melding"}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := c.validateAnswer(ctx, "call", state, rules, "de lantaarnpaal is kapot", &rules.Steps[0])
+			var convErr *ConversationError
+			if aiFailed := errors.As(err, &convErr) && convErr.Kind == FailureAI; aiFailed != test.aiFailed {
+				t.Errorf("Expected an AI failure %v, got %v", test.aiFailed, err)
+			}
+
+			c.validateAndStoreAnswer(ctx, &bufferedAnswer{Transcript: "de lantaarnpaal is kapot", Confidence: 0.9}, "call", state, rules)
+			conversation, _ := db.GetConversation(context.Background(), rules.ID, "call")
+			if answer := conversation.Responses["melding"]; answer != test.stored {
+				t.Errorf("Expected %q to be stored, got %q", test.stored, answer)
+			}
+			if version := conversation.PromptVersions["melding"]; version != test.version {
+				t.Errorf("Expected prompt version %q, got %q", test.version, version)
+			}
+			if requests := provider.Requests(); len(requests) != 2 {
+				t.Errorf("Expected two validation requests, got %d", len(requests))
+			}
+		})
+	}
+}
+
+func TestCommitAnswer(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []fakeai.Rule
+		spoken string
+	}{
+		{
+			"dialogue",
+			[]fakeai.Rule{
+				{Pattern: `"answer":`, Response: `{"answer": "De lantaarnpaal is kapot.", "purpose": "melding", "complete": true}`},
+				{Pattern: `kapot`, Response: `{"text": "Vervelend! Waar staat de lantaarnpaal?"}`},
+			},
+			"Vervelend! Waar staat de lantaarnpaal?",
+		},
+		{"malformed json", []fakeai.Rule{{Response: `{"text": "Verve`}}, "Waar staat de lantaarnpaal?"},
+		{"provider down", []fakeai.Rule{{Err: errDown}}, "Waar staat de lantaarnpaal?"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := memory.NewClient()
+			rules := testRules()
+			db.AddRuleset(context.Background(), rules)
+			db.AddConversation(context.Background(), rules.ID, &models.Conversation{ID: "call"})
+			calls := fake.NewCallProvider()
+			c := &Controller{AI: fakeai.New(test.rules...), DB: db, CallProvider: calls}
+			state := &models.ClientState{RulesetID: rules.ID, TotalSteps: len(rules.Steps), Purpose: "melding"}
+
+			c.commitAnswer(context.Background(), "call", &bufferedAnswer{Transcript: "de lantaarnpaal is kapot", Confidence: 0.9}, state)
+
+			select {
+			case event := <-calls.Events:
+				if event.Kind != fake.EventSpeak || event.Text != test.spoken {
+					t.Errorf("Expected %q to be spoken, got %s %q", test.spoken, event.Kind, event.Text)
+				}
+				if event.State.CurrentStep != 1 {
+					t.Errorf("Expected the call to move on to step 1, got %d", event.State.CurrentStep)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected the next step to be spoken")
+			}
+		})
+	}
+}
+
+func TestEmailBodyEscapesConversation(t *testing.T) {
+	conversation := &models.Conversation{ID: "call", Language: "<script>en</script>", Intent: "<script>afval</script>"}
+
+	body := formatEmailBody(conversation, "Lantaarnpalen", "call")
+
+	if strings.Contains(body, "<script>") {
+		t.Errorf("Expected the language and intent to be escaped, got %s", body)
+	}
+}
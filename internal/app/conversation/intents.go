@@ -0,0 +1,118 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goVoice/internal/models"
+	"log"
+	"strings"
+)
+
+type intentOption struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Examples    []string `json:"examples,omitempty"`
+}
+
+type classifiedIntent struct {
+	Intent string `json:"intent"`
+}
+
+// findIntent returns the intent with the given name, or nil.
+func findIntent(rules *models.ConversationRuleSet, name string) *models.Intent {
+	for i := range rules.Intents {
+		if rules.Intents[i].Name == name {
+			return &rules.Intents[i]
+		}
+	}
+	return nil
+}
+
+// resolveFlow returns a copy of the ruleset in the language of the caller
+// whose steps are the opener followed by the steps of the intent the caller
+// was routed into. Without an intent, or one the ruleset doesn't know, the
+// steps of the ruleset are kept. Calls while the line is closed get the
+// closed steps instead.
+func resolveFlow(rules *models.ConversationRuleSet, state *models.ClientState) *models.ConversationRuleSet {
+	if state.Closed && rules.Schedule != nil {
+		return closedFlow(rules, state)
+	}
+	rules = resolveLanguage(rules, state)
+	if state.Intent == "" || len(rules.Steps) == 0 {
+		return rules
+	}
+	intent := findIntent(rules, state.Intent)
+	if intent == nil || len(intent.Steps) == 0 {
+		return rules
+	}
+	resolved := *rules
+	resolved.Steps = append([]models.ConversationStep{rules.Steps[0]}, intent.Steps...)
+	return &resolved
+}
+
+// rulesFor returns the ruleset of the call with the steps of its flow.
+func (c *Controller) rulesFor(state *models.ClientState) (*models.ConversationRuleSet, error) {
+	rules, err := c.getRules(state.RulesetID)
+	if err != nil {
+		return rules, err
+	}
+	return resolveFlow(rules, state), nil
+}
+
+// detectIntent classifies the answer to the opener into one of the intents
+// of the ruleset and records it on the conversation. Anything that can't be
+// classified ends up as models.IntentOther.
+func (c *Controller) detectIntent(ctx context.Context, callID string, rules *models.ConversationRuleSet, transcript string) string {
+	intent, err := c.classifyIntent(ctx, callID, rules, transcript)
+	if err != nil {
+		log.Printf("Error classifying intent for %s, using %s: %v", callID, models.IntentOther, err)
+		intent = models.IntentOther
+	}
+	log.Printf("Intent of %s is %s", callID, intent)
+
+	if err := c.DB.SetIntent(ctx, rules.ID, callID, intent); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing intent of %s: %v", callID, err)
+	}
+	return intent
+}
+
+func (c *Controller) classifyIntent(ctx context.Context, callID string, rules *models.ConversationRuleSet, transcript string) (string, error) {
+	var options []intentOption
+	for _, intent := range rules.Intents {
+		options = append(options, intentOption{
+			Name:        intent.Name,
+			Description: intent.Description,
+			Examples:    intent.Examples,
+		})
+	}
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		log.Printf("Error marshaling intents to JSON: %v", err)
+		return "", err
+	}
+
+	system := fmt.Sprintf(`You classify what callers of the %s phone line are calling about. The possible intents
+		are given in the following json format [{name: <name>, description: <description>, examples: [<example phrases>]}]:
+		%s
+		You are given a transcription of what the caller said, which might be incorrectly transcribed. Pick the intent that
+		matches best or "%s" if none of them match. Return it in the following json format: {"intent": <name>}
+		without any padding or fluff.`, rules.Title, optionsJSON, models.IntentOther)
+
+	reply, err := c.completeJSON(ctx, callID, rules, system, transcript)
+	if err != nil {
+		failureCount.Add(string(FailureAI), 1)
+		return "", failure(FailureAI, "classify intent", err)
+	}
+
+	var classified classifiedIntent
+	if err := json.Unmarshal([]byte(reply), &classified); err != nil {
+		return "", fmt.Errorf("error unmarshaling classified intent: %w", err)
+	}
+	name := strings.TrimSpace(classified.Intent)
+	if findIntent(rules, name) == nil {
+		return models.IntentOther, nil
+	}
+	return name, nil
+}
@@ -0,0 +1,46 @@
+package conversation
+
+import (
+	"goVoice/internal/models"
+	"testing"
+)
+
+func TestResolveFlow(t *testing.T) {
+	rules := &models.ConversationRuleSet{
+		Steps: []models.ConversationStep{{Purpose: "melding"}, {Purpose: "locatie"}, {Purpose: "naam"}},
+		Intents: []models.Intent{
+			{Name: "afval", Steps: []models.ConversationStep{{Purpose: "container"}, {Purpose: "adres"}}},
+			{Name: models.IntentOther},
+		},
+	}
+
+	tests := []struct {
+		intent   string
+		expected []string
+	}{
+		{"", []string{"melding", "locatie", "naam"}},
+		{"afval", []string{"melding", "container", "adres"}},
+		{models.IntentOther, []string{"melding", "locatie", "naam"}},
+		{"onbekend", []string{"melding", "locatie", "naam"}},
+	}
+
+	for _, test := range tests {
+		resolved := resolveFlow(rules, &models.ClientState{Intent: test.intent})
+		var purposes []string
+		for _, step := range resolved.Steps {
+			purposes = append(purposes, step.Purpose)
+		}
+		if len(purposes) != len(test.expected) {
+			t.Fatalf("Intent %q: expected steps %v, got %v", test.intent, test.expected, purposes)
+		}
+		for i := range purposes {
+			if purposes[i] != test.expected[i] {
+				t.Errorf("Intent %q: expected steps %v, got %v", test.intent, test.expected, purposes)
+				break
+			}
+		}
+	}
+	if len(rules.Steps) != 3 {
+		t.Errorf("Expected the steps of the ruleset itself to be left alone, got %d steps", len(rules.Steps))
+	}
+}
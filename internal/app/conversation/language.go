@@ -0,0 +1,145 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goVoice/internal/models"
+	"log"
+	"strings"
+)
+
+const defaultLanguage = "nl"
+
+// languageNames describes the languages we expect callers to speak to the AI.
+var languageNames = map[string]string{
+	"nl": "Dutch (quite possibly with a Frisian dialect)",
+	"fy": "Frisian",
+	"en": "English",
+	"de": "German",
+	"pl": "Polish",
+	"fr": "French",
+	"es": "Spanish",
+	"tr": "Turkish",
+	"ar": "Arabic",
+}
+
+func languageName(language string) string {
+	if name, ok := languageNames[language]; ok {
+		return name
+	}
+	if language == "" {
+		return languageNames[defaultLanguage]
+	}
+	return language
+}
+
+func rulesetLanguage(rules *models.ConversationRuleSet) string {
+	if rules.Language != "" {
+		return rules.Language
+	}
+	return defaultLanguage
+}
+
+func findTranslation(rules *models.ConversationRuleSet, language string) *models.Translation {
+	for i := range rules.Translations {
+		if rules.Translations[i].Language == language {
+			return &rules.Translations[i]
+		}
+	}
+	return nil
+}
+
+// resolveLanguage returns a copy of the ruleset with the steps, intents and
+// voice of the translation in the language of the caller.
+func resolveLanguage(rules *models.ConversationRuleSet, state *models.ClientState) *models.ConversationRuleSet {
+	if state.Language == "" || state.Language == rulesetLanguage(rules) {
+		return rules
+	}
+	translation := findTranslation(rules, state.Language)
+	if translation == nil || len(translation.Steps) != len(rules.Steps) {
+		return rules
+	}
+
+	resolved := *rules
+	resolved.Language = translation.Language
+	resolved.Steps = translation.Steps
+	if translation.Voice != "" {
+		resolved.Voice = translation.Voice
+	}
+	resolved.Intents = make([]models.Intent, len(rules.Intents))
+	copy(resolved.Intents, rules.Intents)
+	for i, intent := range resolved.Intents {
+		for _, translated := range translation.Intents {
+			if translated.Name == intent.Name && len(translated.Steps) > 0 {
+				resolved.Intents[i].Steps = translated.Steps
+			}
+		}
+	}
+	return &resolved
+}
+
+type detectedLanguage struct {
+	Language string `json:"language"`
+}
+
+// detectLanguage has the AI determine the language the caller speaks.
+func (c *Controller) detectLanguage(ctx context.Context, callID string, rules *models.ConversationRuleSet, answer *bufferedAnswer) (string, error) {
+	system := `You detect the language callers of a phone line speak. You are given a transcription of what the
+		caller said, which was made by a speech-to-text engine expecting ` + languageName(rulesetLanguage(rules)) + `
+		so it might be garbled. Return the ISO 639-1 code of the language the caller most likely speaks in the following
+		json format: {"language": <code>} without any padding or fluff.`
+
+	reply, err := c.completeJSON(ctx, callID, rules, system, answer.Transcript)
+	if err != nil {
+		failureCount.Add(string(FailureAI), 1)
+		return "", failure(FailureAI, "detect language", err)
+	}
+	var detected detectedLanguage
+	if err := json.Unmarshal([]byte(reply), &detected); err != nil {
+		return "", fmt.Errorf("error unmarshaling detected language: %w", err)
+	}
+	language := strings.ToLower(strings.TrimSpace(detected.Language))
+	if len(language) != 2 {
+		return "", fmt.Errorf("unexpected language code %q", detected.Language)
+	}
+	return language, nil
+}
+
+// switchLanguage detects the language of the first answer of the caller and
+// records it. It returns the client state in that language, and whether the
+// call switched to a translation, in which case the opener is asked again in
+// the new language.
+func (c *Controller) switchLanguage(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, answer *bufferedAnswer) (*models.ClientState, bool) {
+	switched := *state
+	switched.Language = rulesetLanguage(rules)
+
+	language, err := c.detectLanguage(ctx, callID, rules, answer)
+	if err != nil {
+		log.Printf("Error detecting language of %s, keeping %s: %v", callID, switched.Language, err)
+	} else if language != switched.Language && findTranslation(rules, language) != nil {
+		switched.Language = language
+	} else if language != switched.Language {
+		log.Printf("Caller of %s speaks %s but there is no translation, keeping %s", callID, language, switched.Language)
+	}
+
+	if err := c.DB.SetLanguage(ctx, state.RulesetID, callID, switched.Language); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing language of %s: %v", callID, err)
+	}
+	if switched.Language == rulesetLanguage(rules) {
+		return &switched, false
+	}
+
+	log.Printf("Switching %s to %s", callID, switched.Language)
+	translated := resolveLanguage(rules, &switched)
+	switched.Voice = translated.Voice
+	switched.TotalSteps = len(translated.Steps)
+	done, errChan := c.CallProvider.SetTranscriptionLanguage(callID, &switched)
+	select {
+	case <-done:
+	case err := <-errChan:
+		c.recordFailure(ctx, callID, &switched, failure(FailureCallProvider, "switch transcription language", err))
+	}
+	return &switched, true
+}
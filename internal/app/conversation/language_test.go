@@ -0,0 +1,40 @@
+package conversation
+
+import (
+	"goVoice/internal/models"
+	"testing"
+)
+
+func TestResolveLanguage(t *testing.T) {
+	rules := &models.ConversationRuleSet{
+		Voice: "male",
+		Steps: []models.ConversationStep{{Text: "Wat is uw melding?"}, {Text: "Waar is het?"}},
+		Intents: []models.Intent{
+			{Name: "afval", Steps: []models.ConversationStep{{Text: "Welke container?"}}},
+		},
+		Translations: []models.Translation{{
+			Language: "en",
+			Voice:    "female",
+			Steps:    []models.ConversationStep{{Text: "What would you like to report?"}, {Text: "Where is it?"}},
+			Intents: []models.Intent{
+				{Name: "afval", Steps: []models.ConversationStep{{Text: "Which container?"}}},
+			},
+		}},
+	}
+
+	resolved := resolveFlow(rules, &models.ClientState{Language: "en", Intent: "afval"})
+	if resolved.Steps[0].Text != "What would you like to report?" || resolved.Steps[1].Text != "Which container?" {
+		t.Errorf("Expected the translated opener and intent steps, got %+v", resolved.Steps)
+	}
+	if resolved.Voice != "female" {
+		t.Errorf("Expected the voice of the translation, got %s", resolved.Voice)
+	}
+	if rules.Intents[0].Steps[0].Text != "Welke container?" {
+		t.Errorf("Expected the intents of the ruleset itself to be left alone")
+	}
+
+	untranslated := resolveFlow(rules, &models.ClientState{Language: "pl"})
+	if untranslated.Steps[0].Text != "Wat is uw melding?" {
+		t.Errorf("Expected the ruleset steps without a translation, got %+v", untranslated.Steps)
+	}
+}
@@ -0,0 +1,143 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"goVoice/internal/models"
+	"log"
+	"time"
+)
+
+var stepStatusLabels = map[string]string{
+	models.StepCompleted:  "beantwoord",
+	models.StepSkipped:    "overgeslagen",
+	models.StepNotReached: "niet bereikt",
+}
+
+// asksQuestion tells whether the caller is expected to answer the step. Steps
+// without a purpose, like the goodbye, only tell the caller something.
+func asksQuestion(step *models.ConversationStep) bool {
+	return step.Purpose != "" && step.Purpose != "none"
+}
+
+// stepProgress tells for every question of the flow whether the caller
+// answered it, got past it without an answer, or never got to it. The step
+// the caller was asked last counts as skipped when it wasn't answered.
+func stepProgress(rules *models.ConversationRuleSet, conversation *models.Conversation) []models.StepProgress {
+	var progress []models.StepProgress
+	for i := range rules.Steps {
+		step := &rules.Steps[i]
+		if !asksQuestion(step) {
+			continue
+		}
+		status := models.StepNotReached
+		if _, ok := conversation.Responses[step.Purpose]; ok {
+			status = models.StepCompleted
+		} else if i <= conversation.CurrentStep {
+			status = models.StepSkipped
+		}
+		progress = append(progress, models.StepProgress{Step: i, Purpose: step.Purpose, Status: status})
+	}
+	return progress
+}
+
+// isAbandoned tells whether the caller hung up before the final step. Calls
+// the agent ended itself, for an emergency or after failures, aren't.
+func isAbandoned(rules *models.ConversationRuleSet, conversation *models.Conversation) bool {
+	if conversation.Urgent || len(conversation.Failures) > 0 || conversation.CallbackRequested {
+		return false
+	}
+	return conversation.CurrentStep < len(rules.Steps)-1
+}
+
+// abandonedAt describes the step the caller hung up at.
+func abandonedAt(progress []models.StepProgress) string {
+	for _, p := range progress {
+		if p.Status == models.StepSkipped {
+			return fmt.Sprintf("De beller heeft opgehangen bij stap %d (%s)", p.Step+1, p.Purpose)
+		}
+	}
+	return "De beller heeft opgehangen voor het einde van het gesprek"
+}
+
+// partialAction decides what happens to an abandoned call following the
+// completeness rule of the ruleset. Without a rule everything is reported.
+func partialAction(rules *models.ConversationRuleSet, conversation *models.Conversation) string {
+	rule := rules.Completeness
+	if rule == nil {
+		return models.PartialReport
+	}
+
+	complete := len(conversation.Responses) >= rule.MinAnswered
+	for _, purpose := range rule.Required {
+		if _, ok := conversation.Responses[purpose]; !ok {
+			complete = false
+		}
+	}
+	if complete {
+		return models.PartialReport
+	}
+
+	switch rule.BelowMinimum {
+	case models.PartialArchive, models.PartialCallback:
+		return rule.BelowMinimum
+	default:
+		return models.PartialReport
+	}
+}
+
+// lastReached returns the purpose of the step the caller hung up at.
+func lastReached(progress []models.StepProgress) string {
+	for _, p := range progress {
+		if p.Status == models.StepSkipped {
+			return p.Purpose
+		}
+	}
+	return ""
+}
+
+// handlePartial marks an abandoned conversation with how far the caller got
+// and archives it or queues a callback when the ruleset says so. It returns
+// whether the conversation should still be reported.
+func (c *Controller) handlePartial(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) bool {
+	flow := resolveFlow(rules, &models.ClientState{Intent: conversation.Intent, Language: conversation.Language, Closed: conversation.Closed, Exception: conversation.Exception})
+	if !isAbandoned(flow, conversation) {
+		return true
+	}
+	conversation.Abandoned = true
+	conversation.Progress = stepProgress(flow, conversation)
+
+	action := partialAction(rules, conversation)
+	if action != models.PartialReport && isUrgent(conversation) {
+		// Callers are told to hang up and call 112 in an emergency
+		log.Printf("Conversation %s was abandoned at step %d but is urgent, reporting it", conversation.ID, conversation.CurrentStep)
+		return true
+	}
+	log.Printf("Conversation %s was abandoned at step %d, handling it as %s", conversation.ID, conversation.CurrentStep, action)
+	if action == models.PartialReport {
+		return true
+	}
+
+	if action == models.PartialCallback {
+		err := c.DB.AddCallback(ctx, rules.ID, &models.Callback{
+			ConversationID: conversation.ID,
+			RulesetID:      rules.ID,
+			Phone:          conversation.CallerNumber,
+			AbandonedAt:    lastReached(conversation.Progress),
+			Responses:      conversation.Responses,
+			CreatedAt:      time.Now(),
+		})
+		if err != nil {
+			failureCount.Add(string(FailureDB), 1)
+			log.Printf("Error queueing callback for %s, reporting it instead: %v", conversation.ID, err)
+			return true
+		}
+	}
+
+	if err := c.DB.ArchiveConversation(ctx, rules.ID, conversation); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error archiving %s, reporting it instead: %v", conversation.ID, err)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/db/memory"
+	"testing"
+)
+
+func TestStepProgress(t *testing.T) {
+	rules := &models.ConversationRuleSet{
+		Steps: []models.ConversationStep{{Purpose: "melding"}, {Purpose: "locatie"}, {Purpose: "naam"}, {Purpose: "none"}},
+	}
+	conversation := &models.Conversation{
+		Responses:   map[string]string{"melding": "kapotte lantaarnpaal"},
+		CurrentStep: 1,
+	}
+
+	progress := stepProgress(rules, conversation)
+	expected := []string{models.StepCompleted, models.StepSkipped, models.StepNotReached}
+	if len(progress) != len(expected) {
+		t.Fatalf("Expected %d steps, got %v", len(expected), progress)
+	}
+	for i, status := range expected {
+		if progress[i].Status != status {
+			t.Errorf("Step %s: expected %s, got %s", progress[i].Purpose, status, progress[i].Status)
+		}
+	}
+	if !isAbandoned(rules, conversation) {
+		t.Errorf("Expected a call that hung up at step 1 of 4 to be abandoned")
+	}
+	if at := lastReached(progress); at != "locatie" {
+		t.Errorf("Expected to be abandoned at locatie, got %q", at)
+	}
+}
+
+func TestPartialAction(t *testing.T) {
+	answered := map[string]string{"melding": "kapotte lantaarnpaal"}
+
+	tests := []struct {
+		name     string
+		rule     *models.CompletenessRule
+		expected string
+	}{
+		{"no rule", nil, models.PartialReport},
+		{"enough answers", &models.CompletenessRule{MinAnswered: 1, BelowMinimum: models.PartialArchive}, models.PartialReport},
+		{"too few answers", &models.CompletenessRule{MinAnswered: 2, BelowMinimum: models.PartialArchive}, models.PartialArchive},
+		{"missing required", &models.CompletenessRule{Required: []string{"locatie"}, BelowMinimum: models.PartialCallback}, models.PartialCallback},
+		{"unknown action", &models.CompletenessRule{MinAnswered: 2, BelowMinimum: "drop"}, models.PartialReport},
+	}
+
+	for _, test := range tests {
+		rules := &models.ConversationRuleSet{Completeness: test.rule}
+		action := partialAction(rules, &models.Conversation{Responses: answered})
+		if action != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, action)
+		}
+	}
+}
+
+func TestHandlePartialCallback(t *testing.T) {
+	db := memory.NewClient()
+	c := &Controller{DB: db}
+	rules := &models.ConversationRuleSet{
+		ID:           "afval",
+		Steps:        []models.ConversationStep{{Purpose: "melding"}, {Purpose: "locatie"}, {Purpose: "naam"}, {Purpose: "none"}},
+		Completeness: &models.CompletenessRule{Required: []string{"locatie"}, BelowMinimum: models.PartialCallback},
+	}
+	conversation := &models.Conversation{
+		ID:           "call",
+		CallerNumber: "+31612345678",
+		Responses:    map[string]string{"melding": "kapotte lantaarnpaal"},
+		CurrentStep:  1,
+	}
+
+	if c.handlePartial(context.Background(), rules, conversation) {
+		t.Fatalf("Expected a call below the minimum to be queued instead of reported")
+	}
+	callbacks := db.GetCallbacks(rules.ID)
+	if len(callbacks) != 1 {
+		t.Fatalf("Expected a callback, got %v", callbacks)
+	}
+	if callbacks[0].Phone != conversation.CallerNumber {
+		t.Errorf("Expected the callback to call back %s, got %q", conversation.CallerNumber, callbacks[0].Phone)
+	}
+	if callbacks[0].AbandonedAt != "locatie" {
+		t.Errorf("Expected to be abandoned at locatie, got %q", callbacks[0].AbandonedAt)
+	}
+}
+
+func TestHandlePartialUrgent(t *testing.T) {
+	db := memory.NewClient()
+	c := &Controller{DB: db}
+	rules := &models.ConversationRuleSet{
+		ID:           "afval",
+		Steps:        []models.ConversationStep{{Purpose: "melding"}, {Purpose: "locatie"}, {Purpose: "none"}},
+		Completeness: &models.CompletenessRule{MinAnswered: 2, BelowMinimum: models.PartialArchive},
+	}
+	conversation := &models.Conversation{ID: "call", Urgent: true, Responses: map[string]string{"melding": "ik ruik gas"}, CurrentStep: 1}
+
+	if !c.handlePartial(context.Background(), rules, conversation) {
+		t.Errorf("Expected an urgent call to be reported however far the caller got")
+	}
+	if db.GetArchived(rules.ID, "call") != nil {
+		t.Errorf("Expected the urgent call not to be archived")
+	}
+}
@@ -0,0 +1,129 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVoice/internal/models"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultPromptTimeout   = 4 * time.Second
+	defaultPromptMaxLength = 400
+)
+
+// promptData is what the template of a prompt step can refer to.
+type promptData struct {
+	Title   string
+	Purpose string
+	Answers map[string]string
+}
+
+type generatedText struct {
+	Text string `json:"text"`
+}
+
+// speakableText returns what the agent says for the step. For prompt steps
+// the text is generated, falling back to static text when that fails.
+func (c *Controller) speakableText(ctx context.Context, callID string, state *models.ClientState, step *models.ConversationStep) string {
+	if step.Prompt == nil {
+		return step.Text
+	}
+
+	fallback := step.Prompt.Fallback
+	if fallback == "" {
+		fallback = step.Text
+	}
+
+	text, err := c.generatePromptText(ctx, callID, state, step)
+	if err != nil {
+		log.Printf("Error generating text for %s, using fallback: %v", step.Purpose, err)
+		return fallback
+	}
+	return text
+}
+
+func (c *Controller) generatePromptText(ctx context.Context, callID string, state *models.ClientState, step *models.ConversationStep) (string, error) {
+	rules, err := c.rulesFor(state)
+	if err != nil {
+		return "", err
+	}
+	conversation, err := c.DB.GetConversation(ctx, state.RulesetID, callID)
+	if err != nil {
+		return "", failure(FailureDB, "get answers for prompt", err)
+	}
+
+	tmpl, err := template.New(step.Purpose).Option("missingkey=zero").Parse(step.Prompt.Text)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	var instruction strings.Builder
+	err = tmpl.Execute(&instruction, promptData{
+		Title:   rules.Title,
+		Purpose: step.Purpose,
+		Answers: conversation.Responses,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error rendering prompt template: %w", err)
+	}
+
+	maxLength := step.Prompt.MaxLength
+	if maxLength <= 0 {
+		maxLength = defaultPromptMaxLength
+	}
+	system := fmt.Sprintf(`You are the voice assistant of %s talking to a caller on the phone.
+		Write what you say next following the instruction you are given. It is read out loud by a
+		text-to-speech engine, so use plain spoken %s without any markup, lists or emojis and
+		keep it under %d characters. Return it in the following json format: {"text": <text>}
+		without any padding or fluff.`, rules.Title, languageName(rulesetLanguage(rules)), maxLength)
+
+	timeout := defaultPromptTimeout
+	if step.Prompt.Timeout > 0 {
+		timeout = time.Duration(step.Prompt.Timeout) * time.Millisecond
+	}
+
+	// The request is cancelled when it takes too long, so it doesn't keep
+	// running after the fallback was spoken
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	reply, err := c.completeJSON(ctx, callID, rules, system, instruction.String())
+	if err != nil {
+		failureCount.Add(string(FailureAI), 1)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", failure(FailureAI, "generate prompt text", errors.New("timed out"))
+		}
+		return "", failure(FailureAI, "generate prompt text", err)
+	}
+
+	var generated generatedText
+	if err := json.Unmarshal([]byte(reply), &generated); err != nil {
+		return "", fmt.Errorf("error unmarshaling generated text: %w", err)
+	}
+	text := strings.TrimSpace(generated.Text)
+	if text == "" {
+		return "", errors.New("generated text is empty")
+	}
+	return truncateSpoken(text, maxLength), nil
+}
+
+// truncateSpoken shortens text to at most maxLength characters, preferably at
+// the end of a sentence and otherwise at a word boundary.
+func truncateSpoken(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	cut := string(runes[:maxLength])
+	if i := strings.LastIndexAny(cut, ".!?"); i > 0 {
+		return cut[:i+1]
+	}
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		return strings.TrimRight(cut[:i], ",;:") + "."
+	}
+	return cut
+}
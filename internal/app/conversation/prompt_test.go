@@ -0,0 +1,47 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	fakeai "goVoice/pkg/ai/fake"
+	"goVoice/pkg/db/memory"
+	"testing"
+	"time"
+)
+
+func TestTruncateSpoken(t *testing.T) {
+	tests := []struct {
+		text      string
+		maxLength int
+		expected  string
+	}{
+		{"Dank u wel.", 40, "Dank u wel."},
+		{"U meldt een kapotte lantaarnpaal. Klopt dat?", 40, "U meldt een kapotte lantaarnpaal."},
+		{"U meldt een kapotte lantaarnpaal bij de kerk", 30, "U meldt een kapotte."},
+	}
+
+	for _, test := range tests {
+		if got := truncateSpoken(test.text, test.maxLength); got != test.expected {
+			t.Errorf("truncateSpoken(%q, %d) = %q, expected %q", test.text, test.maxLength, got, test.expected)
+		}
+	}
+}
+
+func TestSlowPromptFallsBack(t *testing.T) {
+	db := memory.NewClient()
+	step := models.ConversationStep{Purpose: "adres", Text: "Wat is uw adres?", Prompt: &models.Prompt{Text: "Vraag naar het adres", Timeout: 20}}
+	rules := &models.ConversationRuleSet{ID: "afval", Steps: []models.ConversationStep{step}}
+	db.AddRuleset(context.Background(), rules)
+	db.AddConversation(context.Background(), rules.ID, &models.Conversation{ID: "call"})
+	c := &Controller{AI: fakeai.New(fakeai.Rule{Response: `{"text": "Op welk adres?"}`, Latency: time.Minute}), DB: db}
+
+	start := time.Now()
+	text := c.speakableText(context.Background(), "call", &models.ClientState{RulesetID: rules.ID}, &step)
+	if text != step.Text {
+		t.Errorf("Expected the fallback, got %q", text)
+	}
+	// The fake only returns this early when the request is cancelled
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request to be cancelled after the timeout, took %v", elapsed)
+	}
+}
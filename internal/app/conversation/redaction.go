@@ -0,0 +1,66 @@
+package conversation
+
+import (
+	"context"
+	"expvar"
+	"goVoice/internal/models"
+	"goVoice/internal/redact"
+	"goVoice/pkg/ai/chat"
+	"log"
+)
+
+var redactionCount = expvar.NewMap("redactions")
+
+// redactRequest returns a copy of the request with the personal data the
+// ruleset redacts replaced by placeholders.
+func redactRequest(redactor *redact.Redactor, request *chat.Request) *chat.Request {
+	if redactor == nil {
+		return request
+	}
+	redacted := *request
+	redacted.Messages = make([]chat.Message, len(request.Messages))
+	for i, message := range request.Messages {
+		message.Content = redactor.Redact(message.Content)
+		message.ToolCalls = redactToolCalls(message.ToolCalls, redactor.Redact)
+		redacted.Messages[i] = message
+	}
+	return &redacted
+}
+
+// restoreResponse puts the personal data back in the reply.
+func restoreResponse(redactor *redact.Redactor, response *chat.Response) {
+	if redactor == nil {
+		return
+	}
+	response.Content = redactor.Restore(response.Content)
+	response.ToolCalls = redactToolCalls(response.ToolCalls, redactor.Restore)
+}
+
+func redactToolCalls(calls []chat.ToolCall, replace func(string) string) []chat.ToolCall {
+	if len(calls) == 0 {
+		return calls
+	}
+	replaced := make([]chat.ToolCall, len(calls))
+	for i, call := range calls {
+		call.Arguments = replace(call.Arguments)
+		replaced[i] = call
+	}
+	return replaced
+}
+
+// auditRedactions records what was withheld from the AI provider on the
+// conversation, without the values themselves.
+func (c *Controller) auditRedactions(ctx context.Context, callID string, rules *models.ConversationRuleSet, redactor *redact.Redactor) {
+	counts := redactor.Counts()
+	if len(counts) == 0 {
+		return
+	}
+	for kind, count := range counts {
+		redactionCount.Add(kind, int64(count))
+	}
+	log.Printf("Withheld %s from the AI provider for %s", redact.Summary(counts), callID)
+	if err := c.DB.AddRedactions(ctx, rules.ID, callID, counts); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing redactions of %s: %v", callID, err)
+	}
+}
@@ -0,0 +1,73 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai/chat"
+	fakeai "goVoice/pkg/ai/fake"
+	"goVoice/pkg/db/memory"
+	"strings"
+	"testing"
+)
+
+// echoAI replies with the last message it got, so the reply has the
+// placeholders that were sent.
+type echoAI struct {
+	requests []*chat.Request
+}
+
+func (e *echoAI) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	e.requests = append(e.requests, request)
+	return &chat.Response{Content: request.Messages[len(request.Messages)-1].Content}, nil
+}
+
+func TestCompleteRedacts(t *testing.T) {
+	db := memory.NewClient()
+	rules := &models.ConversationRuleSet{ID: "afval", Redact: []string{"name", "phone", "bsn"}}
+	db.AddConversation(context.Background(), rules.ID, &models.Conversation{ID: "call"})
+	provider := &echoAI{}
+	c := &Controller{AI: provider, DB: db}
+
+	text := "Ik heet Jan de Vries, bel me op 06 12345678"
+	request := &chat.Request{Messages: chat.Prompt("Valideer", text)}
+	response, err := c.complete(context.Background(), "call", rules, request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sent := provider.requests[0].Messages[1].Content
+	if strings.Contains(sent, "Jan") || strings.Contains(sent, "12345678") {
+		t.Errorf("Expected the personal data to be withheld, sent %q", sent)
+	}
+	if request.Messages[1].Content != text {
+		t.Errorf("Expected the request of the caller to be left alone, got %q", request.Messages[1].Content)
+	}
+	if response.Content != text {
+		t.Errorf("Expected the reply to be restored, got %q", response.Content)
+	}
+
+	conversation, _ := db.GetConversation(context.Background(), rules.ID, "call")
+	if conversation.Redactions["name"] != 1 || conversation.Redactions["phone"] != 1 {
+		t.Errorf("Unexpected redactions: %v", conversation.Redactions)
+	}
+}
+
+func TestStreamRestores(t *testing.T) {
+	rules := &models.ConversationRuleSet{ID: "afval", Redact: []string{"name", "phone"}}
+	// Streamed word by word, the placeholders arrive in deltas of their own
+	provider := fakeai.New(fakeai.Rule{Pattern: `\[NAME_1\]`, Response: "Dank u [NAME_1], we bellen u terug op [PHONE_1]."})
+	c := &Controller{AI: provider, DB: memory.NewClient()}
+
+	var said strings.Builder
+	request := &chat.Request{Messages: chat.Prompt("Bedank de beller", "Ik heet Jan de Vries, bel me op 06 12345678")}
+	if _, err := c.stream(context.Background(), "call", rules, request, func(delta string) { said.WriteString(delta) }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sent := provider.Requests()[0].Messages[1].Content; strings.Contains(sent, "Jan") {
+		t.Errorf("Expected the name to be withheld, sent %q", sent)
+	}
+	if expected := "Dank u Jan de Vries, we bellen u terug op 06 12345678."; said.String() != expected {
+		t.Errorf("Expected %q to be said, got %q", expected, said.String())
+	}
+}
@@ -0,0 +1,171 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goVoice/internal/models"
+	"goVoice/pkg/stt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The call provider records the caller on the first channel and the agent on
+// the second
+var recordingSpeakers = []string{models.SpeakerCaller, models.SpeakerAgent}
+
+// retranscribeTimeout bounds getting and transcribing the recordings of a
+// call, the report is sent without the transcript of the recording after it.
+const retranscribeTimeout = 5 * time.Minute
+
+const reconcilePrompt = `You get the answers a caller gave during a phone call, as they were transcribed live, which may have misheard them. You also get a transcript of the recording of the call made afterwards, which is more accurate for names, street names, numbers and accents. Correct the answers where the transcript of the recording shows they were misheard, and leave them exactly as they are otherwise. Return them in the following json format: {"answers": {"<purpose>": "<answer>"}} without any padding or fluff.`
+
+// retranscribe transcribes the recordings of the call again with the batch
+// transcriber, for rulesets that ask for it. The recording transcript is put
+// next to the live one in the report, and with reconcile set the answers it
+// corrects are too. mp3s are the downloaded recordings, nil for the ones that
+// failed.
+func (c *Controller) retranscribe(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation, mp3s [][]byte) {
+	settings := rules.Retranscribe
+	if c.STT == nil || settings == nil {
+		return
+	}
+	if len(rules.Redact) > 0 && !settings.AllowRedacted {
+		// The personal data the ruleset keeps from the AI provider is in the
+		// audio too, and can't be taken out of it
+		log.Printf("Not transcribing the recordings of %s again, the ruleset redacts personal data", conversation.ID)
+		return
+	}
+	// The report waits on this, so it can't take forever
+	ctx, cancel := context.WithTimeout(ctx, retranscribeTimeout)
+	defer cancel()
+	language := settings.Language
+	if language == "" {
+		language = conversation.Language
+	}
+	if language == "" {
+		language = rulesetLanguage(rules)
+	}
+
+	for i, recording := range conversation.Recordings {
+		audio := &stt.Audio{
+			Name:     fmt.Sprintf("recording-%d.mp3", i),
+			Language: language,
+			Prompt:   settings.Prompt,
+		}
+		if i < len(mp3s) {
+			audio.Data = mp3s[i]
+		}
+		if recording.WavUrl != "" {
+			// The wav has the speakers on channels of their own
+			wavChan, errChan := c.CallProvider.GetRecordingWav(&recording)
+			select {
+			case wav := <-wavChan:
+				audio.Data = wav
+				audio.Name = fmt.Sprintf("recording-%d.wav", i)
+			case err := <-errChan:
+				failureCount.Add(string(FailureCallProvider), 1)
+				log.Printf("Error getting wav of recording %d of %s, transcribing the mp3: %v", i, conversation.ID, err)
+			case <-ctx.Done():
+				failureCount.Add(string(FailureCallProvider), 1)
+				log.Printf("Gave up getting wav of recording %d of %s: %v", i, conversation.ID, ctx.Err())
+				conversation.Failures = append(conversation.Failures, reportFailure(FailureTranscribe, "get recording wav", ctx.Err()))
+				return
+			}
+		}
+		if audio.Data == nil {
+			continue
+		}
+
+		segments, err := stt.TranscribeChannels(ctx, c.STT, audio)
+		if err != nil {
+			failureCount.Add(string(FailureTranscribe), 1)
+			log.Printf("Error transcribing recording %d of %s: %v", i, conversation.ID, err)
+			conversation.Failures = append(conversation.Failures, reportFailure(FailureTranscribe, "transcribe recording", err))
+			continue
+		}
+		for _, segment := range segments {
+			speaker := models.SpeakerUnknown
+			if segment.Channel >= 0 && segment.Channel < len(recordingSpeakers) {
+				speaker = recordingSpeakers[segment.Channel]
+			}
+			conversation.RecordingTranscript = append(conversation.RecordingTranscript, models.TranscriptLine{
+				Speaker: speaker,
+				Text:    segment.Text,
+				At:      conversation.StartedAt.Add(segment.Start),
+			})
+		}
+	}
+	log.Printf("Transcribed the recordings of %s again, %d lines", conversation.ID, len(conversation.RecordingTranscript))
+
+	if settings.Reconcile && len(conversation.RecordingTranscript) > 0 && len(conversation.Responses) > 0 {
+		c.reconcile(ctx, rules, conversation)
+	}
+}
+
+// reconcile has the AI provider correct the answers after the transcript of
+// the recording. The answers are left as they were, the ones it changed are
+// put in Corrections.
+func (c *Controller) reconcile(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) {
+	input, err := json.Marshal(map[string]interface{}{
+		"answers":             conversation.Responses,
+		"liveTranscript":      transcriptText(conversation.Transcript),
+		"recordingTranscript": transcriptText(conversation.RecordingTranscript),
+	})
+	if err != nil {
+		log.Printf("Error marshaling answers to reconcile: %v", err)
+		return
+	}
+	reply, err := c.completeJSON(ctx, conversation.ID, rules, reconcilePrompt, string(input))
+	if err != nil {
+		failureCount.Add(string(FailureAI), 1)
+		log.Printf("Error reconciling the answers of %s: %v", conversation.ID, err)
+		conversation.Failures = append(conversation.Failures, reportFailure(FailureAI, "reconcile answers", err))
+		return
+	}
+	var reconciled struct {
+		Answers map[string]string `json:"answers"`
+	}
+	if err := json.Unmarshal([]byte(reply), &reconciled); err != nil {
+		log.Printf("Error unmarshaling reconciled answers of %s: %v", conversation.ID, err)
+		conversation.Failures = append(conversation.Failures, reportFailure(FailureAI, "reconcile answers", err))
+		return
+	}
+	conversation.Corrections = corrections(conversation.Responses, reconciled.Answers)
+}
+
+// corrections are the reconciled answers that differ from the answers, other
+// than in case and whitespace.
+func corrections(answers map[string]string, reconciled map[string]string) map[string]string {
+	corrected := make(map[string]string)
+	for purpose, answer := range answers {
+		correction := strings.TrimSpace(reconciled[purpose])
+		if correction == "" || strings.EqualFold(strings.Join(strings.Fields(correction), " "), strings.Join(strings.Fields(answer), " ")) {
+			continue
+		}
+		corrected[purpose] = correction
+	}
+	if len(corrected) == 0 {
+		return nil
+	}
+	return corrected
+}
+
+// transcriptText writes the lines in order of time, a line per turn.
+func transcriptText(lines []models.TranscriptLine) string {
+	var sb strings.Builder
+	for _, line := range sortedLines(lines) {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", line.Speaker, line.Text))
+	}
+	return sb.String()
+}
+
+func sortedLines(lines []models.TranscriptLine) []models.TranscriptLine {
+	sorted := append([]models.TranscriptLine(nil), lines...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].At.Before(sorted[j].At)
+	})
+	return sorted
+}
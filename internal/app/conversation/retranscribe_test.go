@@ -0,0 +1,152 @@
+package conversation
+
+import (
+	"context"
+	"encoding/binary"
+	"goVoice/internal/models"
+	fakeai "goVoice/pkg/ai/fake"
+	fakeaudio "goVoice/pkg/audio/fake"
+	"goVoice/pkg/db/memory"
+	"goVoice/pkg/stt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// channelTranscriber hears the caller on the left channel and the agent on
+// the right, and a mixed recording as the caller only
+type channelTranscriber struct{}
+
+func (channelTranscriber) Transcribe(ctx context.Context, audio *stt.Audio) ([]stt.Segment, error) {
+	switch audio.Name {
+	case "channel-0-recording-0.wav":
+		return []stt.Segment{{Start: 3 * time.Second, Text: "Ik woon aan de Heerengracht"}}, nil
+	case "channel-1-recording-0.wav":
+		return []stt.Segment{{Start: time.Second, Text: "Wat is uw adres?"}}, nil
+	}
+	return []stt.Segment{{Start: time.Second, Text: "Ik woon aan de Heerengracht"}}, nil
+}
+
+// stereoWav is a silent 16 bit wav with two channels
+func stereoWav() []byte {
+	wav := make([]byte, 44+8)
+	copy(wav[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(wav[4:8], uint32(len(wav)-8))
+	copy(wav[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(wav[16:20], 16)
+	binary.LittleEndian.PutUint16(wav[20:22], 1)
+	binary.LittleEndian.PutUint16(wav[22:24], 2)
+	binary.LittleEndian.PutUint32(wav[24:28], 8000)
+	binary.LittleEndian.PutUint32(wav[28:32], 8000*4)
+	binary.LittleEndian.PutUint16(wav[32:34], 4)
+	binary.LittleEndian.PutUint16(wav[34:36], 16)
+	copy(wav[36:40], "data")
+	binary.LittleEndian.PutUint32(wav[40:44], 8)
+	return wav
+}
+
+func TestRetranscribe(t *testing.T) {
+	started := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	reconciled := fakeai.Rule{Pattern: `Heerengracht`, Response: `{"answers": {"adres": "Heerengracht 12", "naam": "jan"}}`}
+
+	tests := []struct {
+		name        string
+		wav         bool
+		reconcile   bool
+		redact      bool
+		allow       bool
+		transcript  []models.TranscriptLine
+		corrections map[string]string
+	}{
+		{
+			name: "channels",
+			wav:  true,
+			transcript: []models.TranscriptLine{
+				{Speaker: models.SpeakerAgent, Text: "Wat is uw adres?", At: started.Add(time.Second)},
+				{Speaker: models.SpeakerCaller, Text: "Ik woon aan de Heerengracht", At: started.Add(3 * time.Second)},
+			},
+		},
+		{
+			name: "mixed",
+			transcript: []models.TranscriptLine{
+				{Speaker: models.SpeakerUnknown, Text: "Ik woon aan de Heerengracht", At: started.Add(time.Second)},
+			},
+		},
+		{
+			name:      "reconciled",
+			reconcile: true,
+			transcript: []models.TranscriptLine{
+				{Speaker: models.SpeakerUnknown, Text: "Ik woon aan de Heerengracht", At: started.Add(time.Second)},
+			},
+			corrections: map[string]string{"adres": "Heerengracht 12"},
+		},
+		{
+			name:   "redacted",
+			redact: true,
+		},
+		{
+			name:   "redacted and allowed",
+			redact: true,
+			allow:  true,
+			transcript: []models.TranscriptLine{
+				{Speaker: models.SpeakerUnknown, Text: "Ik woon aan de Heerengracht", At: started.Add(time.Second)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeaudio.NewCallProvider()
+			calls.RecordingWav = stereoWav()
+			c := &Controller{CallProvider: calls, AI: fakeai.New(reconciled), DB: memory.NewClient(), STT: channelTranscriber{}}
+			rules := &models.ConversationRuleSet{ID: "afval", Retranscribe: &models.RetranscribeSettings{Reconcile: tt.reconcile, AllowRedacted: tt.allow}}
+			if tt.redact {
+				rules.Redact = []string{"name"}
+			}
+			recording := models.Recording{}
+			if tt.wav {
+				recording.WavUrl = "https://example.com/recording.wav"
+			}
+			conversation := &models.Conversation{
+				ID:         "call",
+				StartedAt:  started,
+				Recordings: []models.Recording{recording},
+				Responses:  map[string]string{"adres": "Herengracht", "naam": "Jan"},
+			}
+
+			c.retranscribe(context.Background(), rules, conversation, [][]byte{[]byte("ID3")})
+
+			if !reflect.DeepEqual(sortedLines(conversation.RecordingTranscript), tt.transcript) {
+				t.Errorf("Expected transcript %+v, got %+v", tt.transcript, conversation.RecordingTranscript)
+			}
+			if !reflect.DeepEqual(conversation.Corrections, tt.corrections) {
+				t.Errorf("Expected corrections %v, got %v", tt.corrections, conversation.Corrections)
+			}
+			if conversation.Responses["adres"] != "Herengracht" {
+				t.Errorf("Expected the answers to be left alone, got %v", conversation.Responses)
+			}
+		})
+	}
+}
+
+// silentCalls never delivers the wav of a recording
+type silentCalls struct {
+	*fakeaudio.CallProvider
+}
+
+func (silentCalls) GetRecordingWav(recording *models.Recording) (chan []byte, chan error) {
+	return make(chan []byte), make(chan error)
+}
+
+func TestRetranscribeGivesUp(t *testing.T) {
+	c := &Controller{CallProvider: silentCalls{fakeaudio.NewCallProvider()}, DB: memory.NewClient(), STT: channelTranscriber{}}
+	rules := &models.ConversationRuleSet{ID: "afval", Retranscribe: &models.RetranscribeSettings{}}
+	conversation := &models.Conversation{ID: "call", Recordings: []models.Recording{{WavUrl: "https://example.com/recording.wav"}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.retranscribe(ctx, rules, conversation, nil)
+
+	if len(conversation.Failures) != 1 || conversation.Failures[0].Kind != string(FailureTranscribe) {
+		t.Errorf("Expected the report to go without the transcript of the recording, got %+v", conversation.Failures)
+	}
+}
@@ -0,0 +1,78 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/internal/schedule"
+	"log"
+	"time"
+)
+
+// now returns the time on the clock of the controller.
+func (c *Controller) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+// OpeningState returns the client state a call to the ruleset is answered
+// with. Calls while the line is closed by the schedule of the ruleset are
+// marked closed, so they get the closed steps.
+func (c *Controller) OpeningState(rulesetID string) *models.ClientState {
+	state := &models.ClientState{RulesetID: rulesetID}
+	rules, err := c.getRules(rulesetID)
+	if err != nil || rules.Schedule == nil {
+		return state
+	}
+
+	status, err := schedule.At(rules.Schedule, c.now())
+	if err != nil {
+		// Better to take calls at the wrong time than to turn callers away
+		log.Printf("Error checking the schedule of %s, taking the call: %v", rulesetID, err)
+		return state
+	}
+	if status.Open {
+		return state
+	}
+	if status.Exception != nil {
+		state.Exception = status.Exception.Date
+	}
+	if len(schedule.ClosedSteps(rules.Schedule, state.Exception)) == 0 {
+		log.Printf("Ruleset %s is closed but has no closed steps, taking the call", rulesetID)
+		return &models.ClientState{RulesetID: rulesetID}
+	}
+	log.Printf("Ruleset %s is closed, answering with the closed steps", rulesetID)
+	state.Closed = true
+	return state
+}
+
+// closedFlow returns a copy of the ruleset with the steps for calls while the
+// line is closed.
+func closedFlow(rules *models.ConversationRuleSet, state *models.ClientState) *models.ConversationRuleSet {
+	resolved := *rules
+	resolved.Steps = schedule.ClosedSteps(rules.Schedule, state.Exception)
+	// Closed calls aren't routed or translated
+	resolved.Intents = nil
+	resolved.Translations = nil
+	return &resolved
+}
+
+// handleClosed archives calls that came in while the line was closed, unless
+// the schedule says to report them or the call was urgent. It returns
+// whether the conversation should still be reported.
+func (c *Controller) handleClosed(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) bool {
+	if !conversation.Closed || rules.Schedule == nil || rules.Schedule.ReportClosed {
+		return true
+	}
+	if isUrgent(conversation) {
+		log.Printf("Reporting urgent call %s although the line was closed", conversation.ID)
+		return true
+	}
+	if err := c.DB.ArchiveConversation(ctx, rules.ID, conversation); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error archiving closed call %s, reporting it instead: %v", conversation.ID, err)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/db/memory"
+	"testing"
+	"time"
+)
+
+func TestOpeningState(t *testing.T) {
+	db := memory.NewClient()
+	db.AddRuleset(context.Background(), &models.ConversationRuleSet{
+		ID:    "gemeente",
+		Steps: []models.ConversationStep{{Text: "Wat wilt u melden?", Purpose: "melding"}, {Text: "Tot ziens", Purpose: "none"}},
+		Schedule: &models.Schedule{
+			Hours:       []models.OpeningHours{{Days: []string{"monday"}, Open: "08:30", Close: "17:00"}},
+			Exceptions:  []models.ScheduleException{{Date: "2026-12-28", Name: "Sluitingsdag", Steps: []models.ConversationStep{{Text: "Vandaag zijn we gesloten"}}}},
+			ClosedSteps: []models.ConversationStep{{Text: "Bel ons tijdens kantooruren. Bij gevaar belt u 112."}},
+		},
+	})
+	amsterdam, _ := time.LoadLocation("Europe/Amsterdam")
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		closed bool
+		opener string
+	}{
+		{"open", time.Date(2026, 10, 19, 10, 0, 0, 0, amsterdam), false, "Wat wilt u melden?"},
+		{"evening", time.Date(2026, 10, 19, 20, 0, 0, 0, amsterdam), true, "Bel ons tijdens kantooruren. Bij gevaar belt u 112."},
+		{"exception", time.Date(2026, 12, 28, 10, 0, 0, 0, amsterdam), true, "Vandaag zijn we gesloten"},
+	}
+
+	for _, test := range tests {
+		at := test.at
+		c := &Controller{DB: db, Clock: func() time.Time { return at }}
+		state := c.OpeningState("gemeente")
+		if state.Closed != test.closed {
+			t.Errorf("%s: expected closed to be %v", test.name, test.closed)
+		}
+		rules, err := c.rulesFor(state)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if rules.Steps[0].Text != test.opener {
+			t.Errorf("%s: expected opener %q, got %q", test.name, test.opener, rules.Steps[0].Text)
+		}
+	}
+}
+
+func TestHandleClosed(t *testing.T) {
+	tests := []struct {
+		name         string
+		conversation models.Conversation
+		reportClosed bool
+		reported     bool
+	}{
+		{"open", models.Conversation{}, false, true},
+		{"closed", models.Conversation{Closed: true}, false, false},
+		{"closed and reported", models.Conversation{Closed: true}, true, true},
+		{"closed and urgent", models.Conversation{Closed: true, Urgent: true}, false, true},
+		{"closed with emergency", models.Conversation{Closed: true, EmergencyTriggers: []models.EmergencyTrigger{{Source: "keyword", Match: "gaslucht"}}}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := memory.NewClient()
+			c := &Controller{DB: db}
+			rules := &models.ConversationRuleSet{ID: "afval", Schedule: &models.Schedule{ReportClosed: test.reportClosed}}
+			conversation := test.conversation
+			conversation.ID = "call"
+
+			if reported := c.handleClosed(context.Background(), rules, &conversation); reported != test.reported {
+				t.Errorf("Expected reported %v, got %v", test.reported, reported)
+			}
+			if archived := db.GetArchived(rules.ID, "call") != nil; archived == test.reported {
+				t.Errorf("Expected archived %v, got %v", !test.reported, archived)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package conversation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// abbreviations don't end a sentence, even though they end with a period
+var abbreviations = map[string]bool{
+	"bijv.": true, "bv.": true, "o.a.": true, "d.w.z.": true, "z.s.m.": true,
+	"nr.": true, "ca.": true, "dhr.": true, "mevr.": true, "mr.": true,
+	"dr.": true, "st.": true, "t.a.v.": true, "i.v.m.": true, "e.d.": true,
+	"e.g.": true, "i.e.": true, "etc.": true, "no.": true, "mrs.": true,
+}
+
+// sentenceSplitter cuts text that streams in into sentences, handing out
+// every sentence as soon as it is complete.
+type sentenceSplitter struct {
+	pending string
+}
+
+// Write adds streamed text and returns the sentences it completed.
+func (s *sentenceSplitter) Write(delta string) []string {
+	s.pending += delta
+	var sentences []string
+	for {
+		end := sentenceEnd(s.pending)
+		if end < 0 {
+			return sentences
+		}
+		if sentence := strings.TrimSpace(s.pending[:end]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		s.pending = s.pending[end:]
+	}
+}
+
+// Flush returns what is left once the stream ended.
+func (s *sentenceSplitter) Flush() string {
+	rest := strings.TrimSpace(s.pending)
+	s.pending = ""
+	return rest
+}
+
+// sentenceEnd returns the index after the first sentence in text, or -1 when
+// text doesn't hold a complete sentence yet. A sentence is complete once the
+// whitespace after its closing punctuation came in, before that a period
+// might as well be part of a number or an abbreviation.
+func sentenceEnd(text string) int {
+	for i, r := range text {
+		if r == '\n' {
+			return i + 1
+		}
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		rest := text[i+1:]
+		// Closing quotes and repeated punctuation belong to the sentence
+		next := strings.IndexFunc(rest, func(r rune) bool { return !strings.ContainsRune(`.!?"')`, r) })
+		if next < 0 {
+			return -1
+		}
+		if !unicode.IsSpace(rune(rest[next])) {
+			continue
+		}
+		if r == '.' && isAbbreviation(text[:i+1]) {
+			continue
+		}
+		return i + 1 + next
+	}
+	return -1
+}
+
+// isAbbreviation tells whether the text ends with an abbreviation or an
+// initial, e.g. "J." in "J. de Vries".
+func isAbbreviation(text string) bool {
+	start := strings.LastIndexFunc(text, unicode.IsSpace) + 1
+	word := strings.ToLower(text[start:])
+	if abbreviations[word] {
+		return true
+	}
+	letters := []rune(strings.TrimSuffix(word, "."))
+	return len(letters) == 1 && unicode.IsLetter(letters[0])
+}
@@ -0,0 +1,38 @@
+package conversation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSentenceSplitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		deltas    []string
+		sentences []string
+		rest      string
+	}{
+		{"waits for the space", []string{"Dank u", " wel.", " Wat is", " uw adres?"}, []string{"Dank u wel."}, "Wat is uw adres?"},
+		{"several at once", []string{"Goed. Helder! Wat nu? "}, []string{"Goed.", "Helder!", "Wat nu?"}, ""},
+		{"numbers", []string{"Het bedrag is 3.50 euro. ", "Klopt dat?"}, []string{"Het bedrag is 3.50 euro."}, "Klopt dat?"},
+		{"abbreviations", []string{"Bijv. een losse tegel o.a. bij nr. 5. ", "Waar?"}, []string{"Bijv. een losse tegel o.a. bij nr. 5."}, "Waar?"},
+		{"initials", []string{"Dank u, J. de Vries. ", "Uw adres?"}, []string{"Dank u, J. de Vries."}, "Uw adres?"},
+		{"quotes", []string{`U zei "morgen." `, "Klopt dat?"}, []string{`U zei "morgen."`}, "Klopt dat?"},
+		{"newlines", []string{"Dank u\nWat is uw adres"}, []string{"Dank u"}, "Wat is uw adres"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var splitter sentenceSplitter
+			var sentences []string
+			for _, delta := range test.deltas {
+				sentences = append(sentences, splitter.Write(delta)...)
+			}
+			if !reflect.DeepEqual(sentences, test.sentences) {
+				t.Errorf("Expected sentences %q, got %q", test.sentences, sentences)
+			}
+			if rest := splitter.Flush(); rest != test.rest {
+				t.Errorf("Expected %q to be left, got %q", test.rest, rest)
+			}
+		})
+	}
+}
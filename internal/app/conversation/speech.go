@@ -0,0 +1,226 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/internal/redact"
+	"goVoice/pkg/ai"
+	"goVoice/pkg/ai/chat"
+	"log"
+	"strings"
+)
+
+/* speech is a step spoken sentence by sentence while the AI provider streams
+ * its text. Sentences are queued and sent to the call provider one at a time,
+ * the next one once the previous one was spoken (see SpeechEnded), so the
+ * sentences that weren't spoken yet can be dropped when the caller barges in.
+ */
+type speech struct {
+	rules *models.ConversationRuleSet
+	state *models.ClientState
+	queue []string
+	said  []string
+	// speaking is set while a sentence is being spoken, streaming while the
+	// AI provider may still add sentences
+	speaking  bool
+	streaming bool
+	cancelled bool
+	cancel    context.CancelFunc
+}
+
+// streamsStep tells whether the next step is streamed. Only the questions of
+// advanced rulesets that turned streaming on are, the call ends once the
+// final step was spoken so it is said in one go.
+func (c *Controller) streamsStep(rules *models.ConversationRuleSet, state *models.ClientState, step *models.ConversationStep) bool {
+	if rules.Simple || !rules.Streaming {
+		return false
+	}
+	if _, ok := c.AI.(ai.StreamingProvider); !ok {
+		return false
+	}
+	if step.AudioURL != "" || step.Prompt != nil || step.UseCallerID {
+		return false
+	}
+	return state.CurrentStep+1 < len(rules.Steps)-1
+}
+
+// streamNextStep asks the next step in the words the AI provider streams,
+// speaking every sentence as soon as it is complete. When the stream fails
+// before anything was said the question of the step is asked as scripted,
+// otherwise the sentences that came in are all that is said.
+func (c *Controller) streamNextStep(ctx context.Context, callID string, rules *models.ConversationRuleSet, state *models.ClientState, step *models.ConversationStep, transcript string) {
+	log.Println("Streaming next step")
+	if err := c.DB.SetCurrentStep(ctx, state.RulesetID, callID, state.CurrentStep, state.TotalSteps); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing current step of %s: %v", callID, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := &speech{rules: rules, state: state, streaming: true, cancel: cancel}
+	c.mu.Lock()
+	if c.escalated[callID] {
+		// escalate drops the speech under the same lock, this one came too late
+		c.mu.Unlock()
+		log.Printf("Not streaming the next step to %s, the call was escalated", callID)
+		return
+	}
+	if c.speeches == nil {
+		c.speeches = make(map[string]*speech)
+	}
+	if previous, ok := c.speeches[callID]; ok {
+		previous.cancel()
+	}
+	c.speeches[callID] = s
+	c.mu.Unlock()
+
+	var splitter sentenceSplitter
+	messages, err := c.dialogueMessages(ctx, callID, rules, state, transcript, step,
+		"Return only the text to say, without any padding or fluff.")
+	if err == nil {
+		_, err = c.stream(ctx, callID, rules, &chat.Request{
+			Messages:    messages,
+			Temperature: chat.Temperature(dialogueTemperature),
+			MaxTokens:   dialogueMaxTokens,
+		}, func(delta string) {
+			for _, sentence := range splitter.Write(delta) {
+				c.say(callID, s, sentence)
+			}
+		})
+	}
+
+	c.mu.Lock()
+	cancelled := s.cancelled
+	started := len(s.said) > 0 || len(s.queue) > 0
+	c.mu.Unlock()
+	switch {
+	case cancelled:
+	case err != nil && !started:
+		failureCount.Add(string(FailureAI), 1)
+		log.Printf("Error streaming the dialogue of %s, asking %s as scripted: %v", callID, step.Purpose, err)
+		c.say(callID, s, step.Text)
+	default:
+		if err != nil {
+			failureCount.Add(string(FailureAI), 1)
+			log.Printf("Error streaming the dialogue of %s, ending the turn with what was said: %v", callID, err)
+		}
+		if rest := splitter.Flush(); rest != "" {
+			c.say(callID, s, truncateSpoken(rest, defaultPromptMaxLength))
+		}
+	}
+
+	c.mu.Lock()
+	s.streaming = false
+	c.settleLocked(callID, s)
+	c.mu.Unlock()
+}
+
+// stream streams the request to the AI provider of the ruleset and records
+// the usage of the call, redacting it like complete does.
+func (c *Controller) stream(ctx context.Context, callID string, rules *models.ConversationRuleSet, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	redactor := redact.New(rules.Redact)
+	request = redactRequest(redactor, forRuleset(rules, request))
+	write, flush := redactor.RestoreStream(onDelta)
+	response, err := ai.Stream(ctx, c.AI, request, write)
+	c.auditRedactions(ctx, callID, rules, redactor)
+	if err != nil {
+		return nil, err
+	}
+	flush()
+	restoreResponse(redactor, response)
+	c.recordTokens(ctx, callID, rules, request, response)
+	return response, nil
+}
+
+// say queues the sentence, it is spoken right away when nothing else is.
+func (c *Controller) say(callID string, s *speech, sentence string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.cancelled {
+		return
+	}
+	s.queue = append(s.queue, sentence)
+	c.settleLocked(callID, s)
+}
+
+// settleLocked speaks the next sentence when nothing is being spoken, and
+// wraps the speech up once everything was said. c.mu must be held.
+func (c *Controller) settleLocked(callID string, s *speech) {
+	if !s.speaking && !s.cancelled && len(s.queue) > 0 {
+		sentence := s.queue[0]
+		s.queue = s.queue[1:]
+		s.speaking = true
+		s.said = append(s.said, sentence)
+		go c.speakSentence(callID, s, sentence)
+		return
+	}
+	if s.speaking || s.streaming || len(s.queue) > 0 {
+		return
+	}
+	if c.speeches[callID] == s {
+		delete(c.speeches, callID)
+	}
+	if len(s.said) > 0 {
+		c.addTranscriptLine(callID, s.state.RulesetID, models.SpeakerAgent, strings.Join(s.said, " "))
+	}
+}
+
+func (c *Controller) speakSentence(callID string, s *speech, sentence string) {
+	done, errChan := c.CallProvider.SpeakText(callID, sentence, s.state)
+	select {
+	case <-done:
+	case err := <-errChan:
+		log.Printf("Error speaking sentence of %s: %v", callID, err)
+		c.mu.Lock()
+		s.cancelled = true
+		s.speaking = false
+		s.queue = nil
+		s.cancel()
+		c.settleLocked(callID, s)
+		c.mu.Unlock()
+		c.handleFailure(context.Background(), callID, s.state, s.rules, failure(FailureCallProvider, "broadcast step", err))
+	}
+}
+
+// SpeechEnded is called when the call provider finished speaking on the call
+// with the given state. It speaks the next sentence of a streamed step, and
+// tells whether the step is still being spoken.
+func (c *Controller) SpeechEnded(callID string, state *models.ClientState) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.speeches[callID]
+	if !ok || state == nil || state.CurrentStep != s.state.CurrentStep {
+		return false
+	}
+	s.speaking = false
+	c.settleLocked(callID, s)
+	return s.speaking || s.streaming
+}
+
+// bargeIn drops the sentences of a streamed step that weren't spoken yet,
+// the caller started talking over them.
+func (c *Controller) bargeIn(callID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.speeches[callID]
+	if !ok || s.cancelled || len(s.said) == 0 || (len(s.queue) == 0 && !s.streaming) {
+		return
+	}
+	log.Printf("Caller of %s barged in, dropping %d queued sentences", callID, len(s.queue))
+	s.cancelled = true
+	s.queue = nil
+	s.cancel()
+	c.settleLocked(callID, s)
+}
+
+// dropSpeech stops streaming the step of the call.
+func (c *Controller) dropSpeech(callID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.speeches[callID]; ok {
+		s.cancelled = true
+		s.queue = nil
+		s.cancel()
+		delete(c.speeches, callID)
+	}
+}
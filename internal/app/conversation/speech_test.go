@@ -0,0 +1,113 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai/chat"
+	"goVoice/pkg/audio/fake"
+	"goVoice/pkg/db/memory"
+	"testing"
+	"time"
+)
+
+func TestSpeechQueue(t *testing.T) {
+	calls := fake.NewCallProvider()
+	c := &Controller{CallProvider: calls, DB: memory.NewClient()}
+	state := &models.ClientState{RulesetID: "afval", CurrentStep: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &speech{rules: &models.ConversationRuleSet{ID: "afval"}, state: state, streaming: true, cancel: cancel}
+	c.speeches = map[string]*speech{"call": s}
+
+	spoken := func() string {
+		select {
+		case event := <-calls.Events:
+			return event.Text
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	c.say("call", s, "Dank u wel.")
+	c.say("call", s, "Wat is uw adres?")
+	if text := spoken(); text != "Dank u wel." {
+		t.Fatalf("Expected the first sentence to be spoken, got %q", text)
+	}
+	if c.SpeechEnded("call", &models.ClientState{CurrentStep: 2}) {
+		t.Error("Expected the speech of another step to be ignored")
+	}
+	if !c.SpeechEnded("call", state) {
+		t.Error("Expected the step to be spoken still")
+	}
+	if text := spoken(); text != "Wat is uw adres?" {
+		t.Fatalf("Expected the second sentence to be spoken, got %q", text)
+	}
+
+	c.bargeIn("call")
+	if ctx.Err() == nil {
+		t.Error("Expected barging in to cancel the stream")
+	}
+	c.say("call", s, "En uw huisnummer?")
+	select {
+	case event := <-calls.Events:
+		t.Errorf("Expected nothing to be spoken after barging in, got %q", event.Text)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// brokenStream streams its text and then fails, like a dropped connection.
+type brokenStream struct {
+	text string
+}
+
+func (b brokenStream) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	return nil, errDown
+}
+
+func (b brokenStream) StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	if b.text != "" {
+		onDelta(b.text)
+	}
+	return nil, errDown
+}
+
+func TestStreamFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		streamed string
+		spoken   []string
+	}{
+		{"before anything was said", "", []string{"Waar staat de lantaarnpaal?"}},
+		{"after a sentence was said", "Dank u wel. Waar staat de", []string{"Dank u wel.", "Waar staat de"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rules := testRules()
+			rules.Streaming = true
+			db := memory.NewClient()
+			db.AddConversation(ctx, rules.ID, &models.Conversation{ID: "call"})
+			calls := fake.NewCallProvider()
+			c := &Controller{AI: brokenStream{text: tt.streamed}, DB: db, CallProvider: calls}
+			state := &models.ClientState{RulesetID: rules.ID, CurrentStep: 1}
+
+			c.streamNextStep(ctx, "call", rules, state, &rules.Steps[1], "de lantaarnpaal is kapot")
+
+			for _, expected := range tt.spoken {
+				select {
+				case event := <-calls.Events:
+					if event.Text != expected {
+						t.Fatalf("Expected %q to be spoken, got %q", expected, event.Text)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("Expected %q to be spoken", expected)
+				}
+				c.SpeechEnded("call", state)
+			}
+			select {
+			case event := <-calls.Events:
+				t.Errorf("Expected nothing more to be spoken, got %q", event.Text)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
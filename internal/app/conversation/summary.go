@@ -0,0 +1,154 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai/chat"
+	"log"
+	"strings"
+)
+
+const maxSummaryAttempts = 3
+
+// defaultCategories is used for rulesets that don't define their own taxonomy
+var defaultCategories = []string{
+	"afval",
+	"openbare verlichting",
+	"wegen en verkeer",
+	"groen",
+	"overlast",
+	"overig",
+}
+
+var urgencies = []string{models.UrgencyLow, models.UrgencyNormal, models.UrgencyHigh}
+
+const summarySchema = `{
+	"type": "object",
+	"properties": {
+		"summary": {"type": "string", "description": "one line summary of the call"},
+		"category": {"type": "string", "enum": %s},
+		"urgency": {"type": "string", "enum": %s},
+		"address": {"type": "string", "description": "the address the call is about, empty if none was given"}
+	},
+	"required": ["summary", "category", "urgency", "address"],
+	"additionalProperties": false
+}`
+
+func categories(rules *models.ConversationRuleSet) []string {
+	if len(rules.Categories) > 0 {
+		return rules.Categories
+	}
+	return defaultCategories
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSummary decodes and validates the reply of the AI provider against
+// the summary schema.
+func parseSummary(reply string, categories []string) (*models.CallSummary, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(reply)))
+	decoder.DisallowUnknownFields()
+	var summary models.CallSummary
+	if err := decoder.Decode(&summary); err != nil {
+		return nil, fmt.Errorf("reply is not valid json for the schema: %w", err)
+	}
+
+	var problems []string
+	summary.Summary = strings.TrimSpace(summary.Summary)
+	if summary.Summary == "" {
+		problems = append(problems, "summary is empty")
+	} else if strings.Contains(summary.Summary, "\n") {
+		problems = append(problems, "summary is more than one line")
+	}
+	if !contains(categories, summary.Category) {
+		problems = append(problems, fmt.Sprintf("category %q is not one of %v", summary.Category, categories))
+	}
+	if !contains(urgencies, summary.Urgency) {
+		problems = append(problems, fmt.Sprintf("urgency %q is not one of %v", summary.Urgency, urgencies))
+	}
+	summary.Address = strings.TrimSpace(summary.Address)
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, ", "))
+	}
+	return &summary, nil
+}
+
+// summarize asks the AI provider for a structured report of the conversation,
+// asking again with the validation errors when the reply doesn't fit the
+// schema.
+func (c *Controller) summarize(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) (*models.CallSummary, error) {
+	taxonomy := categories(rules)
+	categoriesJSON, _ := json.Marshal(taxonomy)
+	urgenciesJSON, _ := json.Marshal(urgencies)
+
+	system := fmt.Sprintf(`You write reports of calls to the %s phone line. You are given the answers the caller
+		gave, keyed by the purpose of the question, in json. The answers are transcribed from audio and might be
+		incorrectly transcribed. Write a one line summary in Dutch, pick the category that fits best, estimate how
+		urgent the report is and extract the address it is about. Return it as json without any padding or fluff.`, rules.Title)
+	// Providers that can enforce the schema hold the model to it, the others
+	// get it in the system message
+	format := &chat.ResponseFormat{
+		Name:   "call_summary",
+		Schema: json.RawMessage(fmt.Sprintf(summarySchema, categoriesJSON, urgenciesJSON)),
+		Strict: true,
+	}
+
+	answersJSON, err := json.Marshal(conversation.Responses)
+	if err != nil {
+		log.Printf("Error marshaling answers to JSON: %v", err)
+		return nil, err
+	}
+
+	text := string(answersJSON)
+	var lastErr error
+	for attempt := 1; attempt <= maxSummaryAttempts; attempt++ {
+		response, err := c.complete(ctx, conversation.ID, rules, &chat.Request{
+			Messages:       chat.Prompt(system, text),
+			ResponseFormat: format,
+		})
+		if err != nil {
+			failureCount.Add(string(FailureAI), 1)
+			return nil, failure(FailureAI, "summarize", err)
+		}
+		reply := response.Content
+		summary, err := parseSummary(reply, taxonomy)
+		if err == nil {
+			return summary, nil
+		}
+		log.Printf("Summary attempt %d of %s doesn't match the schema: %v", attempt, conversation.ID, err)
+		lastErr = err
+		text = fmt.Sprintf("%s\n\nYour previous reply %s was invalid: %v. Reply again following the schema.", answersJSON, reply, err)
+	}
+	return nil, failure(FailureAI, "summarize", fmt.Errorf("no valid summary after %d attempts: %w", maxSummaryAttempts, lastErr))
+}
+
+// addSummary summarizes the conversation and stores the summary on it. When
+// that fails the conversation is marked with the failure instead.
+func (c *Controller) addSummary(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) {
+	// A conversation that is reported again keeps its summary
+	if len(conversation.Responses) == 0 || conversation.Summary != nil {
+		return
+	}
+	summary, err := c.summarize(ctx, rules, conversation)
+	if err != nil {
+		log.Printf("Error summarizing conversation %s: %v", conversation.ID, err)
+		conversation.Failures = append(conversation.Failures, reportFailure(FailureAI, "summarize", err))
+		return
+	}
+	conversation.Summary = summary
+	if err := c.DB.SetSummary(ctx, conversation.RulesetID, conversation.ID, summary); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing summary of %s: %v", conversation.ID, err)
+	}
+}
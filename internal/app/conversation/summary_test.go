@@ -0,0 +1,58 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	fakeai "goVoice/pkg/ai/fake"
+	"goVoice/pkg/db/memory"
+	"strings"
+	"testing"
+)
+
+func TestParseSummary(t *testing.T) {
+	taxonomy := []string{"afval", "overig"}
+
+	summary, err := parseSummary(`{"summary": " Container is vol ", "category": "afval", "urgency": "normal", "address": "Oldehoofsterkerkhof 1, Leeuwarden"}`, taxonomy)
+	if err != nil {
+		t.Fatalf("Expected a valid summary, got error: %v", err)
+	}
+	if summary.Summary != "Container is vol" || summary.Address != "Oldehoofsterkerkhof 1, Leeuwarden" {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	invalid := []struct {
+		reply    string
+		expected string
+	}{
+		{`not json`, "not valid json"},
+		{`{"summary": "x", "category": "afval", "urgency": "normal", "address": "", "extra": 1}`, "unknown field"},
+		{`{"summary": "x", "category": "verlichting", "urgency": "normal", "address": ""}`, "category"},
+		{`{"summary": "", "category": "afval", "urgency": "asap", "address": ""}`, "urgency"},
+	}
+	for _, test := range invalid {
+		_, err := parseSummary(test.reply, taxonomy)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("parseSummary(%s) = %v, expected an error about %q", test.reply, err, test.expected)
+		}
+	}
+}
+
+func TestSummarizeSendsSchema(t *testing.T) {
+	provider := fakeai.New(fakeai.Rule{Response: `{"summary": "Kapotte lantaarnpaal", "category": "verlichting", "urgency": "normal", "address": "Kerkstraat 1"}`})
+	c := &Controller{AI: provider, DB: memory.NewClient()}
+	rules := &models.ConversationRuleSet{ID: "afval", Title: "Leeuwarden", Categories: []string{"verlichting", "overig"}}
+	conversation := &models.Conversation{ID: "call", Responses: map[string]string{"melding": "de lantaarnpaal in de Kerkstraat is kapot"}}
+
+	summary, err := c.summarize(context.Background(), rules, conversation)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.Category != "verlichting" {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	format := provider.Requests()[0].ResponseFormat
+	if format == nil || !format.Strict || !strings.Contains(string(format.Schema), `"enum": ["verlichting","overig"]`) {
+		t.Errorf("Expected the schema with the categories of the ruleset as response format, got %+v", format)
+	}
+}
@@ -0,0 +1,90 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/billing"
+	"goVoice/internal/models"
+	"goVoice/internal/schedule"
+	"goVoice/pkg/ai/chat"
+	"log"
+	"math"
+	"time"
+)
+
+// recordTokens adds the tokens of the response to the usage of the call and
+// to that of the ruleset that day.
+func (c *Controller) recordTokens(ctx context.Context, callID string, rules *models.ConversationRuleSet, request *chat.Request, response *chat.Response) {
+	usage := models.Usage{Tokens: map[string]models.TokenUsage{
+		providerName(request, response): {
+			Requests:         1,
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+		},
+	}}
+	if err := c.DB.AddUsage(ctx, rules.ID, callID, &usage); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing AI usage of %s: %v", callID, err)
+	}
+	c.addDailyUsage(ctx, rules, c.now(), usage)
+}
+
+// recordCallUsage adds the call and how long it took to the usage of the
+// ruleset on the day it started, and to the conversation for the report.
+// A conversation that is reported again was counted already.
+func (c *Controller) recordCallUsage(ctx context.Context, rules *models.ConversationRuleSet, conversation *models.Conversation) {
+	if conversation.Usage.Calls > 0 {
+		return
+	}
+	usage := models.Usage{Calls: 1, CallSeconds: callSeconds(conversation)}
+	billing.Add(&conversation.Usage, usage)
+	if err := c.DB.AddUsage(ctx, rules.ID, conversation.ID, &usage); err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing call usage of %s: %v", conversation.ID, err)
+	}
+	day := conversation.StartedAt
+	if day.IsZero() {
+		day = c.now()
+	}
+	c.addDailyUsage(ctx, rules, day, usage)
+}
+
+func (c *Controller) addDailyUsage(ctx context.Context, rules *models.ConversationRuleSet, at time.Time, usage models.Usage) {
+	err := c.DB.AddDailyUsage(ctx, &models.DailyUsage{
+		RulesetID: rules.ID,
+		Customer:  billing.Customer(rules),
+		Day:       usageDay(rules, at),
+		Usage:     usage,
+	})
+	if err != nil {
+		failureCount.Add(string(FailureDB), 1)
+		log.Printf("Error storing daily usage of %s: %v", rules.ID, err)
+	}
+}
+
+// callSeconds is how long the call took, from the call provider's events.
+func callSeconds(conversation *models.Conversation) int {
+	if conversation.StartedAt.IsZero() || conversation.EndedAt.Before(conversation.StartedAt) {
+		return 0
+	}
+	return int(math.Ceil(conversation.EndedAt.Sub(conversation.StartedAt).Seconds()))
+}
+
+// usageDay is the day usage is counted on, in the timezone of the ruleset.
+func usageDay(rules *models.ConversationRuleSet, at time.Time) string {
+	location, err := schedule.Location(rules.Schedule)
+	if err != nil {
+		location = time.UTC
+	}
+	return at.In(location).Format("2006-01-02")
+}
+
+// providerName is what the tokens of the response are counted under.
+func providerName(request *chat.Request, response *chat.Response) string {
+	if response.Provider != "" {
+		return response.Provider
+	}
+	if request.Provider != "" {
+		return request.Provider
+	}
+	return billing.DefaultProvider
+}
@@ -0,0 +1,61 @@
+package conversation
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/ai/chat"
+	fakeai "goVoice/pkg/ai/fake"
+	"goVoice/pkg/db/memory"
+	"testing"
+	"time"
+)
+
+func TestRecordUsage(t *testing.T) {
+	db := memory.NewClient()
+	rules := &models.ConversationRuleSet{ID: "afval", Clients: []*models.Client{{Name: "Leeuwarden"}}}
+	started := time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC)
+	db.AddConversation(context.Background(), rules.ID, &models.Conversation{ID: "call", StartedAt: started, EndedAt: started.Add(90500 * time.Millisecond)})
+	c := &Controller{DB: db, Clock: func() time.Time { return started }}
+
+	response := &chat.Response{Usage: chat.Usage{PromptTokens: 100, CompletionTokens: 20}}
+	c.recordTokens(context.Background(), "call", rules, &chat.Request{}, response)
+	c.recordTokens(context.Background(), "call", rules, &chat.Request{Provider: "onprem"}, response)
+
+	conversation, _ := db.GetConversation(context.Background(), rules.ID, "call")
+	c.recordCallUsage(context.Background(), rules, conversation)
+
+	if tokens := conversation.Usage.Tokens["default"]; tokens.Requests != 1 || tokens.PromptTokens != 100 || tokens.CompletionTokens != 20 {
+		t.Errorf("Unexpected tokens of the default provider: %+v", tokens)
+	}
+	if conversation.Usage.CallSeconds != 91 {
+		t.Errorf("Expected 91 call seconds, got %d", conversation.Usage.CallSeconds)
+	}
+
+	// 23:30 UTC is the next day in Amsterdam
+	days, _ := db.GetDailyUsage(context.Background(), "2026-10-19", "2026-10-19")
+	if len(days) != 1 {
+		t.Fatalf("Expected usage on 2026-10-19, got %+v", days)
+	}
+	day := days[0]
+	if day.Customer != "Leeuwarden" || day.Usage.Calls != 1 || day.Usage.Tokens["onprem"].Requests != 1 {
+		t.Errorf("Unexpected daily usage: %+v", day)
+	}
+}
+
+func TestStreamRecordsUsage(t *testing.T) {
+	db := memory.NewClient()
+	rules := &models.ConversationRuleSet{ID: "afval"}
+	db.AddConversation(context.Background(), rules.ID, &models.Conversation{ID: "call"})
+	// The fake counts no tokens when streaming, like the OpenAI APIs
+	c := &Controller{AI: fakeai.New(fakeai.Rule{Response: "Waar gaat uw melding over?"}), DB: db}
+
+	request := &chat.Request{Messages: chat.Prompt("Je bent een assistent.", "Hallo")}
+	if _, err := c.stream(context.Background(), "call", rules, request, func(string) {}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conversation, _ := db.GetConversation(context.Background(), rules.ID, "call")
+	if tokens := conversation.Usage.Tokens["default"]; tokens.Requests != 1 || tokens.PromptTokens == 0 || tokens.CompletionTokens == 0 {
+		t.Errorf("Expected the tokens of the streamed reply to be estimated, got %+v", tokens)
+	}
+}
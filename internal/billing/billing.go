@@ -0,0 +1,212 @@
+// Package billing adds up what calls cost, the time on the phone and the
+// tokens of the AI providers, and prices it with a price table so clients
+// can be invoiced.
+package billing
+
+import (
+	"fmt"
+	"goVoice/internal/models"
+	"math"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProvider is what the tokens of the AI provider of the server are
+// counted under, when it isn't a chain of named providers.
+const DefaultProvider = "default"
+
+/* Prices is the price table, read from a yaml file like
+ *
+ *	currency: EUR
+ *	callMinute: 0.012
+ *	providers:
+ *	  default: {prompt: 0.0005, completion: 0.0015}
+ *	  onprem: {prompt: 0, completion: 0}
+ *
+ * Token prices are per 1000 tokens, by the name of the AI provider.
+ */
+type Prices struct {
+	Currency   string                 `yaml:"currency" json:"currency"`
+	CallMinute float64                `yaml:"callMinute" json:"callMinute"`
+	Providers  map[string]TokenPrices `yaml:"providers" json:"providers"`
+}
+
+type TokenPrices struct {
+	Prompt     float64 `yaml:"prompt" json:"prompt"`
+	Completion float64 `yaml:"completion" json:"completion"`
+}
+
+// Cost is what usage costs in the currency of the price table.
+type Cost struct {
+	Calls float64 `json:"calls"`
+	AI    float64 `json:"ai"`
+	Total float64 `json:"total"`
+}
+
+// LoadPrices reads the price table at path. Without a path nothing costs
+// anything.
+func LoadPrices(path string) (*Prices, error) {
+	prices := &Prices{Currency: "EUR"}
+	if path == "" {
+		return prices, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading price table: %w", err)
+	}
+	if err := yaml.Unmarshal(data, prices); err != nil {
+		return nil, fmt.Errorf("error parsing price table %s: %w", path, err)
+	}
+	return prices, nil
+}
+
+// Cost prices the usage. Calls are billed per started minute of the total
+// call time, tokens of providers without a price are free.
+func (p *Prices) Cost(usage models.Usage) Cost {
+	var cost Cost
+	cost.Calls = math.Ceil(float64(usage.CallSeconds)/60) * p.CallMinute
+	for provider, tokens := range usage.Tokens {
+		price := p.Providers[provider]
+		cost.AI += float64(tokens.PromptTokens)/1000*price.Prompt + float64(tokens.CompletionTokens)/1000*price.Completion
+	}
+	cost.Calls = round(cost.Calls)
+	cost.AI = round(cost.AI)
+	cost.Total = round(cost.Calls + cost.AI)
+	return cost
+}
+
+// round rounds to hundredths of a cent.
+func round(amount float64) float64 {
+	return math.Round(amount*10000) / 10000
+}
+
+// Add adds usage to total.
+func Add(total *models.Usage, usage models.Usage) {
+	total.Calls += usage.Calls
+	total.CallSeconds += usage.CallSeconds
+	for provider, tokens := range usage.Tokens {
+		if total.Tokens == nil {
+			total.Tokens = make(map[string]models.TokenUsage)
+		}
+		sum := total.Tokens[provider]
+		sum.Requests += tokens.Requests
+		sum.PromptTokens += tokens.PromptTokens
+		sum.CompletionTokens += tokens.CompletionTokens
+		total.Tokens[provider] = sum
+	}
+}
+
+// Customer returns who the calls of the ruleset are invoiced to.
+func Customer(rules *models.ConversationRuleSet) string {
+	if rules.Customer != "" {
+		return rules.Customer
+	}
+	for _, client := range rules.Clients {
+		if client != nil && client.Name != "" {
+			return client.Name
+		}
+	}
+	return rules.ID
+}
+
+type DayCost struct {
+	Day   string       `json:"day"`
+	Usage models.Usage `json:"usage"`
+	Cost  Cost         `json:"cost"`
+}
+
+type RulesetCost struct {
+	RulesetID string       `json:"rulesetId"`
+	Customer  string       `json:"customer"`
+	Days      []DayCost    `json:"days"`
+	Usage     models.Usage `json:"usage"`
+	Cost      Cost         `json:"cost"`
+}
+
+type CustomerCost struct {
+	Customer string       `json:"customer"`
+	Rulesets []string     `json:"rulesets"`
+	Usage    models.Usage `json:"usage"`
+	Cost     Cost         `json:"cost"`
+}
+
+// Report is the usage and cost of a period, per ruleset by day and per
+// customer.
+type Report struct {
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Currency  string         `json:"currency"`
+	Rulesets  []RulesetCost  `json:"rulesets"`
+	Customers []CustomerCost `json:"customers"`
+}
+
+// Summarize rolls the daily usage up per ruleset and per customer.
+func Summarize(from string, to string, days []models.DailyUsage, prices *Prices) *Report {
+	rulesets := map[string]*RulesetCost{}
+	customers := map[string]*CustomerCost{}
+	for _, day := range days {
+		ruleset, ok := rulesets[day.RulesetID]
+		if !ok {
+			ruleset = &RulesetCost{RulesetID: day.RulesetID, Customer: day.Customer}
+			rulesets[day.RulesetID] = ruleset
+		}
+		ruleset.Days = append(ruleset.Days, DayCost{Day: day.Day, Usage: day.Usage, Cost: prices.Cost(day.Usage)})
+		Add(&ruleset.Usage, day.Usage)
+
+		customer, ok := customers[day.Customer]
+		if !ok {
+			customer = &CustomerCost{Customer: day.Customer}
+			customers[day.Customer] = customer
+		}
+		if !contains(customer.Rulesets, day.RulesetID) {
+			customer.Rulesets = append(customer.Rulesets, day.RulesetID)
+		}
+		Add(&customer.Usage, day.Usage)
+	}
+
+	report := &Report{From: from, To: to, Currency: prices.Currency, Rulesets: []RulesetCost{}, Customers: []CustomerCost{}}
+	for _, ruleset := range rulesets {
+		sort.Slice(ruleset.Days, func(i, j int) bool { return ruleset.Days[i].Day < ruleset.Days[j].Day })
+		ruleset.Cost = sumCosts(ruleset.Days)
+		report.Rulesets = append(report.Rulesets, *ruleset)
+	}
+	for _, customer := range customers {
+		sort.Strings(customer.Rulesets)
+		var cost Cost
+		for _, ruleset := range report.Rulesets {
+			if ruleset.Customer == customer.Customer {
+				cost = addCosts(cost, ruleset.Cost)
+			}
+		}
+		customer.Cost = cost
+		report.Customers = append(report.Customers, *customer)
+	}
+	sort.Slice(report.Rulesets, func(i, j int) bool { return report.Rulesets[i].RulesetID < report.Rulesets[j].RulesetID })
+	sort.Slice(report.Customers, func(i, j int) bool { return report.Customers[i].Customer < report.Customers[j].Customer })
+	return report
+}
+
+// sumCosts adds up the costs of the days, so call minutes are rounded up
+// per day rather than once for the whole period.
+func sumCosts(days []DayCost) Cost {
+	var cost Cost
+	for _, day := range days {
+		cost = addCosts(cost, day.Cost)
+	}
+	return cost
+}
+
+func addCosts(a Cost, b Cost) Cost {
+	return Cost{Calls: round(a.Calls + b.Calls), AI: round(a.AI + b.AI), Total: round(a.Total + b.Total)}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package billing
+
+import (
+	"goVoice/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var prices = &Prices{
+	Currency:   "EUR",
+	CallMinute: 0.01,
+	Providers: map[string]TokenPrices{
+		DefaultProvider: {Prompt: 0.5, Completion: 1.5},
+	},
+}
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		usage    models.Usage
+		expected Cost
+	}{
+		{"nothing", models.Usage{}, Cost{}},
+		{"started minute", models.Usage{Calls: 2, CallSeconds: 61}, Cost{Calls: 0.02, Total: 0.02}},
+		{"tokens", models.Usage{Tokens: map[string]models.TokenUsage{
+			DefaultProvider: {Requests: 3, PromptTokens: 2000, CompletionTokens: 500},
+		}}, Cost{AI: 1.75, Total: 1.75}},
+		{"unpriced provider", models.Usage{Tokens: map[string]models.TokenUsage{
+			"onprem": {Requests: 1, PromptTokens: 2000},
+		}}, Cost{}},
+	}
+	for _, test := range tests {
+		if cost := prices.Cost(test.usage); cost != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, cost)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tokens := func(prompt int) map[string]models.TokenUsage {
+		return map[string]models.TokenUsage{DefaultProvider: {Requests: 1, PromptTokens: prompt}}
+	}
+	days := []models.DailyUsage{
+		{RulesetID: "afval", Customer: "Leeuwarden", Day: "2026-10-02", Usage: models.Usage{Calls: 1, CallSeconds: 30, Tokens: tokens(1000)}},
+		{RulesetID: "afval", Customer: "Leeuwarden", Day: "2026-10-01", Usage: models.Usage{Calls: 1, CallSeconds: 30}},
+		{RulesetID: "wegen", Customer: "Leeuwarden", Day: "2026-10-01", Usage: models.Usage{Calls: 1, CallSeconds: 90}},
+		{RulesetID: "parkeren", Customer: "Sneek", Day: "2026-10-01", Usage: models.Usage{Tokens: tokens(2000)}},
+	}
+	report := Summarize("2026-10-01", "2026-10-31", days, prices)
+
+	if len(report.Rulesets) != 3 || report.Rulesets[0].RulesetID != "afval" {
+		t.Fatalf("Expected 3 rulesets starting with afval, got %+v", report.Rulesets)
+	}
+	afval := report.Rulesets[0]
+	if afval.Days[0].Day != "2026-10-01" || afval.Usage.Calls != 2 || afval.Usage.CallSeconds != 60 {
+		t.Errorf("Expected the days of afval in order adding up to 2 calls of 60 seconds, got %+v", afval)
+	}
+	// Minutes are rounded up per day, so the two 30 second days are 2 minutes
+	if afval.Cost != (Cost{Calls: 0.02, AI: 0.5, Total: 0.52}) {
+		t.Errorf("Unexpected cost of afval: %+v", afval.Cost)
+	}
+
+	if len(report.Customers) != 2 {
+		t.Fatalf("Expected 2 customers, got %+v", report.Customers)
+	}
+	leeuwarden := report.Customers[0]
+	if leeuwarden.Customer != "Leeuwarden" || len(leeuwarden.Rulesets) != 2 || leeuwarden.Cost.Total != 0.54 {
+		t.Errorf("Expected Leeuwarden to pay 0.54 for afval and wegen, got %+v", leeuwarden)
+	}
+	if sneek := report.Customers[1]; sneek.Cost.Total != 1 {
+		t.Errorf("Expected Sneek to pay 1, got %+v", sneek)
+	}
+}
+
+func TestLoadPrices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.yaml")
+	err := os.WriteFile(path, []byte("currency: EUR\ncallMinute: 0.012\nproviders:\n  default: {prompt: 0.0005, completion: 0.0015}\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPrices(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.CallMinute != 0.012 || loaded.Providers[DefaultProvider].Completion != 0.0015 {
+		t.Errorf("Unexpected prices: %+v", loaded)
+	}
+
+	if loaded, err := LoadPrices(""); err != nil || loaded.Cost(models.Usage{CallSeconds: 600}).Total != 0 {
+		t.Errorf("Expected no price table to make everything free, got %+v (%v)", loaded, err)
+	}
+}
+
+func TestCustomer(t *testing.T) {
+	tests := []struct {
+		rules    models.ConversationRuleSet
+		expected string
+	}{
+		{models.ConversationRuleSet{ID: "afval", Customer: "Gemeente Leeuwarden", Clients: []*models.Client{{Name: "Team afval"}}}, "Gemeente Leeuwarden"},
+		{models.ConversationRuleSet{ID: "afval", Clients: []*models.Client{{Name: "Team afval"}}}, "Team afval"},
+		{models.ConversationRuleSet{ID: "afval"}, "afval"},
+	}
+	for _, test := range tests {
+		if customer := Customer(&test.rules); customer != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, customer)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
@@ -22,6 +25,38 @@ type Config struct {
 	OpenAIKey            string
 	OpenAIEndpoint       string
 	OpenAIDeploymentName string
+	// AIProvider is azure (the default), openai or compatible, for servers
+	// with an OpenAI compatible API at AIBaseURL such as llama.cpp or Ollama.
+	// AIModel is the model, or the deployment with azure.
+	AIProvider string
+	AIModel    string
+	AIBaseURL  string
+	// AIProviders are more providers rulesets can pick by name, e.g. an on-prem
+	// model for customers whose calls may not leave the building.
+	AIProviders map[string]AIProviderConfig
+	// AIFailover are named providers tried in order when the default provider
+	// fails, AITimeout is how long to wait for each of them.
+	AIFailover []string
+	AITimeout  time.Duration
+	// PricesFile is the yaml price table usage is priced with, see the
+	// billing package
+	PricesFile string
+	// How long to wait for the recordings of a call before reporting without them
+	RecordingDeadline time.Duration
+	// STTProvider transcribes recordings again after the call: openai, or
+	// compatible for a server with an OpenAI compatible API at STTBaseURL
+	// such as a local whisper server. Empty turns it off.
+	STTProvider string
+	STTModel    string
+	STTBaseURL  string
+	STTKey      string
+}
+
+type AIProviderConfig struct {
+	Provider string
+	Model    string
+	BaseURL  string
+	Key      string
 }
 
 func LoadConfig() (*Config, error) {
@@ -50,6 +85,18 @@ func LoadConfigFromEnv() (*Config, error) {
 		OpenAIKey:            os.Getenv("OPENAI_KEY"),
 		OpenAIEndpoint:       os.Getenv("OPENAI_ENDPOINT"),
 		OpenAIDeploymentName: os.Getenv("OPENAI_DEPLOYMENT_NAME"),
+		AIProvider:           os.Getenv("AI_PROVIDER"),
+		AIModel:              os.Getenv("AI_MODEL"),
+		AIBaseURL:            os.Getenv("AI_BASE_URL"),
+		AIProviders:          aiProvidersFromEnv(),
+		AIFailover:           listFromEnv("AI_FAILOVER"),
+		AITimeout:            secondsFromEnv("AI_TIMEOUT"),
+		PricesFile:           os.Getenv("PRICES_FILE"),
+		RecordingDeadline:    secondsFromEnv("RECORDING_DEADLINE"),
+		STTProvider:          os.Getenv("STT_PROVIDER"),
+		STTModel:             os.Getenv("STT_MODEL"),
+		STTBaseURL:           os.Getenv("STT_BASE_URL"),
+		STTKey:               os.Getenv("STT_KEY"),
 	}, nil
 }
 
@@ -62,8 +109,20 @@ func loadConfigFromSecretManager() (*Config, error) {
 	defer client.Close()
 
 	config := &Config{
-		ApiPort:      ":" + os.Getenv("PORT"),
-		GCPProjectID: os.Getenv("GCP_PROJECT_ID"),
+		ApiPort:           ":" + os.Getenv("PORT"),
+		GCPProjectID:      os.Getenv("GCP_PROJECT_ID"),
+		AIProvider:        os.Getenv("AI_PROVIDER"),
+		AIModel:           os.Getenv("AI_MODEL"),
+		AIBaseURL:         os.Getenv("AI_BASE_URL"),
+		AIProviders:       aiProvidersFromEnv(),
+		AIFailover:        listFromEnv("AI_FAILOVER"),
+		AITimeout:         secondsFromEnv("AI_TIMEOUT"),
+		PricesFile:        os.Getenv("PRICES_FILE"),
+		RecordingDeadline: secondsFromEnv("RECORDING_DEADLINE"),
+		STTProvider:       os.Getenv("STT_PROVIDER"),
+		STTModel:          os.Getenv("STT_MODEL"),
+		STTBaseURL:        os.Getenv("STT_BASE_URL"),
+		STTKey:            os.Getenv("STT_KEY"),
 	}
 
 	secretNames := []string{
@@ -107,3 +166,50 @@ func loadConfigFromSecretManager() (*Config, error) {
 
 	return config, nil
 }
+
+// secondsFromEnv reads a duration in seconds, zero when unset or invalid
+func secondsFromEnv(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Ignoring %s, %q is not a number of seconds", name, value)
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// listFromEnv reads a comma separated list.
+func listFromEnv(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// aiProvidersFromEnv reads the providers named in AI_PROVIDERS, a comma
+// separated list. Provider "onprem" is configured with AI_ONPREM_PROVIDER
+// (compatible by default), AI_ONPREM_MODEL, AI_ONPREM_BASE_URL and
+// AI_ONPREM_KEY.
+func aiProvidersFromEnv() map[string]AIProviderConfig {
+	providers := map[string]AIProviderConfig{}
+	for _, name := range listFromEnv("AI_PROVIDERS") {
+		prefix := "AI_" + strings.ToUpper(name) + "_"
+		provider := AIProviderConfig{
+			Provider: os.Getenv(prefix + "PROVIDER"),
+			Model:    os.Getenv(prefix + "MODEL"),
+			BaseURL:  os.Getenv(prefix + "BASE_URL"),
+			Key:      os.Getenv(prefix + "KEY"),
+		}
+		if provider.Provider == "" {
+			provider.Provider = "compatible"
+		}
+		providers[name] = provider
+	}
+	return providers
+}
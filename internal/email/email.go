@@ -9,6 +9,11 @@ import (
 	"gopkg.in/gomail.v2"
 )
 
+// Sender sends the reports of conversations
+type Sender interface {
+	SendEmailWithAttachment(ctx context.Context, to []string, subject string, body string, attachments [][]byte, attachmentNames []string) error
+}
+
 type EmailProvider struct {
 	password string
 }
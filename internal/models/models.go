@@ -1,7 +1,30 @@
 package models
 
+import "time"
+
+/* Prompt makes a step generate what the agent says through the AI provider.
+ * Text is a text/template rendered with the answers given so far (e.g.
+ * {{.Answers.melding}}) and used as the instruction for the AI. When
+ * generation fails or takes longer than Timeout (milliseconds) the Fallback
+ * text, or else the step text, is spoken instead.
+ */
 type Prompt struct {
-	Text string `json:"text" firestore:"text"`
+	Text      string `json:"text" firestore:"text"`
+	MaxLength int    `json:"maxLength" firestore:"maxLength"` // in characters
+	Fallback  string `json:"fallback" firestore:"fallback"`
+	Timeout   int    `json:"timeout" firestore:"timeout"`
+}
+
+/* PromptTemplate is the system prompt the AI provider validates answers
+ * with. Text is a text/template with the fields of prompts.Data, e.g.
+ * {{.Question}}, {{.Purpose}}, {{.Answers.melding}} and {{.Locale}}. Version
+ * is stored with every answer validated with the template, so the results of
+ * prompt changes can be compared. Without a version the template gets one
+ * from a hash of its text.
+ */
+type PromptTemplate struct {
+	Version string `json:"version" firestore:"version"`
+	Text    string `json:"text" firestore:"text"`
 }
 
 type Client struct {
@@ -9,15 +32,288 @@ type Client struct {
 	Email string `json:"email" firestore:"email"`
 }
 
+// Webhook is an HTTPS endpoint of a client that receives the result of every
+// call. Payloads are signed with the secret, see the webhook package.
+type Webhook struct {
+	URL    string `json:"url" firestore:"url"`
+	Secret string `json:"secret" firestore:"secret"`
+}
+
+/* Open311Config is the Open311 GeoReport v2 endpoint of a client and how
+ * calls map onto its service requests. The service code is looked up by the
+ * category of the call summary in ServiceCodes, falling back to ServiceCode.
+ * Fields maps Open311 fields (description, address_string, first_name,
+ * last_name, name, phone and email) to the purposes of the steps that ask
+ * for them; name is split into first_name and last_name.
+ */
+type Open311Config struct {
+	Endpoint       string            `json:"endpoint" firestore:"endpoint"` // base url, /requests.json is appended
+	APIKey         string            `json:"apiKey" firestore:"apiKey"`
+	JurisdictionID string            `json:"jurisdictionId" firestore:"jurisdictionId"`
+	ServiceCode    string            `json:"serviceCode" firestore:"serviceCode"`
+	ServiceCodes   map[string]string `json:"serviceCodes" firestore:"serviceCodes"`
+	Fields         map[string]string `json:"fields" firestore:"fields"`
+}
+
+/* ZGWConfig is where and how reported calls become a zaak in the ZGW
+ * (Zaakgericht Werken) APIs of a client. The zaaktype is looked up by the
+ * category of the call summary in Zaaktypes, falling back to Zaaktype. The
+ * transcript and answers are added to the zaak as a document of the
+ * Informatieobjecttype. ClientID and Secret are the JWT credentials the
+ * client issued for us.
+ */
+type ZGWConfig struct {
+	ZakenURL                     string            `json:"zakenUrl" firestore:"zakenUrl"`           // base url of the Zaken API
+	DocumentenURL                string            `json:"documentenUrl" firestore:"documentenUrl"` // base url of the Documenten API
+	Zaaktype                     string            `json:"zaaktype" firestore:"zaaktype"`
+	Zaaktypes                    map[string]string `json:"zaaktypes" firestore:"zaaktypes"`
+	Informatieobjecttype         string            `json:"informatieobjecttype" firestore:"informatieobjecttype"`
+	Bronorganisatie              string            `json:"bronorganisatie" firestore:"bronorganisatie"` // RSIN of the client
+	VerantwoordelijkeOrganisatie string            `json:"verantwoordelijkeOrganisatie" firestore:"verantwoordelijkeOrganisatie"`
+	ClientID                     string            `json:"clientId" firestore:"clientId"`
+	Secret                       string            `json:"secret" firestore:"secret"`
+}
+
 type ConversationRuleSet struct {
-	ID     string  `json:"id" firestore:"id"`
-	Title  string  `json:"title" firestore:"title"`
-	Simple bool    `json:"simple" firestore:"simple"`
-	Clients []*Client `json:"clients" firestore:"clients"`
+	ID     string `json:"id" firestore:"id"`
+	Title  string `json:"title" firestore:"title"`
+	Simple bool   `json:"simple" firestore:"simple"`
+	// Streaming speaks the questions of advanced rulesets sentence by sentence
+	// while the AI provider generates them
+	Streaming bool      `json:"streaming" firestore:"streaming"`
+	Clients   []*Client `json:"clients" firestore:"clients"`
+	// Customer is who the calls are invoiced to, the first client by default
+	Customer string `json:"customer" firestore:"customer"`
+	// Webhooks receive the result of every call next to the email
+	Webhooks []Webhook `json:"webhooks" firestore:"webhooks"`
+	// Open311 files every reported call as a service request
+	Open311 *Open311Config `json:"open311" firestore:"open311"`
+	// ZGW creates a zaak with the transcript for every reported call
+	ZGW *ZGWConfig `json:"zgw" firestore:"zgw"`
+	// Schedule restricts when the line takes calls, it is always open without
+	Schedule *Schedule `json:"schedule" firestore:"schedule"`
+	// AI picks the AI provider and model for the calls of the ruleset
+	AI *AISettings `json:"ai" firestore:"ai"`
+	// ValidationPrompt replaces the built-in prompt answers are validated with
+	ValidationPrompt *PromptTemplate `json:"validationPrompt" firestore:"validationPrompt"`
+	// Redact lists the kinds of personal data (name, phone, email, bsn) that
+	// are replaced by placeholders before anything is sent to the AI provider
+	Redact []string `json:"redact" firestore:"redact"`
+	// Retranscribe transcribes the recording again after the call
+	Retranscribe *RetranscribeSettings `json:"retranscribe" firestore:"retranscribe"`
+
+	Steps    []ConversationStep `json:"steps" firestore:"steps"`
+	Recovery *RecoveryPolicy    `json:"recovery" firestore:"recovery"`
+	Intents  []Intent           `json:"intents" firestore:"intents"`
+
+	Emergency    *EmergencyPolicy  `json:"emergency" firestore:"emergency"`
+	Completeness *CompletenessRule `json:"completeness" firestore:"completeness"`
+	// Categories is the taxonomy the post-call summary categorizes calls in
+	Categories []string `json:"categories" firestore:"categories"`
 
+	Language     string        `json:"language" firestore:"language"` // ISO 639-1 code of the steps, defaults to "nl"
+	Voice        string        `json:"voice" firestore:"voice"`       // text-to-speech voice, defaults to the call provider's
+	Translations []Translation `json:"translations" firestore:"translations"`
+}
+
+// AISettings override the AI provider of the server for a ruleset. Provider
+// is one of the providers named in the AI_PROVIDERS of the server, Model
+// overrides the model of the provider.
+type AISettings struct {
+	Provider string `json:"provider" firestore:"provider"`
+	Model    string `json:"model" firestore:"model"`
+}
+
+/* EmergencyPolicy makes every transcript of a call be checked for reports
+ * that belong on the emergency line. Keywords are matched on whole words
+ * regardless of case, a trailing * matches any word starting with the keyword
+ * (e.g. "brand*"). When Classifier is set final transcripts are also checked
+ * by the AI provider. A match interrupts the call with Message, after which
+ * the caller is transferred to TransferNumber or the call is ended.
+ */
+type EmergencyPolicy struct {
+	Keywords       []string `json:"keywords" firestore:"keywords"`
+	Classifier     bool     `json:"classifier" firestore:"classifier"`
+	Message        string   `json:"message" firestore:"message"`
+	TransferNumber string   `json:"transferNumber" firestore:"transferNumber"`
+}
+
+// EmergencyTrigger records why a call was escalated, for review.
+type EmergencyTrigger struct {
+	Source     string    `json:"source" firestore:"source"` // "keyword" or "classifier"
+	Match      string    `json:"match" firestore:"match"`   // the keyword or the reason given by the classifier
+	Transcript string    `json:"transcript" firestore:"transcript"`
+	Step       int       `json:"step" firestore:"step"`
+	Purpose    string    `json:"purpose" firestore:"purpose"`
+	OccurredAt time.Time `json:"occurredAt" firestore:"occurredAt"`
+}
+
+/* CompletenessRule decides what happens to calls that were abandoned before
+ * the final step. Calls with at least MinAnswered answers, including all
+ * Required purposes, are reported. Other calls are handled as BelowMinimum
+ * says: "report" them anyway (the default), "archive" them silently or
+ * "callback" to archive them and queue a callback.
+ */
+type CompletenessRule struct {
+	MinAnswered  int      `json:"minAnswered" firestore:"minAnswered"`
+	Required     []string `json:"required" firestore:"required"`
+	BelowMinimum string   `json:"belowMinimum" firestore:"belowMinimum"`
+}
+
+const (
+	PartialReport   = "report"
+	PartialArchive  = "archive"
+	PartialCallback = "callback"
+)
+
+/* Schedule is when a ruleset takes calls. The line is open during the weekly
+ * Hours, unless an exception for the date says otherwise, in Timezone (an
+ * IANA name, defaults to Europe/Amsterdam). Without hours the line is open
+ * every day. Calls while the line is closed hear the ClosedSteps, or the Steps
+ * of the exception of the day, and are hung up after the final one. They are
+ * archived unless ReportClosed is set.
+ */
+type Schedule struct {
+	Timezone     string              `json:"timezone" firestore:"timezone"`
+	Hours        []OpeningHours      `json:"hours" firestore:"hours"`
+	Exceptions   []ScheduleException `json:"exceptions" firestore:"exceptions"`
+	ClosedSteps  []ConversationStep  `json:"closedSteps" firestore:"closedSteps"`
+	ReportClosed bool                `json:"reportClosed" firestore:"reportClosed"`
+}
+
+// OpeningHours are the hours the line is open on the given days, e.g.
+// {"days": ["monday", "friday"], "open": "08:30", "close": "17:00"}.
+type OpeningHours struct {
+	Days  []string `json:"days" firestore:"days"`
+	Open  string   `json:"open" firestore:"open"`   // HH:MM
+	Close string   `json:"close" firestore:"close"` // HH:MM, 24:00 for midnight
+}
+
+// ScheduleException replaces the weekly hours on a date such as a holiday.
+// Without Open and Close the line is closed all day.
+type ScheduleException struct {
+	Date  string             `json:"date" firestore:"date"` // YYYY-MM-DD
+	Name  string             `json:"name" firestore:"name"`
+	Open  string             `json:"open" firestore:"open"`
+	Close string             `json:"close" firestore:"close"`
 	Steps []ConversationStep `json:"steps" firestore:"steps"`
 }
 
+// StepProgress tells how far the caller got with a step of the flow.
+type StepProgress struct {
+	Step    int    `json:"step" firestore:"step"`
+	Purpose string `json:"purpose" firestore:"purpose"`
+	Status  string `json:"status" firestore:"status"` // see the Step status constants
+}
+
+const (
+	StepCompleted  = "completed"
+	StepSkipped    = "skipped"
+	StepNotReached = "not_reached"
+)
+
+// Callback is a call that was abandoned too early to report and is queued
+// for someone to call back.
+type Callback struct {
+	ConversationID string            `json:"conversationId" firestore:"conversationId"`
+	RulesetID      string            `json:"rulesetId" firestore:"rulesetId"`
+	Phone          string            `json:"phone" firestore:"phone"`
+	AbandonedAt    string            `json:"abandonedAt" firestore:"abandonedAt"` // purpose of the step the caller hung up at
+	Responses      map[string]string `json:"responses" firestore:"responses"`
+	CreatedAt      time.Time         `json:"createdAt" firestore:"createdAt"`
+}
+
+// CallResult is the payload webhooks receive when a call is reported.
+type CallResult struct {
+	Event             string             `json:"event"`
+	ConversationID    string             `json:"conversationId"`
+	RulesetID         string             `json:"rulesetId"`
+	Title             string             `json:"title"`
+	Answers           map[string]string  `json:"answers"`
+	Confidences       map[string]float64 `json:"confidences,omitempty"`
+	Intent            string             `json:"intent,omitempty"`
+	Language          string             `json:"language,omitempty"`
+	Urgent            bool               `json:"urgent"`
+	Summary           *CallSummary       `json:"summary,omitempty"`
+	Recordings        []string           `json:"recordings"`
+	CallbackRequested bool               `json:"callbackRequested"`
+	Abandoned         bool               `json:"abandoned"`
+	Progress          []StepProgress     `json:"progress,omitempty"`
+	Failures          []Failure          `json:"failures,omitempty"`
+	// IDs the call got in the systems it was exported to, by system
+	ExternalReferences map[string]string `json:"externalReferences,omitempty"`
+	CallerNumber       string            `json:"callerNumber,omitempty"`
+	CallerWithheld     bool              `json:"callerWithheld"`
+	DialedNumber       string            `json:"dialedNumber,omitempty"`
+	Direction          string            `json:"direction,omitempty"`
+	StartedAt          time.Time         `json:"startedAt"`
+	EndedAt            time.Time         `json:"endedAt"`
+	Closed             bool              `json:"closed"`
+	PromptVersions     map[string]string `json:"promptVersions,omitempty"`
+	Usage              Usage             `json:"usage"`
+	Redactions         map[string]int    `json:"redactions,omitempty"`
+	Corrections        map[string]string `json:"corrections,omitempty"`
+	ReportedAt         time.Time         `json:"reportedAt"`
+}
+
+// DeadLetter is a webhook delivery that kept failing, kept so it can be
+// inspected and redelivered.
+type DeadLetter struct {
+	ID             string    `json:"id" firestore:"id"`
+	RulesetID      string    `json:"rulesetId" firestore:"rulesetId"`
+	ConversationID string    `json:"conversationId" firestore:"conversationId"`
+	URL            string    `json:"url" firestore:"url"`
+	Payload        string    `json:"payload" firestore:"payload"`
+	Error          string    `json:"error" firestore:"error"`
+	Attempts       int       `json:"attempts" firestore:"attempts"`
+	CreatedAt      time.Time `json:"createdAt" firestore:"createdAt"`
+	LastAttemptAt  time.Time `json:"lastAttemptAt" firestore:"lastAttemptAt"`
+}
+
+/* Translation is a variant of a ruleset in another language. The language of
+ * the caller is detected from the answer to the opener and when it differs
+ * from the ruleset's the call continues with the translated steps. Steps must
+ * be in the same order as the steps of the ruleset, intents are matched by
+ * name.
+ */
+type Translation struct {
+	Language string             `json:"language" firestore:"language"` // ISO 639-1 code
+	Voice    string             `json:"voice" firestore:"voice"`
+	Steps    []ConversationStep `json:"steps" firestore:"steps"`
+	Intents  []Intent           `json:"intents" firestore:"intents"`
+}
+
+/* Intent is a sub-flow of a ruleset. The answer to the opener is classified
+ * into one of the intents of the ruleset and the call continues with the
+ * steps of that intent instead of the remaining steps of the ruleset. When
+ * nothing matches the intent named IntentOther is used, or when there is no
+ * such intent the steps of the ruleset itself.
+ */
+type Intent struct {
+	Name        string             `json:"name" firestore:"name"`
+	Description string             `json:"description" firestore:"description"`
+	Examples    []string           `json:"examples" firestore:"examples"`
+	Steps       []ConversationStep `json:"steps" firestore:"steps"`
+}
+
+const IntentOther = "other"
+
+/* RecoveryPolicy describes what the caller hears when something on our side
+ * fails mid-call. The current step is retried MaxRetries times after the
+ * apology, after that the caller is transferred, offered a callback or the
+ * call is ended, in that order of preference.
+ */
+type RecoveryPolicy struct {
+	ApologyText    string `json:"apologyText" firestore:"apologyText"`
+	RetryText      string `json:"retryText" firestore:"retryText"` // asked when we could not load the step itself
+	MaxRetries     int    `json:"maxRetries" firestore:"maxRetries"`
+	TransferNumber string `json:"transferNumber" firestore:"transferNumber"`
+	TransferText   string `json:"transferText" firestore:"transferText"`
+	OfferCallback  bool   `json:"offerCallback" firestore:"offerCallback"`
+	CallbackText   string `json:"callbackText" firestore:"callbackText"`
+	GoodbyeText    string `json:"goodbyeText" firestore:"goodbyeText"`
+}
+
 type ConversationStep struct {
 	UserType      string  `json:"userType" firestore:"userType"`
 	Text          string  `json:"text" firestore:"text"`
@@ -25,20 +321,170 @@ type ConversationStep struct {
 	Purpose       string  `json:"purpose" firestore:"purpose"`
 	AudioDuration int     `json:"audioDuration" firestore:"audioDuration"`
 	AudioURL      string  `json:"audioUrl" firestore:"audioUrl"`
+
+	Endpointing *EndpointingPolicy `json:"endpointing" firestore:"endpointing"`
+	// UseCallerID asks the caller to confirm the number they call from
+	// instead of having them read out their phone number. CallerIDText is
+	// the question, a text/template with the number as {{.Number}}.
+	UseCallerID  bool   `json:"useCallerId" firestore:"useCallerId"`
+	CallerIDText string `json:"callerIdText" firestore:"callerIdText"`
+}
+
+/* EndpointingPolicy decides when the transcription fragments of a caller form
+ * one complete answer for a step. Without a policy every final fragment is
+ * committed as the answer straight away. All durations are in milliseconds.
+ */
+type EndpointingPolicy struct {
+	SilenceGap int  `json:"silenceGap" firestore:"silenceGap"` // wait this long without new fragments before committing
+	MinWords   int  `json:"minWords" firestore:"minWords"`     // never commit an answer with fewer words (unless MaxWait passes)
+	AICheck    bool `json:"aiCheck" firestore:"aiCheck"`       // ask the AI provider whether the answer is complete
+	MaxWait    int  `json:"maxWait" firestore:"maxWait"`       // commit whatever we have this long after the first fragment, 15 seconds by default
+}
+
+// TranscriptFragment is a single piece of transcribed caller speech as
+// delivered by the call provider.
+type TranscriptFragment struct {
+	Transcript string  `json:"transcript"`
+	Confidence float64 `json:"confidence"`
+	IsFinal    bool    `json:"isFinal"`
 }
 
 type ConversationStepResponse struct {
-	Purpose  string `json:"purpose" firestore:"purpose"`
-	Response string `json:"response" firestore:"response"`
+	Purpose    string  `json:"purpose" firestore:"purpose"`
+	Response   string  `json:"response" firestore:"response"`
+	Confidence float64 `json:"confidence" firestore:"confidence"` // mean transcription confidence of the answer
+	// PromptVersion is the version of the prompt the answer was validated
+	// with, empty when the transcript was stored as is
+	PromptVersion string `json:"promptVersion" firestore:"promptVersion"`
 }
 
 type Conversation struct {
 	// conversation.ID should always be the same as the CallControlId
-	ID               string            `firestore:"id"`
-	RulesetID        string            `firestore:"rulesetId"`
-	Responses        map[string]string `firestore:"responses"`
-	Recordings       []Recording       `firestore:"recordings"`
-	ConversationDone bool              `firestore:"conversationDone"`
+	ID               string             `firestore:"id"`
+	RulesetID        string             `firestore:"rulesetId"`
+	Responses        map[string]string  `firestore:"responses"`
+	Confidences      map[string]float64 `firestore:"confidences"`
+	Recordings       []Recording        `firestore:"recordings"`
+	ConversationDone bool               `firestore:"conversationDone"`
+	// The report is sent once the conversation is done and all expected
+	// recordings arrived or failed, or when the recording deadline passes.
+	ExpectedRecordings int                `firestore:"expectedRecordings"`
+	RecordingErrors    []string           `firestore:"recordingErrors"`
+	Reported           bool               `firestore:"reported"`
+	Failures           []Failure          `firestore:"failures"`
+	CallbackRequested  bool               `firestore:"callbackRequested"`
+	Intent             string             `firestore:"intent"`
+	Language           string             `firestore:"language"`
+	Urgent             bool               `firestore:"urgent"`
+	EmergencyTriggers  []EmergencyTrigger `firestore:"emergencyTriggers"`
+	Summary            *CallSummary       `firestore:"summary"`
+	// The step the caller was asked last, to tell how far an abandoned call got
+	CurrentStep int            `firestore:"currentStep"`
+	TotalSteps  int            `firestore:"totalSteps"`
+	Abandoned   bool           `firestore:"abandoned"`
+	Progress    []StepProgress `firestore:"progress"`
+	// IDs the call got in the systems it was exported to, by system
+	ExternalReferences map[string]string `firestore:"externalReferences"`
+	Transcript         []TranscriptLine  `firestore:"transcript"`
+	CallerNumber       string            `firestore:"callerNumber"`
+	CallerWithheld     bool              `firestore:"callerWithheld"`
+	DialedNumber       string            `firestore:"dialedNumber"`
+	Direction          string            `firestore:"direction"`
+	StartedAt          time.Time         `firestore:"startedAt"`
+	EndedAt            time.Time         `firestore:"endedAt"`
+	// Closed is set for calls outside the schedule of the ruleset
+	Closed    bool   `firestore:"closed"`
+	Exception string `firestore:"exception"`
+	// Versions of the prompts the answers were validated with, by purpose
+	PromptVersions map[string]string `firestore:"promptVersions"`
+	Usage          Usage             `firestore:"usage"`
+	// Redactions counts the personal data withheld from the AI provider by
+	// kind, one for every value in every request
+	Redactions map[string]int `firestore:"redactions"`
+	// RecordingTranscript is the transcript of the recording made after the
+	// call, Corrections the answers it corrected by purpose
+	RecordingTranscript []TranscriptLine  `firestore:"recordingTranscript"`
+	Corrections         map[string]string `firestore:"corrections"`
+}
+
+// RetranscribeSettings have the recording of calls transcribed again by the
+// batch speech-to-text provider, which copes better with accents than the
+// live transcription.
+type RetranscribeSettings struct {
+	// Language of the recording, that of the conversation by default
+	Language string `json:"language" firestore:"language"`
+	// Prompt helps with the spelling of names and places, e.g. "Ljouwert, Snits"
+	Prompt string `json:"prompt" firestore:"prompt"`
+	// Reconcile has the AI provider correct the answers after the transcript
+	// of the recording
+	Reconcile bool `json:"reconcile" firestore:"reconcile"`
+	// AllowRedacted sends the recordings to the speech-to-text provider even
+	// when the ruleset redacts personal data, which can't be done for audio
+	AllowRedacted bool `json:"allowRedacted" firestore:"allowRedacted"`
+}
+
+// TokenUsage is what an AI provider counted for a number of requests.
+type TokenUsage struct {
+	Requests         int `json:"requests" firestore:"requests"`
+	PromptTokens     int `json:"promptTokens" firestore:"promptTokens"`
+	CompletionTokens int `json:"completionTokens" firestore:"completionTokens"`
+}
+
+// Usage is what calls cost: the time on the phone and the tokens used by
+// AI provider.
+type Usage struct {
+	Calls       int                   `json:"calls" firestore:"calls"`
+	CallSeconds int                   `json:"callSeconds" firestore:"callSeconds"`
+	Tokens      map[string]TokenUsage `json:"tokens" firestore:"tokens"`
+}
+
+// DailyUsage is the usage of a ruleset on a day (2006-01-02), in the
+// timezone of its schedule.
+type DailyUsage struct {
+	RulesetID string `json:"rulesetId" firestore:"rulesetId"`
+	Customer  string `json:"customer" firestore:"customer"`
+	Day       string `json:"day" firestore:"day"`
+	Usage     Usage  `json:"usage" firestore:"usage"`
+}
+
+const (
+	SpeakerAgent  = "agent"
+	SpeakerCaller = "caller"
+	// SpeakerUnknown is on the lines of recordings with the speakers mixed
+	SpeakerUnknown = "unknown"
+)
+
+// TranscriptLine is something the agent or the caller said during the call.
+type TranscriptLine struct {
+	Speaker string    `json:"speaker" firestore:"speaker"` // see the Speaker constants
+	Text    string    `json:"text" firestore:"text"`
+	At      time.Time `json:"at" firestore:"at"`
+}
+
+// CallSummary is the structured report the AI provider makes of a call once
+// it has ended.
+type CallSummary struct {
+	Summary  string `json:"summary" firestore:"summary"`   // one line
+	Category string `json:"category" firestore:"category"` // one of the categories of the ruleset
+	Urgency  string `json:"urgency" firestore:"urgency"`   // see the Urgency constants
+	Address  string `json:"address" firestore:"address"`   // empty when the caller gave none
+}
+
+const (
+	UrgencyLow    = "low"
+	UrgencyNormal = "normal"
+	UrgencyHigh   = "high"
+)
+
+// Failure marks something that went wrong during a conversation so the
+// report can tell the answers are possibly incomplete.
+type Failure struct {
+	Kind       string    `json:"kind" firestore:"kind"`
+	Operation  string    `json:"operation" firestore:"operation"`
+	Message    string    `json:"message" firestore:"message"`
+	Step       int       `json:"step" firestore:"step"`
+	Purpose    string    `json:"purpose" firestore:"purpose"`
+	OccurredAt time.Time `json:"occurredAt" firestore:"occurredAt"`
 }
 
 /* ClientState with telnyx is a freeform, base64 encoded string to pass back and forth
@@ -50,8 +496,48 @@ type ClientState struct {
 	Purpose     string `json:"purpose"`
 	CurrentStep int    `json:"currentStep"`
 	TotalSteps  int    `json:"totalSteps"`
+	Retries     int    `json:"retries,omitempty"`
+	Intent      string `json:"intent,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Voice       string `json:"voice,omitempty"`
+	Emergency   bool   `json:"emergency,omitempty"`
+	// PendingAction is executed by the call provider once the current speech
+	// or playback ends, see the PendingAction constants.
+	PendingAction string `json:"pendingAction,omitempty"`
+	TransferTo    string `json:"transferTo,omitempty"`
+	// The number the caller calls from, empty when it is withheld
+	CallerNumber string `json:"callerNumber,omitempty"`
+	// Set while the caller is asked to confirm their number, and once they
+	// declined it so the step is asked as usual.
+	ConfirmingCallerID bool `json:"confirmingCallerId,omitempty"`
+	CallerIDDeclined   bool `json:"callerIdDeclined,omitempty"`
+	// Closed is set for calls outside the schedule of the ruleset, Exception
+	// is the date of the schedule exception the call falls on.
+	Closed    bool   `json:"closed,omitempty"`
+	Exception string `json:"exception,omitempty"`
 }
 
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// CallInfo is what the call provider knows about a call when it starts.
+type CallInfo struct {
+	From      string // empty when the caller withheld their number
+	To        string
+	Direction string // see the Direction constants
+	Withheld  bool
+	StartedAt time.Time
+}
+
+const (
+	PendingHangup   = "hangup"
+	PendingTransfer = "transfer"
+)
+
 type Recording struct {
 	Url string `json:"url" firestore:"url"`
+	// WavUrl is the recording as wav, with a channel per speaker
+	WavUrl string `json:"wavUrl" firestore:"wavUrl"`
 }
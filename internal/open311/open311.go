@@ -0,0 +1,160 @@
+// Package open311 files reported calls as service requests with the Open311
+// GeoReport v2 API many municipal backoffices accept.
+package open311
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVoice/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// System is the key of the service request ID in the external references of
+// a conversation.
+const System = "open311"
+
+const requestTimeout = 15 * time.Second
+
+// defaultFields maps Open311 fields to the purposes used by the pilot ruleset.
+var defaultFields = map[string]string{
+	"description":    "melding",
+	"address_string": "locatie",
+	"name":           "naam",
+	"phone":          "telefoon",
+	"email":          "email",
+}
+
+type Exporter struct {
+	Client *http.Client
+}
+
+func NewExporter() *Exporter {
+	return &Exporter{Client: &http.Client{Timeout: requestTimeout}}
+}
+
+// serviceRequestReply is an element of the reply to POST /requests. Servers
+// reply with either the ID or a token to look it up later.
+type serviceRequestReply struct {
+	ServiceRequestID string `json:"service_request_id"`
+	Token            string `json:"token"`
+	ServiceNotice    string `json:"service_notice"`
+}
+
+type errorReply struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+// ServiceRequest returns the form of the Open311 service request for the
+// conversation.
+func ServiceRequest(config *models.Open311Config, conversation *models.Conversation) (url.Values, error) {
+	form := url.Values{}
+	if config.APIKey != "" {
+		form.Set("api_key", config.APIKey)
+	}
+	if config.JurisdictionID != "" {
+		form.Set("jurisdiction_id", config.JurisdictionID)
+	}
+
+	serviceCode := config.ServiceCode
+	if summary := conversation.Summary; summary != nil {
+		if code, ok := config.ServiceCodes[summary.Category]; ok {
+			serviceCode = code
+		}
+	}
+	if serviceCode == "" {
+		return nil, errors.New("no service code for the call")
+	}
+	form.Set("service_code", serviceCode)
+
+	fields := config.Fields
+	if len(fields) == 0 {
+		fields = defaultFields
+	}
+	for field, purpose := range fields {
+		answer := strings.TrimSpace(conversation.Responses[purpose])
+		if answer == "" {
+			continue
+		}
+		if field == "name" {
+			first, last, _ := strings.Cut(answer, " ")
+			form.Set("first_name", first)
+			form.Set("last_name", last)
+			continue
+		}
+		form.Set(field, answer)
+	}
+
+	// Fall back to what the summary made of the call
+	if summary := conversation.Summary; summary != nil {
+		if form.Get("description") == "" {
+			form.Set("description", summary.Summary)
+		}
+		if form.Get("address_string") == "" && summary.Address != "" {
+			form.Set("address_string", summary.Address)
+		}
+	}
+	if form.Get("description") == "" {
+		return nil, errors.New("no description for the call")
+	}
+	return form, nil
+}
+
+// Export files the conversation as a service request and returns the ID the
+// server gave it, or the token to look it up when the server hands out IDs
+// later.
+func (e *Exporter) Export(ctx context.Context, config *models.Open311Config, conversation *models.Conversation) (string, error) {
+	form, err := ServiceRequest(config, conversation)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := strings.TrimSuffix(config.Endpoint, "/") + "/requests.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		log.Printf("Error creating Open311 request: %v", err)
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		log.Printf("Error posting Open311 service request: %v", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errs []errorReply
+		if json.Unmarshal(body, &errs) == nil && len(errs) > 0 {
+			return "", fmt.Errorf("open311 server replied %d: %s", errs[0].Code, errs[0].Description)
+		}
+		return "", fmt.Errorf("open311 server replied with %d status code", resp.StatusCode)
+	}
+
+	var replies []serviceRequestReply
+	if err := json.Unmarshal(body, &replies); err != nil {
+		return "", fmt.Errorf("error unmarshaling Open311 reply: %w", err)
+	}
+	if len(replies) == 0 {
+		return "", errors.New("open311 reply has no service request")
+	}
+	if replies[0].ServiceRequestID != "" {
+		return replies[0].ServiceRequestID, nil
+	}
+	if replies[0].Token != "" {
+		return "token:" + replies[0].Token, nil
+	}
+	return "", errors.New("open311 reply has no service request id or token")
+}
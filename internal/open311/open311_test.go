@@ -0,0 +1,94 @@
+package open311
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/internal/open311/open311test"
+	"testing"
+)
+
+func conversation() *models.Conversation {
+	return &models.Conversation{
+		Responses: map[string]string{
+			"melding":  "De lantaarnpaal is kapot",
+			"locatie":  "Tesselschadestraat 12, Leeuwarden",
+			"naam":     "Jan de Vries",
+			"telefoon": "0612345678",
+		},
+		Summary: &models.CallSummary{Summary: "Kapotte lantaarnpaal", Category: "openbare verlichting", Address: "Tesselschadestraat 12"},
+	}
+}
+
+func TestServiceRequest(t *testing.T) {
+	config := &models.Open311Config{
+		ServiceCode:  "overig",
+		ServiceCodes: map[string]string{"openbare verlichting": "OV"},
+	}
+
+	form, err := ServiceRequest(config, conversation())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"service_code":   "OV",
+		"description":    "De lantaarnpaal is kapot",
+		"address_string": "Tesselschadestraat 12, Leeuwarden",
+		"first_name":     "Jan",
+		"last_name":      "de Vries",
+		"phone":          "0612345678",
+		"email":          "",
+	}
+	for field, value := range expected {
+		if form.Get(field) != value {
+			t.Errorf("Expected %s %q, got %q", field, value, form.Get(field))
+		}
+	}
+}
+
+func TestServiceRequestFallsBackToSummary(t *testing.T) {
+	config := &models.Open311Config{
+		ServiceCode: "overig",
+		Fields:      map[string]string{"description": "omschrijving", "address_string": "adres"},
+	}
+
+	form, err := ServiceRequest(config, conversation())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if form.Get("service_code") != "overig" {
+		t.Errorf("Expected the default service code, got %q", form.Get("service_code"))
+	}
+	if form.Get("description") != "Kapotte lantaarnpaal" || form.Get("address_string") != "Tesselschadestraat 12" {
+		t.Errorf("Expected the summary as description and address, got %v", form)
+	}
+
+	if _, err := ServiceRequest(&models.Open311Config{}, conversation()); err == nil {
+		t.Errorf("Expected an error without a service code")
+	}
+}
+
+func TestExport(t *testing.T) {
+	server := open311test.NewServer()
+	defer server.Close()
+	server.ServiceCodes = []string{"OV"}
+	exporter := &Exporter{Client: server.Client()}
+
+	id, err := exporter.Export(context.Background(), &models.Open311Config{
+		Endpoint:     server.URL,
+		ServiceCodes: map[string]string{"openbare verlichting": "OV"},
+	}, conversation())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id != "SR-1" {
+		t.Errorf("Expected service request SR-1, got %q", id)
+	}
+	if requests := server.Requests(); len(requests) != 1 || requests[0].Get("last_name") != "de Vries" {
+		t.Errorf("Unexpected requests %v", requests)
+	}
+
+	_, err = exporter.Export(context.Background(), &models.Open311Config{Endpoint: server.URL, ServiceCode: "afval"}, conversation())
+	if err == nil || err.Error() != "open311 server replied 400: service_code is invalid" {
+		t.Errorf("Expected the error of the server, got %v", err)
+	}
+}
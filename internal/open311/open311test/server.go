@@ -0,0 +1,76 @@
+// Package open311test is a local Open311 GeoReport v2 server that accepts
+// service requests, for testing exports without a backoffice.
+package open311test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+)
+
+type Server struct {
+	*httptest.Server
+	// ServiceCodes the server accepts, any code when empty
+	ServiceCodes []string
+
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+// NewServer starts a server handling POST /requests.json. Close it when done.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Requests returns the forms of the service requests received so far.
+func (s *Server) Requests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost || r.URL.Path != "/requests.json" {
+		reply(w, http.StatusNotFound, []map[string]interface{}{{"code": 404, "description": "not found"}})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		reply(w, http.StatusBadRequest, []map[string]interface{}{{"code": 400, "description": err.Error()}})
+		return
+	}
+	code := r.PostForm.Get("service_code")
+	if code == "" || !s.accepts(code) {
+		reply(w, http.StatusBadRequest, []map[string]interface{}{{"code": 400, "description": "service_code is invalid"}})
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.PostForm)
+	id := fmt.Sprintf("SR-%d", len(s.requests))
+	s.mu.Unlock()
+
+	reply(w, http.StatusCreated, []map[string]interface{}{{"service_request_id": id, "service_notice": ""}})
+}
+
+func (s *Server) accepts(code string) bool {
+	if len(s.ServiceCodes) == 0 {
+		return true
+	}
+	for _, accepted := range s.ServiceCodes {
+		if accepted == code {
+			return true
+		}
+	}
+	return false
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,82 @@
+// Package prompts renders the prompt templates rulesets validate answers
+// with, and gives every template a version so answers can be traced back to
+// the prompt they were validated with.
+package prompts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"goVoice/internal/models"
+	"strings"
+	"text/template"
+)
+
+// Default is the prompt answers are validated with when the ruleset doesn't
+// have one. Change its version whenever its text changes.
+var Default = &models.PromptTemplate{
+	Version: "default-1",
+	Text: `You are a questionaire validator who is given answers in {{.Language}} in the following format
+		{ question: <question>, purpose: <purpose>, answer: <answer> }. The answers are transscribed from audio and might be incorrectly transcribed.
+		Also they might be incomplete as the user is taking a short pause.
+		I want you to try and interpret the answer in relation to the question and correct them where possible. Then I want you to 
+		give an estimate if the answer is complete or not. Return this in the following json format:
+		{purpose: <purpose>, answer: <answer>, <complete>: <true/false>} without any padding or fluff so I can
+		directly use it in my system. It's essential that you respond in the json format I have given you.`,
+}
+
+// Data is what a prompt template can refer to.
+type Data struct {
+	Question string
+	Purpose  string
+	// Answers given so far, by purpose
+	Answers map[string]string
+	// Locale is the ISO 639-1 code of the language of the call, Language its
+	// name in English
+	Locale   string
+	Language string
+}
+
+// Version returns the version of the template, or a hash of its text when it
+// doesn't have one.
+func Version(prompt *models.PromptTemplate) string {
+	if prompt.Version != "" {
+		return prompt.Version
+	}
+	sum := sha256.Sum256([]byte(prompt.Text))
+	return "sha256-" + hex.EncodeToString(sum[:6])
+}
+
+// Render executes the template with the data.
+func Render(prompt *models.PromptTemplate, data Data) (string, error) {
+	tmpl, err := parse(prompt)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("error rendering prompt template %s: %w", Version(prompt), err)
+	}
+	return sb.String(), nil
+}
+
+// Validate checks that the template parses and renders. A nil template is
+// valid, the default is used instead.
+func Validate(prompt *models.PromptTemplate) error {
+	if prompt == nil {
+		return nil
+	}
+	if strings.TrimSpace(prompt.Text) == "" {
+		return fmt.Errorf("prompt template %s is empty", Version(prompt))
+	}
+	_, err := Render(prompt, Data{Answers: map[string]string{}})
+	return err
+}
+
+func parse(prompt *models.PromptTemplate) (*template.Template, error) {
+	tmpl, err := template.New(Version(prompt)).Option("missingkey=zero").Parse(prompt.Text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", Version(prompt), err)
+	}
+	return tmpl, nil
+}
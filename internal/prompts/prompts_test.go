@@ -0,0 +1,69 @@
+package prompts
+
+import (
+	"goVoice/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	prompt := &models.PromptTemplate{
+		Version: "v2",
+		Text:    "Validate {{.Purpose}} ({{.Locale}}) for {{.Question}} after {{.Answers.melding}}{{.Answers.onbekend}}",
+	}
+	text, err := Render(prompt, Data{
+		Question: "Wat is uw adres?",
+		Purpose:  "locatie",
+		Answers:  map[string]string{"melding": "losse stoeptegel"},
+		Locale:   "fy",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "Validate locatie (fy) for Wat is uw adres? after losse stoeptegel"
+	if text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+
+	text, err = Render(Default, Data{Language: "Frisian"})
+	if err != nil || !strings.Contains(text, "answers in Frisian") {
+		t.Errorf("Expected the default prompt to name the language, got %q (%v)", text, err)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		prompt   models.PromptTemplate
+		expected string
+	}{
+		{models.PromptTemplate{Version: "v2", Text: "a"}, "v2"},
+		{models.PromptTemplate{Text: "a"}, "sha256-ca978112ca1b"},
+	}
+	for _, test := range tests {
+		if version := Version(&test.prompt); version != test.expected {
+			t.Errorf("Expected version %s, got %s", test.expected, version)
+		}
+	}
+	if Version(&models.PromptTemplate{Text: "a"}) == Version(&models.PromptTemplate{Text: "b"}) {
+		t.Errorf("Expected templates with other text to get other versions")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		prompt *models.PromptTemplate
+		valid  bool
+	}{
+		{nil, true},
+		{Default, true},
+		{&models.PromptTemplate{Text: "{{.Question}}"}, true},
+		{&models.PromptTemplate{Text: " "}, false},
+		{&models.PromptTemplate{Text: "{{.Question"}, false},
+		{&models.PromptTemplate{Text: "{{.Vraag}}"}, false},
+	}
+	for _, test := range tests {
+		if err := Validate(test.prompt); (err == nil) != test.valid {
+			t.Errorf("Expected %+v to be valid: %v, got %v", test.prompt, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package redact keeps personal data out of what is sent to the AI provider.
+// Names, phone numbers, email addresses and BSNs are replaced by placeholders
+// such as [PHONE_1], and the placeholders in the reply are turned back into
+// the original values.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	Name  = "name"
+	Phone = "phone"
+	Email = "email"
+	BSN   = "bsn"
+)
+
+// Kinds are the kinds of personal data that can be redacted, in the order
+// they are looked for.
+var Kinds = []string{Email, Phone, BSN, Name}
+
+// tussenvoegsels are the lowercase parts of Dutch surnames
+const tussenvoegsels = `(?:(?:van|de|der|den|het|ter|ten|te|in|'t|von|la|le|du|da|el)\s+)*`
+
+var patterns = map[string]*regexp.Regexp{
+	Email: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	// 06-12345678, 020 123 4567, +31 (0)20 1234567, 0031 6 1234 5678
+	Phone: regexp.MustCompile(`(?:\+31|\b0031|\b0)(?:\s?\(0\))?(?:[\s-]?\d){9}\b`),
+	// 8 or 9 digits, checked with the elfproef
+	BSN: regexp.MustCompile(`\b\d(?:[\s.]?\d){7,8}\b`),
+	// Names are only recognised when callers introduce themselves, the first
+	// group is the name
+	Name: regexp.MustCompile(`\b(?i:mijn naam is|de naam is|ik heet|ik ben|u spreekt met|my name is|i am|i'm|this is)\s+(` +
+		tussenvoegsels + `\p{Lu}[\p{L}'-]*(?:\s+` + tussenvoegsels + `\p{Lu}[\p{L}'-]*)*)`),
+}
+
+// Validate returns an error for kinds that can't be redacted.
+func Validate(kinds []string) error {
+	for _, kind := range kinds {
+		if _, ok := patterns[kind]; !ok {
+			return fmt.Errorf("unknown kind of personal data to redact: %q, expected one of %s", kind, strings.Join(Kinds, ", "))
+		}
+	}
+	return nil
+}
+
+// A Redactor redacts the texts of a single request to the AI provider and
+// restores its reply, the same value gets the same placeholder throughout.
+// A nil Redactor leaves texts as they are.
+type Redactor struct {
+	kinds   map[string]bool
+	tokens  map[string]string // placeholder by original value
+	values  []string          // placeholders and their original values, for the replacer
+	counts  map[string]int
+	restore *strings.Replacer
+}
+
+// New returns a Redactor for the kinds, or nil when there are none.
+func New(kinds []string) *Redactor {
+	if len(kinds) == 0 {
+		return nil
+	}
+	r := &Redactor{
+		kinds:  make(map[string]bool),
+		tokens: make(map[string]string),
+		counts: make(map[string]int),
+	}
+	for _, kind := range kinds {
+		r.kinds[kind] = true
+	}
+	return r
+}
+
+// Redact replaces the personal data in the text by placeholders.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, kind := range Kinds {
+		if !r.kinds[kind] {
+			continue
+		}
+		text = r.redact(kind, text)
+	}
+	return text
+}
+
+func (r *Redactor) redact(kind string, text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, match := range patterns[kind].FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[0], match[1]
+		if len(match) > 2 {
+			// Only the group is personal data, e.g. the name after "ik heet"
+			start, end = match[2], match[3]
+		}
+		value := text[start:end]
+		if kind == BSN && !elfproef(value) {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(r.token(kind, value))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+func (r *Redactor) token(kind string, value string) string {
+	if token, ok := r.tokens[value]; ok {
+		return token
+	}
+	r.counts[kind]++
+	token := fmt.Sprintf("[%s_%d]", strings.ToUpper(kind), r.counts[kind])
+	r.tokens[value] = token
+	r.values = append(r.values, token, value)
+	r.restore = nil
+	return token
+}
+
+// Restore puts the original values back in place of the placeholders.
+func (r *Redactor) Restore(text string) string {
+	if r == nil || len(r.values) == 0 {
+		return text
+	}
+	if r.restore == nil {
+		r.restore = strings.NewReplacer(r.values...)
+	}
+	return r.restore.Replace(text)
+}
+
+// RestoreStream restores the deltas of a streamed reply before passing them
+// on, holding back a placeholder until it is complete. flush passes on
+// whatever was held back at the end of the stream.
+func (r *Redactor) RestoreStream(onDelta func(delta string)) (write func(delta string), flush func()) {
+	if r == nil {
+		return onDelta, func() {}
+	}
+	var pending string
+	write = func(delta string) {
+		pending += delta
+		text := pending
+		pending = ""
+		if i := strings.LastIndex(text, "["); i >= 0 && !strings.Contains(text[i:], "]") && len(text)-i <= len("[PHONE_999]") {
+			text, pending = text[:i], text[i:]
+		}
+		if text != "" {
+			onDelta(r.Restore(text))
+		}
+	}
+	flush = func() {
+		if pending != "" {
+			onDelta(r.Restore(pending))
+			pending = ""
+		}
+	}
+	return write, flush
+}
+
+// Counts returns the number of values that were redacted by kind.
+func (r *Redactor) Counts() map[string]int {
+	if r == nil {
+		return nil
+	}
+	return r.counts
+}
+
+// Summary describes the counts, e.g. "1 name, 2 phone", for logging.
+func Summary(counts map[string]int) string {
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// elfproef checks the number the way BSNs are checked: 9×d1 + 8×d2 + ... +
+// 2×d8 - d9 must be divisible by 11. 8 digit numbers have a leading zero.
+func elfproef(number string) bool {
+	var digits []int
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) == 8 {
+		digits = append([]int{0}, digits...)
+	}
+	if len(digits) != 9 {
+		return false
+	}
+	sum := 0
+	for i, digit := range digits[:8] {
+		sum += (9 - i) * digit
+	}
+	sum -= digits[8]
+	return sum != 0 && sum%11 == 0
+}
@@ -0,0 +1,78 @@
+package redact
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		kinds    []string
+		text     string
+		redacted string
+		counts   map[string]int
+	}{
+		{"mobile", []string{Phone}, "Bel me op 06-12345678 terug", "Bel me op [PHONE_1] terug", map[string]int{Phone: 1}},
+		{"landline", []string{Phone}, "Mijn nummer is 020 123 4567.", "Mijn nummer is [PHONE_1].", map[string]int{Phone: 1}},
+		{"international", []string{Phone}, "Dat is +31 (0)6 1234 5678 of +31612345678", "Dat is [PHONE_1] of [PHONE_2]", map[string]int{Phone: 2}},
+		{"email", []string{Email}, "Mail naar jan.de.vries@example.nl graag", "Mail naar [EMAIL_1] graag", map[string]int{Email: 1}},
+		{"bsn", []string{BSN}, "Mijn BSN is 111222333, of 1112.22.333", "Mijn BSN is [BSN_1], of [BSN_2]", map[string]int{BSN: 2}},
+		{"not a bsn", []string{BSN}, "Het kenmerk is 123456789", "Het kenmerk is 123456789", map[string]int{}},
+		{"name", []string{Name}, "Goedemiddag, mijn naam is Jan de Vries en ik bel over afval", "Goedemiddag, mijn naam is [NAME_1] en ik bel over afval", map[string]int{Name: 1}},
+		{"surname", []string{Name}, "Ik ben van der Berg", "Ik ben [NAME_1]", map[string]int{Name: 1}},
+		{"not a name", []string{Name}, "Ik ben de buurvrouw", "Ik ben de buurvrouw", map[string]int{}},
+		{"same value", []string{Phone}, "06 12345678, nogmaals 06 12345678", "[PHONE_1], nogmaals [PHONE_1]", map[string]int{Phone: 1}},
+		{"only the kinds", []string{Email}, "Ik heet Piet, 0612345678", "Ik heet Piet, 0612345678", map[string]int{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := New(test.kinds)
+			redacted := r.Redact(test.text)
+			if redacted != test.redacted {
+				t.Errorf("Expected %q, got %q", test.redacted, redacted)
+			}
+			if !reflect.DeepEqual(r.Counts(), test.counts) {
+				t.Errorf("Expected counts %v, got %v", test.counts, r.Counts())
+			}
+			if restored := r.Restore(redacted); restored != test.text {
+				t.Errorf("Expected %q to be restored, got %q", test.text, restored)
+			}
+		})
+	}
+}
+
+func TestRestoreStream(t *testing.T) {
+	r := New(Kinds)
+	r.Redact("Mijn naam is Jan de Vries, bel 0612345678")
+
+	var sb strings.Builder
+	write, flush := r.RestoreStream(func(delta string) { sb.WriteString(delta) })
+	for _, delta := range []string{"Dank u [NA", "ME_1]. Bel", "len we [PHONE_", "1]? Of [", "x"} {
+		write(delta)
+	}
+	flush()
+	if expected := "Dank u Jan de Vries. Bellen we 0612345678? Of [x"; sb.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, sb.String())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]string{Name, BSN}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := Validate([]string{"iban"}); err == nil {
+		t.Error("Expected an unknown kind to be refused")
+	}
+}
+
+func TestNil(t *testing.T) {
+	r := New(nil)
+	if r != nil {
+		t.Fatal("Expected no redactor without kinds")
+	}
+	if text := r.Restore(r.Redact("0612345678")); text != "0612345678" {
+		t.Errorf("Expected the text as it was, got %q", text)
+	}
+}
@@ -0,0 +1,172 @@
+// Package schedule decides whether a ruleset takes calls at a given time,
+// from its weekly opening hours and the exceptions to them.
+package schedule
+
+import (
+	"fmt"
+	"goVoice/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimezone = "Europe/Amsterdam"
+
+// Status is whether the line is open at a time.
+type Status struct {
+	Open bool
+	// Exception is the exception of the day, if any
+	Exception *models.ScheduleException
+}
+
+// Location returns the timezone of the schedule, the default timezone for a
+// nil schedule.
+func Location(schedule *models.Schedule) (*time.Location, error) {
+	name := defaultTimezone
+	if schedule != nil && schedule.Timezone != "" {
+		name = schedule.Timezone
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %w", name, err)
+	}
+	return location, nil
+}
+
+// At returns whether the line is open at the time. A nil schedule is always
+// open.
+func At(schedule *models.Schedule, at time.Time) (Status, error) {
+	if schedule == nil {
+		return Status{Open: true}, nil
+	}
+	location, err := Location(schedule)
+	if err != nil {
+		return Status{Open: true}, err
+	}
+	local := at.In(location)
+	minute := local.Hour()*60 + local.Minute()
+
+	date := local.Format("2006-01-02")
+	for i := range schedule.Exceptions {
+		exception := &schedule.Exceptions[i]
+		if exception.Date != date {
+			continue
+		}
+		if exception.Open == "" && exception.Close == "" {
+			return Status{Exception: exception}, nil
+		}
+		open, err := within(exception.Open, exception.Close, minute)
+		return Status{Open: open, Exception: exception}, err
+	}
+
+	if len(schedule.Hours) == 0 {
+		return Status{Open: true}, nil
+	}
+	day := strings.ToLower(local.Weekday().String())
+	for _, hours := range schedule.Hours {
+		if !containsDay(hours.Days, day) {
+			continue
+		}
+		open, err := within(hours.Open, hours.Close, minute)
+		if err != nil || open {
+			return Status{Open: open}, err
+		}
+	}
+	return Status{}, nil
+}
+
+// ClosedSteps returns the steps for calls while the line is closed, those of
+// the exception with the date when it has any.
+func ClosedSteps(schedule *models.Schedule, date string) []models.ConversationStep {
+	for _, exception := range schedule.Exceptions {
+		if exception.Date == date && date != "" && len(exception.Steps) > 0 {
+			return exception.Steps
+		}
+	}
+	return schedule.ClosedSteps
+}
+
+// Validate checks the schedule of a ruleset before it is stored, so mistakes
+// don't surface as calls that are answered at the wrong time.
+func Validate(schedule *models.Schedule) error {
+	if schedule == nil {
+		return nil
+	}
+	if _, err := Location(schedule); err != nil {
+		return err
+	}
+	if len(schedule.ClosedSteps) == 0 {
+		return fmt.Errorf("schedule has no closed steps")
+	}
+	for _, hours := range schedule.Hours {
+		for _, day := range hours.Days {
+			if !isDay(day) {
+				return fmt.Errorf("unknown day %q in schedule", day)
+			}
+		}
+		if _, err := within(hours.Open, hours.Close, 0); err != nil {
+			return err
+		}
+	}
+	for _, exception := range schedule.Exceptions {
+		if _, err := time.Parse("2006-01-02", exception.Date); err != nil {
+			return fmt.Errorf("invalid date %q in schedule exception %s", exception.Date, exception.Name)
+		}
+		if exception.Open == "" && exception.Close == "" {
+			continue
+		}
+		if _, err := within(exception.Open, exception.Close, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// within tells whether the minute of the day is between the open and close
+// times.
+func within(open string, close string, minute int) (bool, error) {
+	from, err := parseTime(open)
+	if err != nil {
+		return false, err
+	}
+	until, err := parseTime(close)
+	if err != nil {
+		return false, err
+	}
+	if until <= from {
+		return false, fmt.Errorf("closing time %s is not after opening time %s", close, open)
+	}
+	return minute >= from && minute < until, nil
+}
+
+// parseTime returns the minute of the day of a HH:MM time.
+func parseTime(clock string) (int, error) {
+	hours, minutes, ok := strings.Cut(clock, ":")
+	h, err := strconv.Atoi(hours)
+	if !ok || err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("invalid time %q in schedule, expected HH:MM", clock)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || len(minutes) != 2 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q in schedule, expected HH:MM", clock)
+	}
+	return h*60 + m, nil
+}
+
+func isDay(day string) bool {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.ToLower(weekday.String()) == strings.ToLower(day) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDay(days []string, day string) bool {
+	for _, d := range days {
+		if strings.ToLower(d) == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"goVoice/internal/models"
+	"testing"
+	"time"
+)
+
+func officeHours() *models.Schedule {
+	return &models.Schedule{
+		Hours: []models.OpeningHours{
+			{Days: []string{"monday", "tuesday", "wednesday", "thursday", "friday"}, Open: "08:30", Close: "12:00"},
+			{Days: []string{"monday", "tuesday", "wednesday", "thursday", "friday"}, Open: "13:00", Close: "17:00"},
+		},
+		Exceptions: []models.ScheduleException{
+			{Date: "2026-12-25", Name: "Eerste kerstdag", Steps: []models.ConversationStep{{Text: "Fijne kerstdagen"}}},
+			{Date: "2026-12-24", Name: "Kerstavond", Open: "08:30", Close: "15:00"},
+		},
+		ClosedSteps: []models.ConversationStep{{Text: "We zijn gesloten"}},
+	}
+}
+
+func TestAt(t *testing.T) {
+	amsterdam, _ := time.LoadLocation("Europe/Amsterdam")
+	tests := []struct {
+		name      string
+		at        time.Time
+		open      bool
+		exception string
+	}{
+		{"monday morning", time.Date(2026, 10, 19, 9, 0, 0, 0, amsterdam), true, ""},
+		{"lunch break", time.Date(2026, 10, 19, 12, 30, 0, 0, amsterdam), false, ""},
+		{"closing time", time.Date(2026, 10, 19, 17, 0, 0, 0, amsterdam), false, ""},
+		{"saturday", time.Date(2026, 10, 24, 10, 0, 0, 0, amsterdam), false, ""},
+		{"utc in opening hours", time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC), true, ""},
+		{"christmas", time.Date(2026, 12, 25, 10, 0, 0, 0, amsterdam), false, "2026-12-25"},
+		{"christmas eve morning", time.Date(2026, 12, 24, 14, 0, 0, 0, amsterdam), true, "2026-12-24"},
+		{"christmas eve afternoon", time.Date(2026, 12, 24, 16, 0, 0, 0, amsterdam), false, "2026-12-24"},
+	}
+
+	for _, test := range tests {
+		status, err := At(officeHours(), test.at)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if status.Open != test.open {
+			t.Errorf("%s: expected open to be %v", test.name, test.open)
+		}
+		exception := ""
+		if status.Exception != nil {
+			exception = status.Exception.Date
+		}
+		if exception != test.exception {
+			t.Errorf("%s: expected exception %q, got %q", test.name, test.exception, exception)
+		}
+	}
+
+	if status, _ := At(nil, time.Now()); !status.Open {
+		t.Errorf("Expected a line without schedule to be open")
+	}
+}
+
+func TestClosedSteps(t *testing.T) {
+	schedule := officeHours()
+	if steps := ClosedSteps(schedule, "2026-12-25"); steps[0].Text != "Fijne kerstdagen" {
+		t.Errorf("Expected the steps of the exception, got %v", steps)
+	}
+	if steps := ClosedSteps(schedule, "2026-12-24"); steps[0].Text != "We zijn gesloten" {
+		t.Errorf("Expected the closed steps for an exception without steps, got %v", steps)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(officeHours()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	tests := []func(*models.Schedule){
+		func(s *models.Schedule) { s.Timezone = "Europe/Leeuwarden" },
+		func(s *models.Schedule) { s.Hours[0].Days[0] = "maandag" },
+		func(s *models.Schedule) { s.Hours[0].Close = "8:00" },
+		func(s *models.Schedule) { s.Hours[0].Open = "25:00" },
+		func(s *models.Schedule) { s.Exceptions[0].Date = "25-12-2026" },
+		func(s *models.Schedule) { s.ClosedSteps = nil },
+	}
+	for i, breakSchedule := range tests {
+		schedule := officeHours()
+		breakSchedule(schedule)
+		if err := Validate(schedule); err == nil {
+			t.Errorf("Expected schedule %d to be invalid", i)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package webhook delivers the results of calls to the HTTPS endpoints the
+// clients of a ruleset registered.
+//
+// Every delivery is a POST with the json payload as body and these headers:
+//
+//	X-GoVoice-Event:     the event, e.g. call.completed
+//	X-GoVoice-Delivery:  id of the delivery, the same on every retry
+//	X-GoVoice-Signature: t=<unix timestamp>,v1=<hex hmac>
+//
+// The hmac is HMAC-SHA256 with the secret of the webhook over the timestamp,
+// a dot and the body. Receivers should recompute it and reject requests with
+// an old timestamp.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"goVoice/internal/models"
+	"goVoice/pkg/db"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/google/uuid"
+)
+
+const (
+	EventCallCompleted = "call.completed"
+
+	defaultAttempts = 5
+	defaultDelay    = 2 * time.Second
+	requestTimeout  = 10 * time.Second
+)
+
+type Deliverer struct {
+	DB     db.DbProvider
+	Client *http.Client
+	// Attempts before a delivery ends up in the dead letters, with a delay
+	// that doubles after every attempt
+	Attempts uint
+	Delay    time.Duration
+}
+
+func NewDeliverer(dbHandler db.DbProvider) *Deliverer {
+	return &Deliverer{
+		DB:       dbHandler,
+		Client:   &http.Client{Timeout: requestTimeout},
+		Attempts: defaultAttempts,
+		Delay:    defaultDelay,
+	}
+}
+
+// Sign returns the signature header of the body sent at the timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Validate checks that the webhook can be delivered to.
+func Validate(hook models.Webhook) error {
+	endpoint, err := url.Parse(hook.URL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url %q: %w", hook.URL, err)
+	}
+	if endpoint.Scheme != "https" || endpoint.Host == "" {
+		return fmt.Errorf("webhook url %q is not an https url", hook.URL)
+	}
+	if hook.Secret == "" {
+		return fmt.Errorf("webhook %s has no secret", hook.URL)
+	}
+	return nil
+}
+
+// DeliverAll sends the result to every webhook of the ruleset. Deliveries
+// that keep failing are stored as dead letters.
+func (d *Deliverer) DeliverAll(ctx context.Context, rules *models.ConversationRuleSet, result *models.CallResult) {
+	if len(rules.Webhooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Error marshaling call result of %s: %v", result.ConversationID, err)
+		return
+	}
+	for _, hook := range rules.Webhooks {
+		deadLetter := &models.DeadLetter{
+			ID:             uuid.NewString(),
+			RulesetID:      rules.ID,
+			ConversationID: result.ConversationID,
+			URL:            hook.URL,
+			Payload:        string(payload),
+			CreatedAt:      time.Now(),
+		}
+		if err := d.deliver(ctx, hook, deadLetter); err != nil {
+			log.Printf("Giving up delivering %s to %s, storing it as dead letter: %v", result.ConversationID, hook.URL, err)
+			if err := d.DB.AddDeadLetter(ctx, rules.ID, deadLetter); err != nil {
+				log.Printf("Error storing dead letter of %s: %v", result.ConversationID, err)
+			}
+		}
+	}
+}
+
+// Redeliver tries to deliver a dead letter again. It is removed once it is
+// delivered, otherwise it is updated with the new error.
+func (d *Deliverer) Redeliver(ctx context.Context, rulesetID string, deadLetterID string) error {
+	deadLetter, err := d.DB.GetDeadLetter(ctx, rulesetID, deadLetterID)
+	if err != nil {
+		return err
+	}
+	rules, err := d.DB.GetRuleSet(ctx, rulesetID)
+	if err != nil {
+		return err
+	}
+	// The secret isn't stored with the dead letter, so redelivering only
+	// works while the endpoint is still registered.
+	var hook *models.Webhook
+	for i := range rules.Webhooks {
+		if rules.Webhooks[i].URL == deadLetter.URL {
+			hook = &rules.Webhooks[i]
+		}
+	}
+	if hook == nil {
+		return fmt.Errorf("webhook %s is no longer registered for ruleset %s", deadLetter.URL, rulesetID)
+	}
+
+	if err := d.deliver(ctx, *hook, deadLetter); err != nil {
+		if err := d.DB.AddDeadLetter(ctx, rulesetID, deadLetter); err != nil {
+			log.Printf("Error updating dead letter %s: %v", deadLetterID, err)
+		}
+		return err
+	}
+	return d.DB.DeleteDeadLetter(ctx, rulesetID, deadLetterID)
+}
+
+// deliver posts the payload of the dead letter with retries, keeping track
+// of the attempts and the last error on it.
+func (d *Deliverer) deliver(ctx context.Context, hook models.Webhook, deadLetter *models.DeadLetter) error {
+	if err := Validate(hook); err != nil {
+		deadLetter.Error = err.Error()
+		return err
+	}
+	err := retry.Do(
+		func() error {
+			deadLetter.Attempts++
+			deadLetter.LastAttemptAt = time.Now()
+			err := d.post(ctx, hook, deadLetter.ID, []byte(deadLetter.Payload))
+			if err != nil {
+				log.Printf("Error delivering %s to %s: %v", deadLetter.ConversationID, hook.URL, err)
+				deadLetter.Error = err.Error()
+			}
+			return err
+		},
+		retry.Context(ctx),
+		retry.Attempts(d.Attempts),
+		retry.Delay(d.Delay),
+		retry.DelayType(retry.BackOffDelay),
+		retry.LastErrorOnly(true),
+	)
+	return err
+}
+
+func (d *Deliverer) post(ctx context.Context, hook models.Webhook, deliveryID string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return retry.Unrecoverable(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GoVoice-Event", EventCallCompleted)
+	req.Header.Set("X-GoVoice-Delivery", deliveryID)
+	req.Header.Set("X-GoVoice-Signature", Sign(hook.Secret, time.Now().Unix(), payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("received %d status code", resp.StatusCode)
+	default:
+		// The receiver rejected the payload, sending it again won't help
+		return retry.Unrecoverable(fmt.Errorf("received %d status code", resp.StatusCode))
+	}
+}
@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"goVoice/pkg/db/memory"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	signature := Sign("geheim", 1700000000, []byte(`{"event":"call.completed"}`))
+	expected := "t=1700000000,v1=801296280495df354b925857909deeca3f9fdbca8fc54219b9375805a27ffa47"
+	if signature != expected {
+		t.Errorf("Expected signature %q, got %q", expected, signature)
+	}
+	if signature == Sign("anders", 1700000000, []byte(`{"event":"call.completed"}`)) {
+		t.Errorf("Signing with another secret gives the same signature")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		hook  models.Webhook
+		valid bool
+	}{
+		{models.Webhook{URL: "https://example.com/hook", Secret: "geheim"}, true},
+		{models.Webhook{URL: "http://example.com/hook", Secret: "geheim"}, false},
+		{models.Webhook{URL: "https://example.com/hook"}, false},
+		{models.Webhook{URL: "://", Secret: "geheim"}, false},
+	}
+	for _, test := range tests {
+		if err := Validate(test.hook); (err == nil) != test.valid {
+			t.Errorf("Validate(%q): expected valid %v, got %v", test.hook.URL, test.valid, err)
+		}
+	}
+}
+
+// setup returns a deliverer posting to a test server that answers with the
+// given status codes in turn, and the ruleset registering it.
+func setup(t *testing.T, statuses ...int) (*Deliverer, *models.ConversationRuleSet, *int32) {
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(r.Header.Get("X-GoVoice-Signature"), ",")[0], "t="), 10, 64)
+		if r.Header.Get("X-GoVoice-Signature") != Sign("geheim", timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		status := statuses[len(statuses)-1]
+		if int(n) <= len(statuses) {
+			status = statuses[n-1]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	db := memory.NewClient()
+	rules := &models.ConversationRuleSet{
+		ID:       "test",
+		Webhooks: []models.Webhook{{URL: server.URL, Secret: "geheim"}},
+	}
+	db.AddRuleset(context.Background(), rules)
+	return &Deliverer{
+		DB:       db,
+		Client:   server.Client(),
+		Attempts: 3,
+		Delay:    time.Millisecond,
+	}, rules, &calls
+}
+
+func TestDeliverAllRetries(t *testing.T) {
+	deliverer, rules, calls := setup(t, http.StatusServiceUnavailable, http.StatusOK)
+
+	deliverer.DeliverAll(context.Background(), rules, &models.CallResult{ConversationID: "call"})
+
+	if *calls != 2 {
+		t.Errorf("Expected 2 deliveries, got %d", *calls)
+	}
+	deadLetters, _ := deliverer.DB.GetDeadLetters(context.Background(), rules.ID)
+	if len(deadLetters) != 0 {
+		t.Errorf("Expected no dead letters, got %v", deadLetters)
+	}
+}
+
+func TestDeliverAllDeadLetters(t *testing.T) {
+	deliverer, rules, calls := setup(t, http.StatusInternalServerError)
+
+	deliverer.DeliverAll(context.Background(), rules, &models.CallResult{ConversationID: "call"})
+
+	if *calls != 3 {
+		t.Errorf("Expected 3 deliveries, got %d", *calls)
+	}
+	deadLetters, _ := deliverer.DB.GetDeadLetters(context.Background(), rules.ID)
+	if len(deadLetters) != 1 {
+		t.Fatalf("Expected a dead letter, got %v", deadLetters)
+	}
+	if deadLetters[0].Attempts != 3 || deadLetters[0].Error != "received 500 status code" {
+		t.Errorf("Unexpected dead letter %+v", deadLetters[0])
+	}
+}
+
+func TestDeliverAllGivesUpOnRejection(t *testing.T) {
+	deliverer, rules, calls := setup(t, http.StatusBadRequest)
+
+	deliverer.DeliverAll(context.Background(), rules, &models.CallResult{ConversationID: "call"})
+
+	if *calls != 1 {
+		t.Errorf("Expected a rejected delivery not to be retried, got %d deliveries", *calls)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	deliverer, rules, _ := setup(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	ctx := context.Background()
+
+	deliverer.DeliverAll(ctx, rules, &models.CallResult{ConversationID: "call"})
+	deadLetters, _ := deliverer.DB.GetDeadLetters(ctx, rules.ID)
+	if len(deadLetters) != 1 {
+		t.Fatalf("Expected a dead letter, got %v", deadLetters)
+	}
+
+	if err := deliverer.Redeliver(ctx, rules.ID, deadLetters[0].ID); err != nil {
+		t.Fatalf("Expected the redelivery to succeed, got %v", err)
+	}
+	deadLetters, _ = deliverer.DB.GetDeadLetters(ctx, rules.ID)
+	if len(deadLetters) != 0 {
+		t.Errorf("Expected the dead letter to be removed, got %v", deadLetters)
+	}
+}
@@ -0,0 +1,221 @@
+// Package zgw creates cases (zaken) for reported calls in the ZGW
+// (Zaakgericht Werken) APIs Dutch municipalities run their case systems on.
+// A call becomes a zaak in the Zaken API with its transcript as document in
+// the Documenten API, linked to the zaak.
+package zgw
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVoice/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// System is the key of the zaak identificatie in the external references of
+// a conversation.
+const System = "zgw"
+
+const (
+	requestTimeout     = 15 * time.Second
+	userRepresentation = "goVoice"
+	// Dutch, as ISO 639-2/B code
+	documentLanguage = "dut"
+)
+
+type Client struct {
+	HTTP *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{HTTP: &http.Client{Timeout: requestTimeout}}
+}
+
+// Case is what is filed about a call.
+type Case struct {
+	Omschrijving string // short description, at most 80 characters
+	Toelichting  string
+	Category     string // category of the call summary, picks the zaaktype
+	Document     Document
+}
+
+type Document struct {
+	Titel         string
+	Bestandsnaam  string
+	Inhoud        []byte
+	Formaat       string
+	Creatiedatum  time.Time
+	Vertrouwelijk bool
+}
+
+type zaak struct {
+	URL                          string `json:"url,omitempty"`
+	Identificatie                string `json:"identificatie,omitempty"`
+	Bronorganisatie              string `json:"bronorganisatie"`
+	Omschrijving                 string `json:"omschrijving"`
+	Toelichting                  string `json:"toelichting,omitempty"`
+	Zaaktype                     string `json:"zaaktype"`
+	VerantwoordelijkeOrganisatie string `json:"verantwoordelijkeOrganisatie"`
+	Startdatum                   string `json:"startdatum"`
+}
+
+type informatieobject struct {
+	URL                         string `json:"url,omitempty"`
+	Bronorganisatie             string `json:"bronorganisatie"`
+	Creatiedatum                string `json:"creatiedatum"`
+	Titel                       string `json:"titel"`
+	Auteur                      string `json:"auteur"`
+	Taal                        string `json:"taal"`
+	Bestandsnaam                string `json:"bestandsnaam"`
+	Formaat                     string `json:"formaat"`
+	Inhoud                      string `json:"inhoud"`
+	Informatieobjecttype        string `json:"informatieobjecttype"`
+	Vertrouwelijkheidaanduiding string `json:"vertrouwelijkheidaanduiding,omitempty"`
+}
+
+type zaakinformatieobject struct {
+	Zaak             string `json:"zaak"`
+	Informatieobject string `json:"informatieobject"`
+}
+
+// Token returns the JWT the ZGW APIs expect, signed with HS256 using the
+// credentials the client issued.
+func Token(clientID string, secret string, issuedAt time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":                 clientID,
+		"iat":                 issuedAt.Unix(),
+		"client_id":           clientID,
+		"user_id":             clientID,
+		"user_representation": userRepresentation,
+	})
+	unsigned := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encode(mac.Sum(nil))
+}
+
+// CreateCase creates the zaak, adds the document to it and returns the
+// identificatie of the zaak. When adding the document fails the zaak still
+// exists, so its identificatie is returned along with the error.
+func (c *Client) CreateCase(ctx context.Context, config *models.ZGWConfig, filed *Case) (string, error) {
+	zaaktype := config.Zaaktype
+	if t, ok := config.Zaaktypes[filed.Category]; ok {
+		zaaktype = t
+	}
+	if zaaktype == "" {
+		return "", errors.New("no zaaktype for the call")
+	}
+	verantwoordelijke := config.VerantwoordelijkeOrganisatie
+	if verantwoordelijke == "" {
+		verantwoordelijke = config.Bronorganisatie
+	}
+
+	var created zaak
+	err := c.post(ctx, config, strings.TrimSuffix(config.ZakenURL, "/")+"/zaken", &zaak{
+		Bronorganisatie:              config.Bronorganisatie,
+		Omschrijving:                 truncate(filed.Omschrijving, 80),
+		Toelichting:                  filed.Toelichting,
+		Zaaktype:                     zaaktype,
+		VerantwoordelijkeOrganisatie: verantwoordelijke,
+		Startdatum:                   filed.Document.Creatiedatum.Format("2006-01-02"),
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("error creating zaak: %w", err)
+	}
+
+	document := filed.Document
+	vertrouwelijkheid := ""
+	if document.Vertrouwelijk {
+		vertrouwelijkheid = "vertrouwelijk"
+	}
+	var object informatieobject
+	err = c.post(ctx, config, strings.TrimSuffix(config.DocumentenURL, "/")+"/enkelvoudiginformatieobjecten", &informatieobject{
+		Bronorganisatie:             config.Bronorganisatie,
+		Creatiedatum:                document.Creatiedatum.Format("2006-01-02"),
+		Titel:                       document.Titel,
+		Auteur:                      userRepresentation,
+		Taal:                        documentLanguage,
+		Bestandsnaam:                document.Bestandsnaam,
+		Formaat:                     document.Formaat,
+		Inhoud:                      base64.StdEncoding.EncodeToString(document.Inhoud),
+		Informatieobjecttype:        config.Informatieobjecttype,
+		Vertrouwelijkheidaanduiding: vertrouwelijkheid,
+	}, &object)
+	if err != nil {
+		return created.Identificatie, fmt.Errorf("error creating document for zaak %s: %w", created.Identificatie, err)
+	}
+
+	err = c.post(ctx, config, strings.TrimSuffix(config.ZakenURL, "/")+"/zaakinformatieobjecten", &zaakinformatieobject{
+		Zaak:             created.URL,
+		Informatieobject: object.URL,
+	}, nil)
+	if err != nil {
+		return created.Identificatie, fmt.Errorf("error adding document to zaak %s: %w", created.Identificatie, err)
+	}
+	return created.Identificatie, nil
+}
+
+func (c *Client) post(ctx context.Context, config *models.ZGWConfig, url string, body interface{}, reply interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Error creating ZGW request: %v", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+Token(config.ClientID, config.Secret, time.Now()))
+	// The Zaken API requires the coordinate system even without a location
+	req.Header.Set("Accept-Crs", "EPSG:4326")
+	req.Header.Set("Content-Crs", "EPSG:4326")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Errors are problem details, the title says what went wrong
+		var problem struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(data, &problem) == nil && problem.Title != "" {
+			return fmt.Errorf("%s replied %d: %s %s", url, resp.StatusCode, problem.Title, problem.Detail)
+		}
+		return fmt.Errorf("%s replied with %d status code", url, resp.StatusCode)
+	}
+	if reply == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, reply); err != nil {
+		return fmt.Errorf("error unmarshaling reply of %s: %w", url, err)
+	}
+	return nil
+}
+
+func truncate(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	return string(runes[:maxLength-1]) + "…"
+}
@@ -0,0 +1,159 @@
+package zgw
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"goVoice/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+	token := Token("govoice", "geheim", time.Unix(1700000000, 0))
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a JWT of three parts, got %q", token)
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("Claims aren't base64url: %v", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(claims, &decoded)
+	if decoded["client_id"] != "govoice" || decoded["iat"] != float64(1700000000) {
+		t.Errorf("Unexpected claims %s", claims)
+	}
+	if token == Token("govoice", "anders", time.Unix(1700000000, 0)) {
+		t.Errorf("Signing with another secret gives the same token")
+	}
+}
+
+// zgwServer fakes the Zaken and Documenten APIs, rejecting requests that
+// aren't signed with the secret.
+func zgwServer(t *testing.T, failDocuments bool) (*httptest.Server, map[string][]map[string]interface{}) {
+	received := map[string][]map[string]interface{}{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 || !strings.HasSuffix(Token("govoice", "geheim", issuedAt(t, parts[1])), parts[2]) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received[r.URL.Path] = append(received[r.URL.Path], body)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/zaken/api/v1/zaken":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"url": server.URL + "/zaken/api/v1/zaken/1", "identificatie": "ZAAK-2026-0000000001"})
+		case "/documenten/api/v1/enkelvoudiginformatieobjecten":
+			if failDocuments {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"title": "Invalid input.", "detail": "informatieobjecttype is required"})
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"url": server.URL + "/documenten/api/v1/enkelvoudiginformatieobjecten/1"})
+		case "/zaken/api/v1/zaakinformatieobjecten":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func issuedAt(t *testing.T, claims string) time.Time {
+	data, _ := base64.RawURLEncoding.DecodeString(claims)
+	var decoded struct {
+		IAT int64 `json:"iat"`
+	}
+	json.Unmarshal(data, &decoded)
+	return time.Unix(decoded.IAT, 0)
+}
+
+func config(server *httptest.Server) *models.ZGWConfig {
+	return &models.ZGWConfig{
+		ZakenURL:             server.URL + "/zaken/api/v1",
+		DocumentenURL:        server.URL + "/documenten/api/v1/",
+		Zaaktype:             "https://catalogi.example.nl/zaaktypen/melding",
+		Zaaktypes:            map[string]string{"afval": "https://catalogi.example.nl/zaaktypen/afval"},
+		Informatieobjecttype: "https://catalogi.example.nl/informatieobjecttypen/transcript",
+		Bronorganisatie:      "002220647",
+		ClientID:             "govoice",
+		Secret:               "geheim",
+	}
+}
+
+func filed() *Case {
+	return &Case{
+		Omschrijving: "Afval naast de container",
+		Category:     "afval",
+		Document: Document{
+			Titel:        "Transcript",
+			Bestandsnaam: "transcript.txt",
+			Inhoud:       []byte("Beller: er ligt afval"),
+			Formaat:      "text/plain",
+			Creatiedatum: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestCreateCase(t *testing.T) {
+	server, received := zgwServer(t, false)
+	client := &Client{HTTP: server.Client()}
+
+	identificatie, err := client.CreateCase(context.Background(), config(server), filed())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if identificatie != "ZAAK-2026-0000000001" {
+		t.Errorf("Unexpected identificatie %q", identificatie)
+	}
+
+	zaak := received["/zaken/api/v1/zaken"][0]
+	if zaak["zaaktype"] != "https://catalogi.example.nl/zaaktypen/afval" || zaak["verantwoordelijkeOrganisatie"] != "002220647" || zaak["startdatum"] != "2026-10-19" {
+		t.Errorf("Unexpected zaak %v", zaak)
+	}
+	document := received["/documenten/api/v1/enkelvoudiginformatieobjecten"][0]
+	if document["inhoud"] != base64.StdEncoding.EncodeToString([]byte("Beller: er ligt afval")) {
+		t.Errorf("Unexpected document %v", document)
+	}
+	link := received["/zaken/api/v1/zaakinformatieobjecten"][0]
+	if link["zaak"] != server.URL+"/zaken/api/v1/zaken/1" || link["informatieobject"] != server.URL+"/documenten/api/v1/enkelvoudiginformatieobjecten/1" {
+		t.Errorf("Unexpected link %v", link)
+	}
+}
+
+func TestCreateCaseDocumentFails(t *testing.T) {
+	server, _ := zgwServer(t, true)
+	client := &Client{HTTP: server.Client()}
+
+	identificatie, err := client.CreateCase(context.Background(), config(server), filed())
+	if err == nil || !strings.Contains(err.Error(), "informatieobjecttype is required") {
+		t.Errorf("Expected the problem of the server, got %v", err)
+	}
+	if identificatie != "ZAAK-2026-0000000001" {
+		t.Errorf("Expected the identificatie of the zaak that was created, got %q", identificatie)
+	}
+}
+
+func TestCreateCaseUnauthorized(t *testing.T) {
+	server, _ := zgwServer(t, false)
+	client := &Client{HTTP: server.Client()}
+	cfg := config(server)
+	cfg.Secret = "anders"
+
+	if _, err := client.CreateCase(context.Background(), cfg, filed()); err == nil {
+		t.Errorf("Expected an error with the wrong secret")
+	}
+}
@@ -1,16 +1,169 @@
 package ai
 
 import (
+	"context"
+	"fmt"
 	"goVoice/internal/config"
-	// "goVoice/pkg/ai/openAI"
+	"goVoice/pkg/ai/chat"
+	"goVoice/pkg/ai/failover"
+	"goVoice/pkg/ai/openAI"
 	"goVoice/pkg/ai/privateOpenAI"
 )
 
+const (
+	ProviderAzure  = "azure"
+	ProviderOpenAI = "openai"
+	// ProviderCompatible is a server with an OpenAI compatible API, such as
+	// llama.cpp or Ollama
+	ProviderCompatible = "compatible"
+)
+
+// AIProvider completes chats. Requests can hold a whole dialogue, ask for
+// json matching a schema and offer tools for the model to call.
 type AIProvider interface {
-	GetSimpleChatCompletion(system string, text string) (string, error)
+	GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error)
+}
+
+// StreamingProvider is an AIProvider that hands out the content of a response
+// while it is generated, by calling onDelta with every piece of it in order.
+type StreamingProvider interface {
+	AIProvider
+	StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error)
+}
+
+// Stream streams the response when the provider can, and otherwise hands out
+// the whole content at once when it is complete. Streamed responses the
+// provider doesn't count the tokens of get an estimate.
+func Stream(ctx context.Context, provider AIProvider, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	if streaming, ok := provider.(StreamingProvider); ok {
+		response, err := streaming.StreamChatCompletion(ctx, request, onDelta)
+		if err != nil {
+			return nil, err
+		}
+		if response.Usage.TotalTokens == 0 {
+			response.Usage = chat.EstimateUsage(request, response.Content)
+		}
+		return response, nil
+	}
+	response, err := provider.GetChatCompletion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Content != "" {
+		onDelta(response.Content)
+	}
+	return response, nil
+}
+
+// Router sends requests to the provider they name, or to the default
+// provider when they don't name one.
+type Router struct {
+	Default AIProvider
+	Named   map[string]AIProvider
+}
+
+func (r *Router) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	if request.Provider == "" {
+		return r.Default.GetChatCompletion(ctx, request)
+	}
+	provider, ok := r.Named[request.Provider]
+	if !ok {
+		// Never fall back to the default, the ruleset may have picked the
+		// provider to keep its calls on-prem.
+		return nil, fmt.Errorf("unknown AI provider %q", request.Provider)
+	}
+	return provider.GetChatCompletion(ctx, request)
+}
+
+func (r *Router) StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	if request.Provider == "" {
+		return Stream(ctx, r.Default, request, onDelta)
+	}
+	provider, ok := r.Named[request.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown AI provider %q", request.Provider)
+	}
+	return Stream(ctx, provider, request, onDelta)
 }
 
-func InitiateAIProvider (cfg *config.Config) (AIProvider, error) {
-	// provider := openAI.NewOpenAIHandler(cfg.OpenAIKey)
-	return privateOpenAI.NewOpenAIHandler(cfg.OpenAIKey, cfg.OpenAIEndpoint, cfg.OpenAIDeploymentName)
-}
\ No newline at end of file
+// InitiateAIProvider creates the AI provider of the config, along with the
+// named providers rulesets can pick.
+func InitiateAIProvider(cfg *config.Config) (AIProvider, error) {
+	provider := cfg.AIProvider
+	if provider == "" {
+		provider = ProviderAzure
+	}
+	defaultProvider, err := NewProvider(config.AIProviderConfig{
+		Provider: provider,
+		Model:    cfg.AIModel,
+		BaseURL:  cfg.AIBaseURL,
+		Key:      cfg.OpenAIKey,
+	}, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.AIProviders) == 0 {
+		return defaultProvider, nil
+	}
+
+	router := &Router{Default: defaultProvider, Named: map[string]AIProvider{}}
+	for name, settings := range cfg.AIProviders {
+		named, err := NewProvider(settings, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating AI provider %s: %w", name, err)
+		}
+		router.Named[name] = named
+	}
+	if len(cfg.AIFailover) > 0 {
+		chain, err := failoverChain(provider, router, cfg)
+		if err != nil {
+			return nil, err
+		}
+		router.Default = chain
+	}
+	return router, nil
+}
+
+// failoverChain chains the default provider with the named providers of
+// AI_FAILOVER. Only requests for the default provider fail over, a ruleset
+// that picked a provider keeps using that one.
+func failoverChain(defaultName string, router *Router, cfg *config.Config) (*failover.Chain, error) {
+	chain := failover.New(&failover.Backend{Name: defaultName, Provider: router.Default})
+	for _, name := range cfg.AIFailover {
+		named, ok := router.Named[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown AI provider %q in AI_FAILOVER", name)
+		}
+		chain.Backends = append(chain.Backends, &failover.Backend{Name: name, Provider: named})
+	}
+	if cfg.AITimeout > 0 {
+		chain.Timeout = cfg.AITimeout
+	}
+	return chain, nil
+}
+
+// NewProvider creates a provider. Azure uses the endpoint and deployment of
+// the config unless the settings have a base URL and model.
+func NewProvider(settings config.AIProviderConfig, cfg *config.Config) (AIProvider, error) {
+	switch settings.Provider {
+	case ProviderAzure:
+		endpoint := cfg.OpenAIEndpoint
+		if settings.BaseURL != "" {
+			endpoint = settings.BaseURL
+		}
+		deployment := cfg.OpenAIDeploymentName
+		if settings.Model != "" {
+			deployment = settings.Model
+		}
+		return privateOpenAI.NewOpenAIHandler(settings.Key, endpoint, deployment)
+	case ProviderOpenAI:
+		return openAI.NewOpenAIHandler(settings.Key, "", settings.Model), nil
+	case ProviderCompatible:
+		if settings.BaseURL == "" {
+			return nil, fmt.Errorf("the %s AI provider needs a base URL", ProviderCompatible)
+		}
+		return openAI.NewOpenAIHandler(settings.Key, settings.BaseURL, settings.Model), nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q, use %s, %s or %s", settings.Provider, ProviderAzure, ProviderOpenAI, ProviderCompatible)
+	}
+}
@@ -0,0 +1,96 @@
+package ai
+
+import (
+	"context"
+	"goVoice/internal/config"
+	"goVoice/pkg/ai/chat"
+	"testing"
+)
+
+type namedProvider string
+
+func (p namedProvider) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	return &chat.Response{Content: string(p)}, nil
+}
+
+func TestRouter(t *testing.T) {
+	router := &Router{
+		Default: namedProvider("azure"),
+		Named:   map[string]AIProvider{"onprem": namedProvider("onprem")},
+	}
+
+	tests := []struct {
+		provider string
+		expected string
+	}{
+		{"", "azure"},
+		{"onprem", "onprem"},
+	}
+	for _, test := range tests {
+		response, err := router.GetChatCompletion(context.Background(), &chat.Request{Provider: test.provider})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if response.Content != test.expected {
+			t.Errorf("Expected provider %q to go to %s, got %s", test.provider, test.expected, response.Content)
+		}
+	}
+
+	if _, err := router.GetChatCompletion(context.Background(), &chat.Request{Provider: "elders"}); err == nil {
+		t.Errorf("Expected an unknown provider to fail instead of falling back to the default")
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	cfg := &config.Config{}
+	valid := []config.AIProviderConfig{
+		{Provider: ProviderOpenAI, Key: "sk-test"},
+		{Provider: ProviderCompatible, BaseURL: "http://localhost:11434/v1", Model: "llama3"},
+	}
+	for _, settings := range valid {
+		if _, err := NewProvider(settings, cfg); err != nil {
+			t.Errorf("Unexpected error for %+v: %v", settings, err)
+		}
+	}
+
+	invalid := []config.AIProviderConfig{
+		{Provider: ProviderCompatible, Model: "llama3"},
+		{Provider: "watson"},
+	}
+	for _, settings := range invalid {
+		if _, err := NewProvider(settings, cfg); err == nil {
+			t.Errorf("Expected an error for %+v", settings)
+		}
+	}
+}
+
+func TestFailoverChain(t *testing.T) {
+	router := &Router{
+		Default: namedProvider("azure"),
+		Named:   map[string]AIProvider{"onprem": namedProvider("onprem")},
+	}
+	chain, err := failoverChain(ProviderAzure, router, &config.Config{AIFailover: []string{"onprem"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(chain.Backends) != 2 || chain.Backends[1].Name != "onprem" {
+		t.Errorf("Expected the chain azure, onprem, got %+v", chain.Backends)
+	}
+
+	if _, err := failoverChain(ProviderAzure, router, &config.Config{AIFailover: []string{"elders"}}); err == nil {
+		t.Errorf("Expected an unknown failover provider to fail")
+	}
+}
+
+func TestStream(t *testing.T) {
+	var streamed []string
+	response, err := Stream(context.Background(), namedProvider("azure"), &chat.Request{}, func(delta string) {
+		streamed = append(streamed, delta)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(streamed) != 1 || streamed[0] != "azure" || response.Content != "azure" {
+		t.Errorf("Expected a provider that can't stream to hand out its whole content at once, got %q", streamed)
+	}
+}
@@ -0,0 +1,137 @@
+// Package chat describes the requests and responses of chat completions,
+// shared by the AI providers.
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool messages carry the result of a tool call back to the model
+	RoleTool = "tool"
+)
+
+// ErrNoChoices is returned when a provider replies without any completion.
+var ErrNoChoices = errors.New("chat completion has no choices")
+
+// Message is a single turn of a chat.
+type Message struct {
+	Role    string
+	Content string
+	// ToolCalls the assistant made in this turn
+	ToolCalls []ToolCall
+	// ToolCallID is the call a RoleTool message answers
+	ToolCallID string
+}
+
+// Tool is a function the model may call instead of replying, its Parameters
+// are described by a JSON schema.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// ToolCall is a call of the model to one of the tools of the request, with
+// the arguments as json.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// ResponseFormat makes the model reply with json. With a Schema the reply has
+// to match it, providers that can't enforce a schema are told it in the
+// system message.
+type ResponseFormat struct {
+	Name   string
+	Schema json.RawMessage
+	// Strict holds the model to the schema exactly, which needs a schema that
+	// requires all its properties and allows no others
+	Strict bool
+}
+
+// JSONObject asks for a json reply without a schema.
+var JSONObject = &ResponseFormat{}
+
+type Request struct {
+	// Provider is the name of the provider the request is for, the default
+	// provider when empty. Model overrides the model of the provider.
+	Provider string
+	Model    string
+	Messages []Message
+	// Temperature of the sampling, the default of the provider when nil
+	Temperature *float32
+	// MaxTokens of the completion, the default of the provider when 0
+	MaxTokens      int
+	ResponseFormat *ResponseFormat
+	Tools          []Tool
+}
+
+// Usage is the number of tokens a completion took.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// EstimateUsage estimates the tokens of a completion from its length, for
+// providers that don't count them, such as when streaming. A token is about
+// four characters, and every message takes a few more for its role.
+func EstimateUsage(request *Request, content string) Usage {
+	const charsPerToken, tokensPerMessage = 4, 4
+	usage := Usage{CompletionTokens: (len(content) + charsPerToken - 1) / charsPerToken}
+	for _, message := range request.Messages {
+		usage.PromptTokens += tokensPerMessage + (len(message.Content)+charsPerToken-1)/charsPerToken
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+type Response struct {
+	// Provider is the name of the provider that served the request, when it
+	// went through a chain of providers
+	Provider     string
+	Content      string
+	ToolCalls    []ToolCall
+	FinishReason string
+	Usage        Usage
+}
+
+// Prompt returns the messages of a system prompt followed by a single user
+// message.
+func Prompt(system string, text string) []Message {
+	return []Message{
+		{Role: RoleSystem, Content: system},
+		{Role: RoleUser, Content: text},
+	}
+}
+
+// Temperature returns a pointer to the temperature, for Request.
+func Temperature(temperature float32) *float32 {
+	return &temperature
+}
+
+// SchemaInstruction returns the messages of the request with its response
+// schema appended to the first system message, for providers that only know
+// about json replies and not about schemas.
+func SchemaInstruction(request *Request) []Message {
+	format := request.ResponseFormat
+	if format == nil || len(format.Schema) == 0 {
+		return request.Messages
+	}
+	instruction := "Reply with json matching this json schema: " + string(format.Schema)
+	messages := make([]Message, len(request.Messages))
+	copy(messages, request.Messages)
+	for i, message := range messages {
+		if message.Role == RoleSystem {
+			messages[i].Content = message.Content + "\n" + instruction
+			return messages
+		}
+	}
+	return append([]Message{{Role: RoleSystem, Content: instruction}}, messages...)
+}
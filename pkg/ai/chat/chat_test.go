@@ -0,0 +1,37 @@
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSchemaInstruction(t *testing.T) {
+	request := &Request{Messages: Prompt("Je bent een assistent.", "Hallo")}
+	if messages := SchemaInstruction(request); messages[0].Content != "Je bent een assistent." {
+		t.Errorf("Expected the messages as they are without a schema, got %v", messages)
+	}
+
+	request.ResponseFormat = &ResponseFormat{Schema: json.RawMessage(`{"type": "object"}`)}
+	messages := SchemaInstruction(request)
+	if len(messages) != 2 || !strings.HasSuffix(messages[0].Content, `{"type": "object"}`) {
+		t.Errorf("Expected the schema in the system message, got %v", messages)
+	}
+	if request.Messages[0].Content != "Je bent een assistent." {
+		t.Errorf("The messages of the request were changed")
+	}
+
+	request.Messages = request.Messages[1:]
+	if messages := SchemaInstruction(request); len(messages) != 2 || messages[0].Role != RoleSystem {
+		t.Errorf("Expected a system message with the schema, got %v", messages)
+	}
+}
+
+func TestEstimateUsage(t *testing.T) {
+	request := &Request{Messages: Prompt("Je bent een assistent.", "Hallo")}
+	usage := EstimateUsage(request, "Waar gaat uw melding over?")
+	// 22 and 5 characters, and a role for each message
+	if usage.PromptTokens != 6+4+2+4 || usage.CompletionTokens != 7 || usage.TotalTokens != 23 {
+		t.Errorf("Unexpected estimate %+v", usage)
+	}
+}
@@ -0,0 +1,223 @@
+// Package failover is an AI provider that tries a chain of providers in
+// order. Every backend has a circuit breaker, so a provider that keeps
+// failing is skipped for a while instead of holding up every call with its
+// timeout.
+package failover
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"goVoice/pkg/ai/chat"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout   = 10 * time.Second
+	defaultThreshold = 3
+	defaultCooldown  = 30 * time.Second
+)
+
+// Requests served, failed and skipped because the circuit was open, by backend
+var (
+	servedCount  = expvar.NewMap("ai_served")
+	failedCount  = expvar.NewMap("ai_failed")
+	skippedCount = expvar.NewMap("ai_skipped")
+)
+
+// ErrAllFailed is returned when no backend could serve a request.
+var ErrAllFailed = errors.New("all AI providers failed")
+
+// Provider is what ai.AIProvider is, declared here so the ai package can
+// build chains.
+type Provider interface {
+	GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error)
+}
+
+// Streamer is what ai.StreamingProvider is.
+type Streamer interface {
+	StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error)
+}
+
+// Backend is a provider in the chain.
+type Backend struct {
+	Name     string
+	Provider Provider
+	// Timeout of a single request, the timeout of the chain when 0
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openAt   time.Time
+	trial    bool
+}
+
+// Chain tries its backends in order until one serves the request.
+type Chain struct {
+	Backends []*Backend
+	// Timeout of a single request to a backend
+	Timeout time.Duration
+	// Threshold is the number of failures in a row that opens the circuit of
+	// a backend, which stays open for Cooldown. After that a single request
+	// is let through to see whether the backend is back.
+	Threshold int
+	Cooldown  time.Duration
+	// Clock tells the time, defaults to time.Now. It is replaced in tests.
+	Clock func() time.Time
+}
+
+func New(backends ...*Backend) *Chain {
+	return &Chain{
+		Backends:  backends,
+		Timeout:   defaultTimeout,
+		Threshold: defaultThreshold,
+		Cooldown:  defaultCooldown,
+	}
+}
+
+func (c *Chain) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+// GetChatCompletion returns the response of the first backend that serves
+// the request, with the name of that backend as provider.
+func (c *Chain) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	return c.serve(ctx, func(ctx context.Context, backend *Backend) (*chat.Response, bool, error) {
+		response, err := backend.Provider.GetChatCompletion(ctx, request)
+		return response, false, err
+	})
+}
+
+// StreamChatCompletion streams the response of the first backend that serves
+// the request. A backend that fails after it streamed content isn't failed
+// over, what was handed out can't be taken back.
+func (c *Chain) StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	return c.serve(ctx, func(ctx context.Context, backend *Backend) (*chat.Response, bool, error) {
+		streamer, ok := backend.Provider.(Streamer)
+		if !ok {
+			response, err := backend.Provider.GetChatCompletion(ctx, request)
+			if err == nil && response.Content != "" {
+				onDelta(response.Content)
+			}
+			return response, false, err
+		}
+		streamed := false
+		response, err := streamer.StreamChatCompletion(ctx, request, func(delta string) {
+			streamed = true
+			onDelta(delta)
+		})
+		return response, streamed, err
+	})
+}
+
+// serve has the backends try the request in order. send returns whether the
+// backend handed out part of its response before it failed, after which the
+// request can't go to the next backend.
+func (c *Chain) serve(ctx context.Context, send func(ctx context.Context, backend *Backend) (*chat.Response, bool, error)) (*chat.Response, error) {
+	var errs []string
+	for _, backend := range c.Backends {
+		if !c.allow(backend) {
+			skippedCount.Add(backend.Name, 1)
+			errs = append(errs, backend.Name+": circuit open")
+			continue
+		}
+
+		response, partial, err := c.try(ctx, backend, send)
+		if ctx.Err() != nil {
+			// The caller gave up, that says nothing about the backend
+			c.release(backend)
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("AI provider %s failed: %v", backend.Name, err)
+			failedCount.Add(backend.Name, 1)
+			c.recordFailure(backend)
+			if partial {
+				return nil, fmt.Errorf("AI provider %s failed halfway its response: %w", backend.Name, err)
+			}
+			errs = append(errs, fmt.Sprintf("%s: %v", backend.Name, err))
+			continue
+		}
+		servedCount.Add(backend.Name, 1)
+		c.recordSuccess(backend)
+		response.Provider = backend.Name
+		return response, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAllFailed, strings.Join(errs, "; "))
+}
+
+func (c *Chain) try(ctx context.Context, backend *Backend, send func(ctx context.Context, backend *Backend) (*chat.Response, bool, error)) (*chat.Response, bool, error) {
+	timeout := backend.Timeout
+	if timeout <= 0 {
+		timeout = c.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return send(ctx, backend)
+}
+
+// allow tells whether the backend may be tried. Once the cooldown of an open
+// circuit passed a single trial request is let through.
+func (c *Chain) allow(backend *Backend) bool {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.openAt.IsZero() {
+		return true
+	}
+	if backend.trial || c.now().Before(backend.openAt.Add(c.Cooldown)) {
+		return false
+	}
+	backend.trial = true
+	return true
+}
+
+func (c *Chain) release(backend *Backend) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.trial = false
+}
+
+func (c *Chain) recordSuccess(backend *Backend) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if !backend.openAt.IsZero() {
+		log.Printf("AI provider %s is back, closing its circuit", backend.Name)
+	}
+	backend.failures = 0
+	backend.openAt = time.Time{}
+	backend.trial = false
+}
+
+func (c *Chain) recordFailure(backend *Backend) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.failures++
+	threshold := c.Threshold
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+	if backend.trial || backend.failures >= threshold {
+		if backend.openAt.IsZero() || backend.trial {
+			log.Printf("AI provider %s failed %d times in a row, opening its circuit", backend.Name, backend.failures)
+		}
+		backend.openAt = c.now()
+	}
+	backend.trial = false
+}
+
+// Open tells whether the circuit of the backend is open.
+func (b *Backend) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openAt.IsZero()
+}
@@ -0,0 +1,192 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"goVoice/pkg/ai/chat"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scripted fails or succeeds in the order of its script, and keeps repeating
+// the last entry
+type scripted struct {
+	script []error
+	calls  int
+}
+
+func (s *scripted) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	err := s.script[len(s.script)-1]
+	if s.calls < len(s.script) {
+		err = s.script[s.calls]
+	}
+	s.calls++
+	if err != nil {
+		return nil, err
+	}
+	return &chat.Response{Content: "ok"}, nil
+}
+
+// slow answers after the context is done
+type slow struct{}
+
+func (slow) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+var errDown = errors.New("down")
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   []error
+		secondary []error
+		requests  int
+		served    []string
+		calls     int
+	}{
+		{"primary serves", []error{nil}, []error{nil}, 2, []string{"primary", "primary"}, 2},
+		{"fails over", []error{errDown, nil}, []error{nil}, 2, []string{"secondary", "primary"}, 2},
+		{"circuit opens", []error{errDown}, []error{nil}, 5, []string{"secondary", "secondary", "secondary", "secondary", "secondary"}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			primary := &scripted{script: test.primary}
+			chain := New(
+				&Backend{Name: "primary", Provider: primary},
+				&Backend{Name: "secondary", Provider: &scripted{script: test.secondary}},
+			)
+			for i := 0; i < test.requests; i++ {
+				response, err := chain.GetChatCompletion(context.Background(), &chat.Request{})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if response.Provider != test.served[i] {
+					t.Errorf("Expected request %d to be served by %s, got %s", i, test.served[i], response.Provider)
+				}
+			}
+			if primary.calls != test.calls {
+				t.Errorf("Expected %d calls to the primary, got %d", test.calls, primary.calls)
+			}
+		})
+	}
+}
+
+func TestCircuitCloses(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	primary := &scripted{script: []error{errDown, errDown, errDown, errDown, nil}}
+	chain := New(
+		&Backend{Name: "primary", Provider: primary},
+		&Backend{Name: "secondary", Provider: &scripted{script: []error{nil}}},
+	)
+	chain.Clock = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		chain.GetChatCompletion(context.Background(), &chat.Request{})
+	}
+	if !chain.Backends[0].Open() {
+		t.Fatalf("Expected the circuit to open after %d failures", chain.Threshold)
+	}
+
+	// The trial after the cooldown fails, so the circuit opens again
+	now = now.Add(chain.Cooldown)
+	chain.GetChatCompletion(context.Background(), &chat.Request{})
+	if primary.calls != 4 || !chain.Backends[0].Open() {
+		t.Fatalf("Expected a failed trial to reopen the circuit, got %d calls", primary.calls)
+	}
+	chain.GetChatCompletion(context.Background(), &chat.Request{})
+	if primary.calls != 4 {
+		t.Errorf("Expected no calls while the circuit is open, got %d", primary.calls)
+	}
+
+	now = now.Add(chain.Cooldown)
+	response, _ := chain.GetChatCompletion(context.Background(), &chat.Request{})
+	if response.Provider != "primary" || chain.Backends[0].Open() {
+		t.Errorf("Expected a good trial to close the circuit, served by %s", response.Provider)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	chain := New(
+		&Backend{Name: "slow", Provider: slow{}, Timeout: time.Millisecond},
+		&Backend{Name: "fast", Provider: &scripted{script: []error{nil}}},
+	)
+	response, err := chain.GetChatCompletion(context.Background(), &chat.Request{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response.Provider != "fast" {
+		t.Errorf("Expected the slow provider to time out, served by %s", response.Provider)
+	}
+}
+
+func TestAllFailed(t *testing.T) {
+	chain := New(&Backend{Name: "primary", Provider: &scripted{script: []error{errDown}}})
+	if _, err := chain.GetChatCompletion(context.Background(), &chat.Request{}); !errors.Is(err, ErrAllFailed) {
+		t.Errorf("Expected ErrAllFailed, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	chain = New(&Backend{Name: "slow", Provider: slow{}})
+	if _, err := chain.GetChatCompletion(ctx, &chat.Request{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the canceled context, got %v", err)
+	}
+	if chain.Backends[0].failures != 0 {
+		t.Errorf("Expected a canceled call not to count as a failure")
+	}
+}
+
+// streaming streams its content word by word and fails after it when it has
+// an error
+type streaming struct {
+	content string
+	err     error
+}
+
+func (s streaming) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	return s.StreamChatCompletion(ctx, request, func(string) {})
+}
+
+func (s streaming) StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	for _, word := range strings.Fields(s.content) {
+		onDelta(word + " ")
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &chat.Response{Content: s.content}, nil
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		primary  Provider
+		expected string
+		fails    bool
+	}{
+		{"streams", streaming{content: "Dank u wel."}, "Dank u wel. ", false},
+		{"fails over before streaming", streaming{err: errDown}, "Wat is uw adres? ", false},
+		{"no fail over halfway", streaming{content: "Dank u", err: errDown}, "Dank u ", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain := New(
+				&Backend{Name: "primary", Provider: test.primary},
+				&Backend{Name: "secondary", Provider: streaming{content: "Wat is uw adres?"}},
+			)
+			var streamed strings.Builder
+			_, err := chain.StreamChatCompletion(context.Background(), &chat.Request{}, func(delta string) {
+				streamed.WriteString(delta)
+			})
+			if (err != nil) != test.fails {
+				t.Errorf("Expected failure: %v, got %v", test.fails, err)
+			}
+			if streamed.String() != test.expected {
+				t.Errorf("Expected %q to be streamed, got %q", test.expected, streamed.String())
+			}
+		})
+	}
+}
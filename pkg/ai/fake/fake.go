@@ -0,0 +1,120 @@
+// Package fake is an AI provider for tests. It replies following a table of
+// rules instead of asking a model, records every request it gets, and can be
+// made slow or failing.
+package fake
+
+import (
+	"context"
+	"errors"
+	"goVoice/pkg/ai/chat"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoRule is returned for requests none of the rules match.
+var ErrNoRule = errors.New("no rule of the fake AI provider matches the request")
+
+// Rule is a reply to the requests whose last message matches the pattern.
+type Rule struct {
+	// Pattern is a regular expression, an empty pattern matches any request
+	Pattern string
+	// Response is the content of the reply
+	Response string
+	// Err is returned instead of a reply when set
+	Err error
+	// Latency is how long the reply takes, unless the context is done first
+	Latency time.Duration
+
+	pattern *regexp.Regexp
+}
+
+// Provider replies with the first rule that matches the request.
+type Provider struct {
+	rules []Rule
+	// Latency is added to that of every rule
+	Latency time.Duration
+
+	mu       sync.Mutex
+	requests []*chat.Request
+}
+
+// New returns a provider with the rules, it panics on a pattern that doesn't
+// compile like regexp.MustCompile does.
+func New(rules ...Rule) *Provider {
+	for i := range rules {
+		rules[i].pattern = regexp.MustCompile(rules[i].Pattern)
+	}
+	return &Provider{rules: rules}
+}
+
+func (p *Provider) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, request)
+	p.mu.Unlock()
+
+	var text string
+	if len(request.Messages) > 0 {
+		text = request.Messages[len(request.Messages)-1].Content
+	}
+	for _, rule := range p.rules {
+		if !rule.pattern.MatchString(text) {
+			continue
+		}
+		if latency := p.Latency + rule.Latency; latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if rule.Err != nil {
+			return nil, rule.Err
+		}
+		return &chat.Response{
+			Content:      rule.Response,
+			FinishReason: "stop",
+			Usage: chat.Usage{
+				PromptTokens:     tokens(request),
+				CompletionTokens: len(strings.Fields(rule.Response)),
+				TotalTokens:      tokens(request) + len(strings.Fields(rule.Response)),
+			},
+		}, nil
+	}
+	return nil, ErrNoRule
+}
+
+// StreamChatCompletion replies like GetChatCompletion, word by word.
+func (p *Provider) StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	response, err := p.GetChatCompletion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range strings.SplitAfter(response.Content, " ") {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if word != "" {
+			onDelta(word)
+		}
+	}
+	response.Usage = chat.Usage{}
+	return response, nil
+}
+
+// Requests returns the requests the provider got so far, in order.
+func (p *Provider) Requests() []*chat.Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*chat.Request(nil), p.requests...)
+}
+
+// tokens counts the words of the request, close enough for tests of usage.
+func tokens(request *chat.Request) int {
+	count := 0
+	for _, message := range request.Messages {
+		count += len(strings.Fields(message.Content))
+	}
+	return count
+}
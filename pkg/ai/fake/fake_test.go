@@ -0,0 +1,62 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"goVoice/pkg/ai/chat"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProvider(t *testing.T) {
+	errDown := errors.New("down")
+	provider := New(
+		Rule{Pattern: `(?i)kapot`, Response: `{"complete": true}`},
+		Rule{Pattern: `storing`, Err: errDown},
+		Rule{Pattern: `traag`, Response: "eindelijk", Latency: time.Second},
+	)
+	tests := []struct {
+		name     string
+		text     string
+		response string
+		err      error
+	}{
+		{"matches", "De lamp is Kapot", `{"complete": true}`, nil},
+		{"fails", "Er is een storing", "", errDown},
+		{"times out", "Het is traag", "", context.DeadlineExceeded},
+		{"no rule", "Hallo", "", ErrNoRule},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			response, err := provider.GetChatCompletion(ctx, &chat.Request{Messages: chat.Prompt("Systeem", test.text)})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Expected error %v, got %v", test.err, err)
+			}
+			if err == nil && response.Content != test.response {
+				t.Errorf("Expected %q, got %q", test.response, response.Content)
+			}
+		})
+	}
+
+	requests := provider.Requests()
+	if len(requests) != len(tests) || requests[0].Messages[1].Content != "De lamp is Kapot" {
+		t.Errorf("Expected every request to be recorded, got %d", len(requests))
+	}
+}
+
+func TestStream(t *testing.T) {
+	provider := New(Rule{Response: "Dank u. Wat is uw adres?"})
+	var deltas []string
+	response, err := provider.StreamChatCompletion(context.Background(), &chat.Request{}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(deltas) != 6 || strings.Join(deltas, "") != response.Content {
+		t.Errorf("Expected the reply word by word, got %q", deltas)
+	}
+}
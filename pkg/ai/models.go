@@ -5,4 +5,6 @@ type ValidatedAnswer struct {
 	Purpose string `json:"purpose"`
 	Question string `json:"question"`
 	Complete *bool `json:"complete"`
+	// Version of the prompt the answer was validated with
+	PromptVersion string `json:"-"`
 }
\ No newline at end of file
@@ -2,46 +2,170 @@ package openAI
 
 import (
 	"context"
+	"errors"
+	"goVoice/pkg/ai/chat"
+	"io"
 	"log"
+	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
 type OpenAIHandler struct {
 	client *openai.Client
+	model  string
 }
 
-func NewOpenAIHandler(apiKey string) *OpenAIHandler {
-	client := openai.NewClient(apiKey)
+// NewOpenAIHandler creates a handler for the OpenAI API, or for a server with
+// an OpenAI compatible API at baseURL. Without a model it uses GPT-3.5 Turbo.
+func NewOpenAIHandler(apiKey string, baseURL string, model string) *OpenAIHandler {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	if model == "" {
+		model = openai.GPT3Dot5Turbo
+	}
 
 	return &OpenAIHandler{
-		client: client,
+		client: openai.NewClientWithConfig(config),
+		model:  model,
 	}
 }
 
-func (h *OpenAIHandler) GetSimpleChatCompletion(system string, text string) (string, error) {
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role: openai.ChatMessageRoleSystem,
-			Content: system,
-		},
-		{
-			Role: openai.ChatMessageRoleUser,
-			Content: text,
-		},
+func (h *OpenAIHandler) completionRequest(request *chat.Request) openai.ChatCompletionRequest {
+	var messages []openai.ChatCompletionMessage
+	for _, message := range request.Messages {
+		converted := openai.ChatCompletionMessage{
+			Role:       message.Role,
+			Content:    message.Content,
+			ToolCallID: message.ToolCallID,
+		}
+		for _, call := range message.ToolCalls {
+			converted.ToolCalls = append(converted.ToolCalls, openai.ToolCall{
+				ID:       call.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+		messages = append(messages, converted)
+	}
+
+	model := h.model
+	if request.Model != "" {
+		model = request.Model
+	}
+	completionRequest := openai.ChatCompletionRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: request.MaxTokens,
+	}
+	if request.Temperature != nil {
+		completionRequest.Temperature = *request.Temperature
+	}
+	if request.ResponseFormat != nil {
+		completionRequest.ResponseFormat = responseFormat(request.ResponseFormat)
+	}
+	for _, tool := range request.Tools {
+		completionRequest.Tools = append(completionRequest.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
 	}
 
-	resp, err := h.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: messages,
+	return completionRequest
+}
+
+// responseFormat asks for structured output when the format has a schema,
+// and for any json object otherwise.
+func responseFormat(format *chat.ResponseFormat) *openai.ChatCompletionResponseFormat {
+	if len(format.Schema) == 0 {
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	name := format.Name
+	if name == "" {
+		name = "response"
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   name,
+			Schema: format.Schema,
+			Strict: format.Strict,
 		},
-	)
+	}
+}
+
+func (h *OpenAIHandler) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	resp, err := h.client.CreateChatCompletion(ctx, h.completionRequest(request))
 	if err != nil {
 		log.Printf("Error getting chat completion from OpenAI: %v", err)
-		return "", err
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, chat.ErrNoChoices
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	choice := resp.Choices[0]
+	response := &chat.Response{
+		Content:      choice.Message.Content,
+		FinishReason: string(choice.FinishReason),
+		Usage: chat.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}
+	for _, call := range choice.Message.ToolCalls {
+		response.ToolCalls = append(response.ToolCalls, chat.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return response, nil
+}
+
+// StreamChatCompletion hands out the content of the response while it is
+// generated. The API doesn't count the tokens of streamed responses,
+// ai.Stream estimates them.
+func (h *OpenAIHandler) StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	completionRequest := h.completionRequest(request)
+	completionRequest.Stream = true
+	stream, err := h.client.CreateChatCompletionStream(ctx, completionRequest)
+	if err != nil {
+		log.Printf("Error streaming chat completion from OpenAI: %v", err)
+		return nil, err
+	}
+	defer stream.Close()
+
+	response := &chat.Response{}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading chat completion stream from OpenAI: %v", err)
+			return nil, err
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		choice := chunk.Choices[0]
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+		if choice.FinishReason != "" {
+			response.FinishReason = string(choice.FinishReason)
+		}
+	}
+	response.Content = content.String()
+	return response, nil
 }
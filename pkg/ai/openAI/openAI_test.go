@@ -0,0 +1,49 @@
+package openAI
+
+import (
+	"context"
+	"encoding/json"
+	"goVoice/pkg/ai/chat"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSchemaIsSentAsResponseFormat(t *testing.T) {
+	var formats []json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ResponseFormat json.RawMessage `json:"response_format"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		formats = append(formats, request.ResponseFormat)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{}"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+	handler := NewOpenAIHandler("sk-test", server.URL, "gpt-4o")
+
+	schema := json.RawMessage(`{"type":"object"}`)
+	requests := []*chat.Request{
+		{Messages: chat.Prompt("Vat samen", "{}"), ResponseFormat: &chat.ResponseFormat{Name: "summary", Schema: schema, Strict: true}},
+		{Messages: chat.Prompt("Vat samen", "{}"), ResponseFormat: chat.JSONObject},
+	}
+	for _, request := range requests {
+		if _, err := handler.GetChatCompletion(context.Background(), request); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if len(formats) != len(requests) {
+		t.Fatalf("Expected %d requests, got %d", len(requests), len(formats))
+	}
+	expected := []string{
+		`{"type":"json_schema","json_schema":{"name":"summary","schema":{"type":"object"},"strict":true}}`,
+		`{"type":"json_object"}`,
+	}
+	for i, format := range formats {
+		if string(format) != expected[i] {
+			t.Errorf("Expected response format %s, got %s", expected[i], format)
+		}
+	}
+}
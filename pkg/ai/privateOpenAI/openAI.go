@@ -2,10 +2,15 @@ package privateOpenAI
 
 import (
 	"context"
+	"errors"
+	"goVoice/pkg/ai/chat"
+	"io"
 	"log"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 )
 
 type OpenAIHandler struct {
@@ -28,25 +33,141 @@ func NewOpenAIHandler(apiKey, endpoint, deploymentName string) (*OpenAIHandler,
 	}, nil
 }
 
-func (h *OpenAIHandler) GetSimpleChatCompletion(system string, text string) (string, error) {
-	messages := []azopenai.ChatRequestMessageClassification{
-		&azopenai.ChatRequestSystemMessage{Content: &system},
-		&azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent(text)},
-	}
-
-	resp, err := h.client.GetChatCompletions(
-		context.Background(),
-		azopenai.ChatCompletionsOptions{
-			Messages:       messages,
-			DeploymentName: &h.deploymentName,
-			ResponseFormat: &azopenai.ChatCompletionsJSONResponseFormat{},
-		},
-		nil,
-	)
+func (h *OpenAIHandler) completionsOptions(request *chat.Request) azopenai.ChatCompletionsOptions {
+	var messages []azopenai.ChatRequestMessageClassification
+	// The API version of the SDK has no structured outputs, the schema goes in
+	// the system message
+	for _, message := range chat.SchemaInstruction(request) {
+		content := message.Content
+		switch message.Role {
+		case chat.RoleSystem:
+			messages = append(messages, &azopenai.ChatRequestSystemMessage{Content: &content})
+		case chat.RoleAssistant:
+			assistant := &azopenai.ChatRequestAssistantMessage{Content: &content}
+			for _, call := range message.ToolCalls {
+				assistant.ToolCalls = append(assistant.ToolCalls, &azopenai.ChatCompletionsFunctionToolCall{
+					ID:       to.Ptr(call.ID),
+					Type:     to.Ptr("function"),
+					Function: &azopenai.FunctionCall{Name: to.Ptr(call.Name), Arguments: to.Ptr(call.Arguments)},
+				})
+			}
+			messages = append(messages, assistant)
+		case chat.RoleTool:
+			messages = append(messages, &azopenai.ChatRequestToolMessage{Content: &content, ToolCallID: to.Ptr(message.ToolCallID)})
+		default:
+			messages = append(messages, &azopenai.ChatRequestUserMessage{Content: azopenai.NewChatRequestUserMessageContent(content)})
+		}
+	}
+
+	// Models are deployments with Azure
+	deploymentName := h.deploymentName
+	if request.Model != "" {
+		deploymentName = request.Model
+	}
+	options := azopenai.ChatCompletionsOptions{
+		Messages:       messages,
+		DeploymentName: &deploymentName,
+		Temperature:    request.Temperature,
+	}
+	if request.MaxTokens > 0 {
+		options.MaxTokens = to.Ptr(int32(request.MaxTokens))
+	}
+	if request.ResponseFormat != nil {
+		options.ResponseFormat = &azopenai.ChatCompletionsJSONResponseFormat{}
+	}
+	for _, tool := range request.Tools {
+		options.Tools = append(options.Tools, &azopenai.ChatCompletionsFunctionToolDefinition{
+			Function: &azopenai.FunctionDefinition{
+				Name:        to.Ptr(tool.Name),
+				Description: to.Ptr(tool.Description),
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	return options
+}
+
+func (h *OpenAIHandler) GetChatCompletion(ctx context.Context, request *chat.Request) (*chat.Response, error) {
+	resp, err := h.client.GetChatCompletions(ctx, h.completionsOptions(request), nil)
 	if err != nil {
 		log.Printf("Error getting chat completion from OpenAI: %v", err)
-		return "", err
+		return nil, err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return nil, chat.ErrNoChoices
+	}
+
+	choice := resp.Choices[0]
+	response := &chat.Response{}
+	if choice.Message.Content != nil {
+		response.Content = *choice.Message.Content
+	}
+	if choice.FinishReason != nil {
+		response.FinishReason = string(*choice.FinishReason)
+	}
+	if usage := resp.Usage; usage != nil {
+		response.Usage = chat.Usage{
+			PromptTokens:     int(value(usage.PromptTokens)),
+			CompletionTokens: int(value(usage.CompletionTokens)),
+			TotalTokens:      int(value(usage.TotalTokens)),
+		}
+	}
+	for _, call := range choice.Message.ToolCalls {
+		function, ok := call.(*azopenai.ChatCompletionsFunctionToolCall)
+		if !ok || function.Function == nil {
+			continue
+		}
+		response.ToolCalls = append(response.ToolCalls, chat.ToolCall{
+			ID:        value(function.ID),
+			Name:      value(function.Function.Name),
+			Arguments: value(function.Function.Arguments),
+		})
 	}
+	return response, nil
+}
 
-	return *resp.Choices[0].Message.Content, nil
+// StreamChatCompletion hands out the content of the response while it is
+// generated. Azure doesn't count the tokens of streamed responses,
+// ai.Stream estimates them.
+func (h *OpenAIHandler) StreamChatCompletion(ctx context.Context, request *chat.Request, onDelta func(delta string)) (*chat.Response, error) {
+	resp, err := h.client.GetChatCompletionsStream(ctx, h.completionsOptions(request), nil)
+	if err != nil {
+		log.Printf("Error streaming chat completion from OpenAI: %v", err)
+		return nil, err
+	}
+	stream := resp.ChatCompletionsStream
+	defer stream.Close()
+
+	response := &chat.Response{}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading chat completion stream from OpenAI: %v", err)
+			return nil, err
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta != nil && choice.Delta.Content != nil && *choice.Delta.Content != "" {
+				content.WriteString(*choice.Delta.Content)
+				onDelta(*choice.Delta.Content)
+			}
+			if choice.FinishReason != nil {
+				response.FinishReason = string(*choice.FinishReason)
+			}
+		}
+	}
+	response.Content = content.String()
+	return response, nil
+}
+
+func value[T any](pointer *T) T {
+	var zero T
+	if pointer == nil {
+		return zero
+	}
+	return *pointer
 }
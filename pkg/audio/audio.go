@@ -10,7 +10,11 @@ type CallProvider interface {
 	HandleWebHook(c *gin.Context)
 	IAmLive(c *gin.Context)
 	SpeakText(callID string, text string, clientState *models.ClientState) (chan bool, chan error)
+	InterruptAndSpeak(callID string, text string, clientState *models.ClientState) (chan bool, chan error)
 	PlayAudioUrl(callID string, step *models.ConversationStep, clientState *models.ClientState) (chan bool, chan error)
 	GetRecordingMp3(recording *models.Recording) (chan []byte, chan error)
+	GetRecordingWav(recording *models.Recording) (chan []byte, chan error)
 	EndCall(callID string) (chan bool, chan error)
+	TransferCall(callID string, to string, clientState *models.ClientState) (chan bool, chan error)
+	SetTranscriptionLanguage(callID string, clientState *models.ClientState) (chan bool, chan error)
 }
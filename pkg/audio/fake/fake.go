@@ -0,0 +1,97 @@
+// Package fake is a CallProvider without telephony. Everything the controller
+// asks it to do succeeds right away and is sent on the Events channel, so a
+// caller can be simulated by whoever reads them.
+package fake
+
+import (
+	"goVoice/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	EventSpeak     = "speak"
+	EventInterrupt = "interrupt"
+	EventPlay      = "play"
+	EventHangup    = "hangup"
+	EventTransfer  = "transfer"
+	EventLanguage  = "language"
+)
+
+// Event is something the controller had the call provider do.
+type Event struct {
+	Kind   string
+	CallID string
+	Text   string // what was said, or the text of the step that was played
+	To     string // number the call was transferred to
+	State  *models.ClientState
+}
+
+type CallProvider struct {
+	Events chan Event
+	// Recording is returned as the mp3 of every recording
+	Recording []byte
+	// RecordingWav is returned as the wav of every recording
+	RecordingWav []byte
+}
+
+func NewCallProvider() *CallProvider {
+	return &CallProvider{Events: make(chan Event, 100)}
+}
+
+func (f *CallProvider) emit(event Event) (chan bool, chan error) {
+	if event.State != nil {
+		state := *event.State
+		event.State = &state
+	}
+	f.Events <- event
+
+	done := make(chan bool, 1)
+	done <- true
+	return done, make(chan error, 1)
+}
+
+func (f *CallProvider) HandleWebHook(c *gin.Context) {
+	c.Status(http.StatusNotImplemented)
+}
+
+func (f *CallProvider) IAmLive(c *gin.Context) {
+	c.String(http.StatusOK, "fake call provider")
+}
+
+func (f *CallProvider) SpeakText(callID string, text string, clientState *models.ClientState) (chan bool, chan error) {
+	return f.emit(Event{Kind: EventSpeak, CallID: callID, Text: text, State: clientState})
+}
+
+func (f *CallProvider) InterruptAndSpeak(callID string, text string, clientState *models.ClientState) (chan bool, chan error) {
+	return f.emit(Event{Kind: EventInterrupt, CallID: callID, Text: text, State: clientState})
+}
+
+func (f *CallProvider) PlayAudioUrl(callID string, step *models.ConversationStep, clientState *models.ClientState) (chan bool, chan error) {
+	return f.emit(Event{Kind: EventPlay, CallID: callID, Text: step.Text, State: clientState})
+}
+
+func (f *CallProvider) GetRecordingMp3(recording *models.Recording) (chan []byte, chan error) {
+	file := make(chan []byte, 1)
+	file <- f.Recording
+	return file, make(chan error, 1)
+}
+
+func (f *CallProvider) GetRecordingWav(recording *models.Recording) (chan []byte, chan error) {
+	file := make(chan []byte, 1)
+	file <- f.RecordingWav
+	return file, make(chan error, 1)
+}
+
+func (f *CallProvider) EndCall(callID string) (chan bool, chan error) {
+	return f.emit(Event{Kind: EventHangup, CallID: callID})
+}
+
+func (f *CallProvider) TransferCall(callID string, to string, clientState *models.ClientState) (chan bool, chan error) {
+	return f.emit(Event{Kind: EventTransfer, CallID: callID, To: to, State: clientState})
+}
+
+func (f *CallProvider) SetTranscriptionLanguage(callID string, clientState *models.ClientState) (chan bool, chan error) {
+	return f.emit(Event{Kind: EventLanguage, CallID: callID, State: clientState})
+}
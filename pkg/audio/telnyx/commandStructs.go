@@ -90,3 +90,11 @@ type PlayAudio struct {
 	ClientState     string `json:"client_state,omitempty"`
 	CommandID       string `json:"command_id,omitempty"`
 }
+
+type TransferPayload struct {
+	To          string `json:"to,omitempty"`           // Required, SIP URI or E.164 number
+	From        string `json:"from,omitempty"`         // Default is the number of the caller
+	TimeoutSecs int    `json:"timeout_secs,omitempty"` // default 30
+	ClientState string `json:"client_state,omitempty"`
+	CommandID   string `json:"command_id,omitempty"`
+}
@@ -3,6 +3,7 @@ package telnyx
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"goVoice/internal/models"
 	"io"
@@ -32,8 +33,9 @@ func (t *Telnyx) sendCommand(httpMethod string, payload interface{}, pathParams
 	_, isPlayAudioPayload := payload.(*PlayAudio)
 	_, isNoiseSuppressionPayload := payload.(*NoiseSuppressionPayload)
 	_, isTranscriptionPayload := payload.(*TranscriptionPayload)
+	_, isTransferPayload := payload.(*TransferPayload)
 
-	if payload != nil && !isSimplePayload && !isAnswerPayload && !isUpdateClientStatePayload && !isGatherPayload && !isRecordStartPayload && !isSpeakTextPayload && !isPlayAudioPayload && !isNoiseSuppressionPayload && !isTranscriptionPayload {
+	if payload != nil && !isSimplePayload && !isAnswerPayload && !isUpdateClientStatePayload && !isGatherPayload && !isRecordStartPayload && !isSpeakTextPayload && !isPlayAudioPayload && !isNoiseSuppressionPayload && !isTranscriptionPayload && !isTransferPayload {
 		log.Printf("Unknown payload type: %T", payload)
 		return nil, fmt.Errorf("unknown payload type: %T", payload)
 	}
@@ -102,14 +104,11 @@ func (t *Telnyx) sendCommand(httpMethod string, payload interface{}, pathParams
 	return resp, nil
 }
 
-func (t *Telnyx) answerCall(event Event) (chan bool, chan error) {
+func (t *Telnyx) answerCall(event Event, clientState *models.ClientState) (chan bool, chan error) {
 	log.Printf("Answering call %s", event.Data.Payload.CallControlID)
 	done := make(chan bool)
 	errChan := make(chan error, 1)
-	state, err := encodeClientState(&models.ClientState{
-		RulesetID:   "LeeuwardenPilot", // FIXME this should be dynamic
-		CurrentStep: 0,
-	})
+	state, err := encodeClientState(clientState)
 	if err != nil {
 		log.Printf("Error encoding client state: %v", err)
 		errChan <- err
@@ -149,7 +148,7 @@ func (t *Telnyx) startTranscription(callControlID string, clientState *models.Cl
 	transcriptionPayload := &TranscriptionPayload{
 		ClientState:         state,
 		CommandID:           generateCommandID(callControlID, "transcription_start", state),
-		Language:            "nl",
+		Language:            transcriptionLanguage(clientState),
 		TranscriptionEngine: "A", // A is google, B is telnyx
 	}
 
@@ -158,6 +157,7 @@ func (t *Telnyx) startTranscription(callControlID string, clientState *models.Cl
 		if err != nil {
 			log.Printf("Error starting transcription: %v", err)
 			errChan <- err
+			return
 		}
 		done <- true
 	}()
@@ -182,6 +182,7 @@ func (t *Telnyx) stopTranscription(callControlID string, clientState *models.Cli
 		if err != nil {
 			log.Printf("Error stopping transcription: %v", err)
 			errChan <- err
+			return
 		}
 		done <- true
 	}()
@@ -189,6 +190,33 @@ func (t *Telnyx) stopTranscription(callControlID string, clientState *models.Cli
 	return done, errChan
 }
 
+// SetTranscriptionLanguage restarts the transcription of the call in the
+// language of the client state.
+func (t *Telnyx) SetTranscriptionLanguage(callControlID string, clientState *models.ClientState) (chan bool, chan error) {
+	log.Printf("Switching transcription of call %s to %s", callControlID, transcriptionLanguage(clientState))
+	done := make(chan bool)
+	errChan := make(chan error, 1)
+
+	go func() {
+		stopped, stopErr := t.stopTranscription(callControlID, clientState)
+		select {
+		case <-stopped:
+		case err := <-stopErr:
+			// Most likely it wasn't running, starting it is what matters
+			log.Printf("Error stopping transcription before switching language: %v", err)
+		}
+		started, startErr := t.startTranscription(callControlID, clientState)
+		select {
+		case <-started:
+			done <- true
+		case err := <-startErr:
+			errChan <- err
+		}
+	}()
+
+	return done, errChan
+}
+
 func (t *Telnyx) startRecording(event Event) (chan bool, chan error) {
 	log.Printf("Starting recording for call %s", event.Data.Payload.CallControlID)
 	done := make(chan bool)
@@ -281,6 +309,16 @@ func (t *Telnyx) stopRecording(event Event) (chan bool, chan error) {
 // }
 
 func (t *Telnyx) SpeakText(CallControlID string, text string, clientState *models.ClientState) (chan bool, chan error) {
+	return t.speak(CallControlID, text, clientState, "")
+}
+
+// InterruptAndSpeak stops whatever is being played or spoken on the call and
+// speaks the text instead.
+func (t *Telnyx) InterruptAndSpeak(CallControlID string, text string, clientState *models.ClientState) (chan bool, chan error) {
+	return t.speak(CallControlID, text, clientState, "all")
+}
+
+func (t *Telnyx) speak(CallControlID string, text string, clientState *models.ClientState, stop string) (chan bool, chan error) {
 	log.Printf("Speaking text for call %s", CallControlID)
 	command := "speak"
 	done := make(chan bool)
@@ -289,10 +327,12 @@ func (t *Telnyx) SpeakText(CallControlID string, text string, clientState *model
 	state, _ := encodeClientState(clientState)
 
 	speakPayload := &SpeakTextPayload{
-		CommandID:   generateCommandID(CallControlID, command, state),
-		Language:    "nl-NL",
-		Voice:       "male",
+		// Sentences of a streamed step share their state, tell them apart by text
+		CommandID:   generateCommandID(CallControlID, command+text, state),
+		Language:    speakLanguage(clientState),
+		Voice:       speakVoice(clientState),
 		Payload:     text,
+		Stop:        stop,
 		ClientState: state,
 	}
 
@@ -302,6 +342,7 @@ func (t *Telnyx) SpeakText(CallControlID string, text string, clientState *model
 		if err != nil {
 			log.Printf("Error starting speak: %v", err)
 			errChan <- err
+			return
 		}
 		done <- true
 	}()
@@ -319,6 +360,38 @@ func (t *Telnyx) EndCall(callID string) (chan bool, chan error) {
 		if err != nil {
 			log.Printf("Error ending call: %v", err)
 			errChan <- err
+			return
+		}
+		done <- true
+	}()
+
+	return done, errChan
+}
+
+func (t *Telnyx) TransferCall(callControlID string, to string, clientState *models.ClientState) (chan bool, chan error) {
+	log.Printf("Transferring call %s to %s", callControlID, to)
+	done := make(chan bool)
+	errChan := make(chan error, 1)
+
+	state, _ := encodeClientState(clientState)
+
+	payload := &TransferPayload{
+		To:          to,
+		ClientState: state,
+		CommandID:   generateCommandID(callControlID, "transfer", state),
+	}
+
+	go func() {
+		res, err := t.sendPostCommandToCallCommandsAPI(callControlID, "transfer", payload)
+		if err != nil {
+			log.Printf("Error transferring call: %v", err)
+			errChan <- err
+			return
+		}
+		if res.StatusCode >= http.StatusBadRequest {
+			log.Printf("Error transferring call: %v", res.Status)
+			errChan <- fmt.Errorf("error transferring call: %v", res.Status)
+			return
 		}
 		done <- true
 	}()
@@ -366,11 +439,27 @@ func (t *Telnyx) GetRecording(recordingId string) (chan *Recording, chan error)
 
 func (t *Telnyx) GetRecordingMp3(recording *models.Recording) (chan []byte, chan error) {
 	log.Printf("Getting recording mp3: %s", recording.Url)
+	return downloadRecording(recording.Url)
+}
+
+// GetRecordingWav downloads the wav of the recording, which has the caller
+// and the agent on channels of their own.
+func (t *Telnyx) GetRecordingWav(recording *models.Recording) (chan []byte, chan error) {
+	log.Printf("Getting recording wav: %s", recording.WavUrl)
+	if recording.WavUrl == "" {
+		errChan := make(chan error, 1)
+		errChan <- errors.New("the recording has no wav")
+		return make(chan []byte), errChan
+	}
+	return downloadRecording(recording.WavUrl)
+}
+
+func downloadRecording(url string) (chan []byte, chan error) {
 	done := make(chan []byte)
 	errChan := make(chan error, 1)
 
 	go func() {
-		req, err := http.NewRequest("GET", recording.Url, nil)
+		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
 			log.Printf("Error creating request: %v", err)
 			errChan <- err
@@ -379,21 +468,27 @@ func (t *Telnyx) GetRecordingMp3(recording *models.Recording) (chan []byte, chan
 
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
-			log.Printf("Error getting recording mp3: %v", err)
+			log.Printf("Error getting recording: %v", err)
 			errChan <- err
 			return
 		}
 		defer res.Body.Close()
 		log.Printf("Response status: %s, downloaded the file, about to read body", res.Status)
-		mp3Bytes, err := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK {
+			err := fmt.Errorf("error getting recording: %s", res.Status)
+			log.Println(err)
+			errChan <- err
+			return
+		}
+		recordingBytes, err := io.ReadAll(res.Body)
 		if err != nil {
-			log.Printf("Error reading recording mp3: %v", err)
+			log.Printf("Error reading recording: %v", err)
 			errChan <- err
 			return
 		}
 		log.Printf("Read the body, about to return")
 
-		done <- mp3Bytes
+		done <- recordingBytes
 	}()
 
 	return done, errChan
@@ -421,6 +516,7 @@ func (t *Telnyx) PlayAudioUrl(callControlID string, step *models.ConversationSte
 		if err != nil {
 			log.Printf("Error playing audio url: %v", err)
 			errChan <- err
+			return
 		}
 		if step.AudioDuration > 3 {
 			// We pause transcription for the duration of the audio and then resume it
@@ -34,6 +34,9 @@ type Event struct {
 			State             string            `json:"state"`
 			StartTime         string            `json:"start_time"`
 			To                string            `json:"to"`
+			// call.hangup
+			EndTime     string `json:"end_time"`
+			HangupCause string `json:"hangup_cause"`
 			// recording.error
 			Reason string `json:"reason"`
 			// recording.saved
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"goVoice/internal/models"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -44,3 +46,75 @@ func generateCommandID(CallControlID, funcName string, clientState string) strin
 	id := uuid.NewMD5(uuid.Nil, []byte(idString))
 	return id.String()
 }
+
+// speakLanguages maps the ISO 639-1 codes we use to Telnyx text-to-speech locales
+var speakLanguages = map[string]string{
+	"nl": "nl-NL",
+	"en": "en-US",
+	"de": "de-DE",
+	"pl": "pl-PL",
+	"fr": "fr-FR",
+	"es": "es-ES",
+	"tr": "tr-TR",
+	"ar": "arb",
+}
+
+func speakLanguage(state *models.ClientState) string {
+	if locale, ok := speakLanguages[state.Language]; ok {
+		return locale
+	}
+	return "nl-NL"
+}
+
+func speakVoice(state *models.ClientState) string {
+	if state.Voice != "" {
+		return state.Voice
+	}
+	return "male"
+}
+
+func transcriptionLanguage(state *models.ClientState) string {
+	if state.Language != "" {
+		return state.Language
+	}
+	return "nl"
+}
+
+// withheldNumbers are what Telnyx reports as caller when the caller withheld
+// their number.
+var withheldNumbers = map[string]bool{
+	"":           true,
+	"anonymous":  true,
+	"restricted": true,
+	"unknown":    true,
+	"private":    true,
+}
+
+func callInfo(event Event) models.CallInfo {
+	payload := event.Data.Payload
+	info := models.CallInfo{
+		From:      payload.From,
+		To:        payload.To,
+		Direction: models.DirectionInbound,
+		StartedAt: eventTime(payload.StartTime),
+	}
+	if payload.Direction == "outgoing" || payload.Direction == models.DirectionOutbound {
+		info.Direction = models.DirectionOutbound
+	}
+	from := strings.ToLower(payload.From)
+	if withheldNumbers[from] || strings.HasPrefix(from, "sip:anonymous@") || strings.HasPrefix(from, "anonymous@") {
+		info.From = ""
+		info.Withheld = true
+	}
+	return info
+}
+
+// eventTime parses a timestamp of a Telnyx event, falling back to now for
+// events that lack it.
+func eventTime(timestamp string) time.Time {
+	parsed, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Now()
+	}
+	return parsed
+}
@@ -0,0 +1,36 @@
+package telnyx
+
+import (
+	"goVoice/internal/models"
+	"testing"
+)
+
+func TestCallInfo(t *testing.T) {
+	tests := []struct {
+		from      string
+		direction string
+		expected  models.CallInfo
+	}{
+		{"+31612345678", "incoming", models.CallInfo{From: "+31612345678", To: "+31582331234", Direction: models.DirectionInbound}},
+		{"anonymous", "incoming", models.CallInfo{To: "+31582331234", Direction: models.DirectionInbound, Withheld: true}},
+		{"sip:anonymous@anonymous.invalid", "", models.CallInfo{To: "+31582331234", Direction: models.DirectionInbound, Withheld: true}},
+		{"", "outgoing", models.CallInfo{To: "+31582331234", Direction: models.DirectionOutbound, Withheld: true}},
+	}
+
+	for _, test := range tests {
+		var event Event
+		event.Data.Payload.From = test.from
+		event.Data.Payload.To = "+31582331234"
+		event.Data.Payload.Direction = test.direction
+		event.Data.Payload.StartTime = "2026-10-19T12:00:00.000000Z"
+
+		info := callInfo(event)
+		if info.StartedAt.Hour() != 12 {
+			t.Errorf("Unexpected start time %v", info.StartedAt)
+		}
+		info.StartedAt = test.expected.StartedAt
+		if info != test.expected {
+			t.Errorf("callInfo(%q, %q) = %+v, expected %+v", test.from, test.direction, info, test.expected)
+		}
+	}
+}
@@ -16,7 +16,9 @@ import (
  */
 
 func (t *Telnyx) answerProcedure(c *gin.Context, event Event) {
-	t.answerCall(event)
+	// Calls outside the schedule of the ruleset are answered as closed
+	state := t.ConvCtrl.OpeningState("LeeuwardenPilot") // FIXME this should be dynamic
+	t.answerCall(event, state)
 }
 
 func (t *Telnyx) startCallProcedure(c *gin.Context, event Event) {
@@ -25,7 +27,7 @@ func (t *Telnyx) startCallProcedure(c *gin.Context, event Event) {
 		log.Printf("Error decoding client state: %v", err)
 	}
 	t.startRecording(event)
-	t.ConvCtrl.StartConversation(state.RulesetID, event.Data.Payload.CallControlID)
+	t.ConvCtrl.StartConversation(state, event.Data.Payload.CallControlID, callInfo(event))
 }
 
 func (t *Telnyx) transcriptionProcedure(c *gin.Context, event Event) {
@@ -38,7 +40,11 @@ func (t *Telnyx) transcriptionProcedure(c *gin.Context, event Event) {
 	}
 	log.Printf("transcription received for %s", state.Purpose)
 
-	t.ConvCtrl.ProcessTranscription(ctx, callID, transcriptionData.Transcript, state)
+	t.ConvCtrl.ProcessTranscription(ctx, callID, &models.TranscriptFragment{
+		Transcript: transcriptionData.Transcript,
+		Confidence: transcriptionData.Confidence,
+		IsFinal:    transcriptionData.IsFinal,
+	}, state)
 }
 
 func (t *Telnyx) hangupProcedure(c *gin.Context, event Event) {
@@ -48,13 +54,8 @@ func (t *Telnyx) hangupProcedure(c *gin.Context, event Event) {
 		log.Printf("Error decoding client state: %v", err)
 	}
 	t.stopRecording(event)
-	ctx := context.Background()
-	err = t.ConvCtrl.DB.SetConversationDone(ctx, state.RulesetID, callID)
-	if err != nil {
-		log.Printf("Error setting conversation done: %v", err)
-		return // TODO: in its current state the conversation will be stuck in the DB
-	}
-	t.ConvCtrl.EndConversation(ctx, state, callID)
+	log.Printf("Call %s hung up: %s", callID, event.Data.Payload.HangupCause)
+	t.ConvCtrl.SetConversationDone(context.Background(), state, callID, eventTime(event.Data.Payload.EndTime))
 }
 
 func (t *Telnyx) speakStartedProcedure(c *gin.Context, event Event) {
@@ -72,6 +73,14 @@ func (t *Telnyx) speakEndedProcedure(c *gin.Context, event Event) {
 		t.EndCall(event.Data.Payload.CallControlID)
 		return
 	}
+	if t.ConvCtrl.SpeechEnded(event.Data.Payload.CallControlID, state) {
+		// The next sentence of a streamed step is on its way
+		return
+	}
+	if state.PendingAction != "" {
+		t.ConvCtrl.RunPendingAction(context.Background(), event.Data.Payload.CallControlID, state)
+		return
+	}
 	if state.CurrentStep == state.TotalSteps-1 {
 		log.Printf("Playback ended and conversation is done, ending call")
 		t.EndCall(event.Data.Payload.CallControlID)
@@ -86,6 +95,10 @@ func (t *Telnyx) playbackEndedProcedure(c *gin.Context, event Event) {
 		t.EndCall(event.Data.Payload.CallControlID)
 		return
 	}
+	if state.PendingAction != "" {
+		t.ConvCtrl.RunPendingAction(context.Background(), event.Data.Payload.CallControlID, state)
+		return
+	}
 	if state.CurrentStep == state.TotalSteps-1 {
 		log.Printf("Playback ended and conversation is done, ending call")
 		t.EndCall(event.Data.Payload.CallControlID)
@@ -106,10 +119,18 @@ func (t *Telnyx) recordingSavedProcedure(c *gin.Context, event Event) {
 	url := event.Data.Payload.RecordingUrls.Mp3
 
 	t.ConvCtrl.ProcessRecording(context.Background(), rulesetID, callID, &models.Recording{
-		Url: url,
+		Url:    url,
+		WavUrl: event.Data.Payload.RecordingUrls.Wav,
 	})
 }
 
 func (t *Telnyx) recordingErrorProcedure(c *gin.Context, event Event) {
 	log.Printf("Recording error: %v", event.Data.Payload.Reason)
+
+	state, err := decodeClientState(event.Data.Payload.ClientState)
+	if err != nil {
+		log.Printf("Error decoding client state: %v", err)
+		return
+	}
+	t.ConvCtrl.ProcessRecordingError(context.Background(), state.RulesetID, event.Data.Payload.CallControlID, event.Data.Payload.Reason)
 }
@@ -5,6 +5,7 @@ import (
 	"goVoice/internal/config"
 	"goVoice/internal/models"
 	"goVoice/pkg/db/firestore"
+	"time"
 )
 
 type DbProvider interface {
@@ -15,10 +16,43 @@ type DbProvider interface {
 	GetConversation(ctx context.Context, rulesetID string, conversationID string) (*models.Conversation, error)
 	AddConversation(ctx context.Context, rulesetID string, conversation *models.Conversation) error
 	DeleteConversation(ctx context.Context, rulesetID string, conversationID string) error
+	// ArchiveConversation moves the conversation out of the active conversations
+	ArchiveConversation(ctx context.Context, rulesetID string, conversation *models.Conversation) error
+	AddCallback(ctx context.Context, rulesetID string, callback *models.Callback) error
+	SetCurrentStep(ctx context.Context, rulesetID string, conversationID string, step int, totalSteps int) error
 	AddResponse(ctx context.Context, rulesetID string, conversationID string, response *models.ConversationStepResponse) error
 	SetRecording(ctx context.Context, rulesetID string, conversationID string, recording *models.Recording) error
-	SetConversationDone(ctx context.Context, rulesetID string, conversationID string) error
+	SetConversationDone(ctx context.Context, rulesetID string, conversationID string, endedAt time.Time) error
+	AddFailure(ctx context.Context, rulesetID string, conversationID string, failure *models.Failure) error
+	SetCallbackRequested(ctx context.Context, rulesetID string, conversationID string) error
+	SetIntent(ctx context.Context, rulesetID string, conversationID string, intent string) error
+	SetLanguage(ctx context.Context, rulesetID string, conversationID string, language string) error
+	AddEmergencyTrigger(ctx context.Context, rulesetID string, conversationID string, trigger *models.EmergencyTrigger) error
+	SetSummary(ctx context.Context, rulesetID string, conversationID string, summary *models.CallSummary) error
+	AddRecordingError(ctx context.Context, rulesetID string, conversationID string, reason string) error
+	AddTranscriptLine(ctx context.Context, rulesetID string, conversationID string, line *models.TranscriptLine) error
+	SetExternalReference(ctx context.Context, rulesetID string, conversationID string, system string, reference string) error
+	// ClaimReport marks the conversation as reported, it returns false when it already was
+	ClaimReport(ctx context.Context, rulesetID string, conversationID string) (bool, error)
+	// ReleaseReport undoes ClaimReport, for a report that couldn't be sent
+	ReleaseReport(ctx context.Context, rulesetID string, conversationID string) error
+	// GetUnreported returns the conversations that are done but not reported
+	GetUnreported(ctx context.Context, rulesetID string) ([]models.Conversation, error)
 	GetRecordings(ctx context.Context, rulesetID string, conversationID string) ([]models.Recording, error)
+	// AddUsage adds to the usage of the conversation
+	AddUsage(ctx context.Context, rulesetID string, conversationID string, usage *models.Usage) error
+	// AddRedactions adds to the counts of personal data withheld from the AI provider
+	AddRedactions(ctx context.Context, rulesetID string, conversationID string, counts map[string]int) error
+	// Usage handlers
+	// AddDailyUsage adds to the usage of the ruleset on the day
+	AddDailyUsage(ctx context.Context, usage *models.DailyUsage) error
+	// GetDailyUsage returns the usage of every ruleset from day to day, inclusive
+	GetDailyUsage(ctx context.Context, from string, to string) ([]models.DailyUsage, error)
+	// Webhook handlers
+	AddDeadLetter(ctx context.Context, rulesetID string, deadLetter *models.DeadLetter) error
+	GetDeadLetters(ctx context.Context, rulesetID string) ([]models.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, rulesetID string, deadLetterID string) (*models.DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, rulesetID string, deadLetterID string) error
 }
 
 func InitiateDBClient(cfg *config.Config) (DbProvider, error) {
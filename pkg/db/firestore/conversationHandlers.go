@@ -4,6 +4,7 @@ import (
 	"context"
 	"goVoice/internal/models"
 	"log"
+	"time"
 
 	"cloud.google.com/go/firestore"
 )
@@ -39,6 +40,51 @@ func (f *FirestoreClient) DeleteConversation(ctx context.Context, rulesetID stri
 	return nil
 }
 
+func (f *FirestoreClient) ArchiveConversation(ctx context.Context, rulesetID string, conversation *models.Conversation) error {
+	ruleset := f.Client.Collection("rulesets").Doc(rulesetID)
+	batch := f.Client.Batch()
+	batch.Set(ruleset.Collection("archive").Doc(conversation.ID), conversation)
+	batch.Delete(ruleset.Collection("conversations").Doc(conversation.ID))
+	_, err := batch.Commit(ctx)
+
+	if err != nil {
+		log.Printf("Error archiving conversation in firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) AddCallback(ctx context.Context, rulesetID string, callback *models.Callback) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetID).
+		Collection("callbacks").
+		Doc(callback.ConversationID).
+		Set(ctx, callback)
+
+	if err != nil {
+		log.Printf("Error writing callback to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) SetCurrentStep(ctx context.Context, rulesetId string, conversationId string, step int, totalSteps int) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "currentStep", Value: step},
+			{Path: "totalSteps", Value: totalSteps},
+		})
+
+	if err != nil {
+		log.Printf("Error writing current step to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
 func (f *FirestoreClient) AddResponse(ctx context.Context, rulesetID string, conversationID string, response *models.ConversationStepResponse) error {
 	log.Printf("Adding response to firestore for %v: %v", rulesetID, response)
 	docref := f.Client.Collection("rulesets").
@@ -46,12 +92,23 @@ func (f *FirestoreClient) AddResponse(ctx context.Context, rulesetID string, con
 		Collection("conversations").
 		Doc(conversationID)
 		
-	_, err := docref.Update(ctx, []firestore.Update{
+	updates := []firestore.Update{
 		{
 			Path:  "responses." + response.Purpose,
 			Value: response.Response,
 		},
-	})
+		{
+			Path:  "confidences." + response.Purpose,
+			Value: response.Confidence,
+		},
+	}
+	if response.PromptVersion != "" {
+		updates = append(updates, firestore.Update{
+			Path:  "promptVersions." + response.Purpose,
+			Value: response.PromptVersion,
+		})
+	}
+	_, err := docref.Update(ctx, updates)
 		
 	if err != nil {
 		log.Printf("Error writing response to firestore: %v", err)
@@ -76,13 +133,14 @@ func (f *FirestoreClient) SetRecording(ctx context.Context, rulesetId string, co
 	return nil
 }
 
-func (f *FirestoreClient) SetConversationDone(ctx context.Context, rulesetId string, conversationId string) error {
+func (f *FirestoreClient) SetConversationDone(ctx context.Context, rulesetId string, conversationId string, endedAt time.Time) error {
 	_, err := f.Client.Collection("rulesets").
 		Doc(rulesetId).
 		Collection("conversations").
 		Doc(conversationId).
 		Update(ctx, []firestore.Update{
 			{Path: "conversationDone", Value: true},
+			{Path: "endedAt", Value: endedAt},
 		})
 		
 	if err != nil {
@@ -92,6 +150,220 @@ func (f *FirestoreClient) SetConversationDone(ctx context.Context, rulesetId str
 	return nil
 }
 
+func (f *FirestoreClient) AddFailure(ctx context.Context, rulesetId string, conversationId string, failure *models.Failure) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "failures", Value: firestore.ArrayUnion(failure)},
+		})
+
+	if err != nil {
+		log.Printf("Error writing failure to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) SetCallbackRequested(ctx context.Context, rulesetId string, conversationId string) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "callbackRequested", Value: true},
+		})
+
+	if err != nil {
+		log.Printf("Error writing callback request to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) SetIntent(ctx context.Context, rulesetId string, conversationId string, intent string) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "intent", Value: intent},
+		})
+
+	if err != nil {
+		log.Printf("Error writing intent to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) SetLanguage(ctx context.Context, rulesetId string, conversationId string, language string) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "language", Value: language},
+		})
+
+	if err != nil {
+		log.Printf("Error writing language to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+// AddEmergencyTrigger records the trigger and flags the conversation as urgent
+func (f *FirestoreClient) AddEmergencyTrigger(ctx context.Context, rulesetId string, conversationId string, trigger *models.EmergencyTrigger) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "urgent", Value: true},
+			{Path: "emergencyTriggers", Value: firestore.ArrayUnion(trigger)},
+		})
+
+	if err != nil {
+		log.Printf("Error writing emergency trigger to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) SetSummary(ctx context.Context, rulesetId string, conversationId string, summary *models.CallSummary) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "summary", Value: summary},
+		})
+
+	if err != nil {
+		log.Printf("Error writing summary to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) AddRecordingError(ctx context.Context, rulesetId string, conversationId string, reason string) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "recordingErrors", Value: firestore.ArrayUnion(reason)},
+		})
+
+	if err != nil {
+		log.Printf("Error writing recording error to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) AddTranscriptLine(ctx context.Context, rulesetId string, conversationId string, line *models.TranscriptLine) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "transcript", Value: firestore.ArrayUnion(line)},
+		})
+
+	if err != nil {
+		log.Printf("Error writing transcript line to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) SetExternalReference(ctx context.Context, rulesetId string, conversationId string, system string, reference string) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{FieldPath: firestore.FieldPath{"externalReferences", system}, Value: reference},
+		})
+
+	if err != nil {
+		log.Printf("Error writing external reference to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) AddRedactions(ctx context.Context, rulesetId string, conversationId string, counts map[string]int) error {
+	var updates []firestore.Update
+	for kind, count := range counts {
+		updates = append(updates, firestore.Update{FieldPath: firestore.FieldPath{"redactions", kind}, Value: firestore.Increment(count)})
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, updates)
+
+	if err != nil {
+		log.Printf("Error writing redactions to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ClaimReport sets reported on the conversation in a transaction so only one
+// of the events racing to finish the conversation gets to send the report.
+func (f *FirestoreClient) ClaimReport(ctx context.Context, rulesetId string, conversationId string) (bool, error) {
+	docref := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId)
+
+	claimed := false
+	err := f.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docsnap, err := tx.Get(docref)
+		if err != nil {
+			return err
+		}
+		if reported, err := docsnap.DataAt("reported"); err == nil && reported == true {
+			claimed = false
+			return nil
+		}
+		claimed = true
+		return tx.Update(docref, []firestore.Update{
+			{Path: "reported", Value: true},
+		})
+	})
+
+	if err != nil {
+		log.Printf("Error claiming report in firestore: %v", err)
+		return false, err
+	}
+	return claimed, nil
+}
+
+func (f *FirestoreClient) ReleaseReport(ctx context.Context, rulesetId string, conversationId string) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetId).
+		Collection("conversations").
+		Doc(conversationId).
+		Update(ctx, []firestore.Update{
+			{Path: "reported", Value: false},
+		})
+
+	if err != nil {
+		log.Printf("Error releasing report in firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
 // GETTERS
 
 func (f *FirestoreClient) GetConversation(ctx context.Context, rulesetId string, conversationId string) (*models.Conversation, error) {
@@ -116,6 +388,33 @@ func (f *FirestoreClient) GetConversation(ctx context.Context, rulesetId string,
 	return &c, nil
 }
 
+// GetUnreported only filters on equality, which needs no composite index.
+func (f *FirestoreClient) GetUnreported(ctx context.Context, rulesetID string) ([]models.Conversation, error) {
+	docs, err := f.Client.Collection("rulesets").
+		Doc(rulesetID).
+		Collection("conversations").
+		Where("conversationDone", "==", true).
+		Where("reported", "==", false).
+		Documents(ctx).
+		GetAll()
+
+	if err != nil {
+		log.Printf("Error getting unreported conversations from firestore: %v", err)
+		return nil, err
+	}
+
+	conversations := make([]models.Conversation, 0, len(docs))
+	for _, doc := range docs {
+		var conversation models.Conversation
+		if err := doc.DataTo(&conversation); err != nil {
+			log.Printf("Error unmarshalling conversation from firestore: %v", err)
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, nil
+}
+
 func (f *FirestoreClient) GetRecordings(ctx context.Context, rulesetID string, conversationID string) ([]models.Recording, error) {
 	conversationDoc, err := f.Client.Collection("rulesets").
 		Doc(rulesetID).
@@ -0,0 +1,107 @@
+package firestore
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"log"
+
+	"cloud.google.com/go/firestore"
+)
+
+// usageIncrements are the updates adding the usage to the usage at path,
+// so concurrent requests of the same call or day don't overwrite each other.
+func usageIncrements(path firestore.FieldPath, usage *models.Usage) []firestore.Update {
+	field := func(names ...string) firestore.FieldPath {
+		return append(append(firestore.FieldPath{}, path...), names...)
+	}
+	var updates []firestore.Update
+	if usage.Calls != 0 {
+		updates = append(updates, firestore.Update{FieldPath: field("calls"), Value: firestore.Increment(usage.Calls)})
+	}
+	if usage.CallSeconds != 0 {
+		updates = append(updates, firestore.Update{FieldPath: field("callSeconds"), Value: firestore.Increment(usage.CallSeconds)})
+	}
+	for provider, tokens := range usage.Tokens {
+		updates = append(updates,
+			firestore.Update{FieldPath: field("tokens", provider, "requests"), Value: firestore.Increment(tokens.Requests)},
+			firestore.Update{FieldPath: field("tokens", provider, "promptTokens"), Value: firestore.Increment(tokens.PromptTokens)},
+			firestore.Update{FieldPath: field("tokens", provider, "completionTokens"), Value: firestore.Increment(tokens.CompletionTokens)},
+		)
+	}
+	return updates
+}
+
+func (f *FirestoreClient) AddUsage(ctx context.Context, rulesetID string, conversationID string, usage *models.Usage) error {
+	updates := usageIncrements(firestore.FieldPath{"usage"}, usage)
+	if len(updates) == 0 {
+		return nil
+	}
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetID).
+		Collection("conversations").
+		Doc(conversationID).
+		Update(ctx, updates)
+
+	if err != nil {
+		log.Printf("Error writing usage of conversation to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+// AddDailyUsage keeps the usage in rulesets/<id>/usage/<day>, which is
+// created by the first call of the day.
+func (f *FirestoreClient) AddDailyUsage(ctx context.Context, usage *models.DailyUsage) error {
+	docref := f.Client.Collection("rulesets").
+		Doc(usage.RulesetID).
+		Collection("usage").
+		Doc(usage.Day)
+
+	_, err := docref.Set(ctx, map[string]interface{}{
+		"rulesetId": usage.RulesetID,
+		"customer":  usage.Customer,
+		"day":       usage.Day,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error creating daily usage in firestore: %v", err)
+		return err
+	}
+
+	updates := usageIncrements(firestore.FieldPath{"usage"}, &usage.Usage)
+	if len(updates) == 0 {
+		return nil
+	}
+	_, err = docref.Update(ctx, updates)
+	if err != nil {
+		log.Printf("Error writing daily usage to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetDailyUsage queries the usage collections of all rulesets, which needs a
+// collection group index on day.
+func (f *FirestoreClient) GetDailyUsage(ctx context.Context, from string, to string) ([]models.DailyUsage, error) {
+	docs, err := f.Client.CollectionGroup("usage").
+		Where("day", ">=", from).
+		Where("day", "<=", to).
+		OrderBy("day", firestore.Asc).
+		Documents(ctx).
+		GetAll()
+
+	if err != nil {
+		log.Printf("Error getting daily usage from firestore: %v", err)
+		return nil, err
+	}
+
+	days := make([]models.DailyUsage, 0, len(docs))
+	for _, doc := range docs {
+		var day models.DailyUsage
+		if err := doc.DataTo(&day); err != nil {
+			log.Printf("Error unmarshalling daily usage from firestore: %v", err)
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
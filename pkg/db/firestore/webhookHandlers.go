@@ -0,0 +1,82 @@
+package firestore
+
+import (
+	"context"
+	"goVoice/internal/models"
+	"log"
+
+	"cloud.google.com/go/firestore"
+)
+
+func (f *FirestoreClient) AddDeadLetter(ctx context.Context, rulesetID string, deadLetter *models.DeadLetter) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetID).
+		Collection("deadLetters").
+		Doc(deadLetter.ID).
+		Set(ctx, deadLetter)
+
+	if err != nil {
+		log.Printf("Error writing dead letter to firestore: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (f *FirestoreClient) GetDeadLetters(ctx context.Context, rulesetID string) ([]models.DeadLetter, error) {
+	docs, err := f.Client.Collection("rulesets").
+		Doc(rulesetID).
+		Collection("deadLetters").
+		OrderBy("createdAt", firestore.Asc).
+		Documents(ctx).
+		GetAll()
+
+	if err != nil {
+		log.Printf("Error getting dead letters from firestore: %v", err)
+		return nil, err
+	}
+
+	deadLetters := make([]models.DeadLetter, 0, len(docs))
+	for _, doc := range docs {
+		var deadLetter models.DeadLetter
+		if err := doc.DataTo(&deadLetter); err != nil {
+			log.Printf("Error unmarshalling dead letter from firestore: %v", err)
+			return nil, err
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	return deadLetters, nil
+}
+
+func (f *FirestoreClient) GetDeadLetter(ctx context.Context, rulesetID string, deadLetterID string) (*models.DeadLetter, error) {
+	doc, err := f.Client.Collection("rulesets").
+		Doc(rulesetID).
+		Collection("deadLetters").
+		Doc(deadLetterID).
+		Get(ctx)
+
+	if err != nil {
+		log.Printf("Error getting dead letter from firestore: %v", err)
+		return nil, err
+	}
+
+	var deadLetter models.DeadLetter
+	if err := doc.DataTo(&deadLetter); err != nil {
+		log.Printf("Error unmarshalling dead letter from firestore: %v", err)
+		return nil, err
+	}
+	return &deadLetter, nil
+}
+
+func (f *FirestoreClient) DeleteDeadLetter(ctx context.Context, rulesetID string, deadLetterID string) error {
+	_, err := f.Client.Collection("rulesets").
+		Doc(rulesetID).
+		Collection("deadLetters").
+		Doc(deadLetterID).
+		Delete(ctx)
+
+	if err != nil {
+		log.Printf("Error deleting dead letter from firestore: %v", err)
+		return err
+	}
+	return nil
+}
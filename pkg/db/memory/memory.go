@@ -0,0 +1,377 @@
+// Package memory is a DbProvider that keeps everything in memory, for running
+// conversations without Firestore, like the simulator does.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goVoice/internal/billing"
+	"goVoice/internal/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MemoryClient struct {
+	mu            sync.Mutex
+	rulesets      map[string]*models.ConversationRuleSet
+	conversations map[string]*models.Conversation
+	archive       map[string]*models.Conversation
+	callbacks     map[string][]models.Callback
+	deadLetters   map[string]models.DeadLetter
+	usage         map[string]models.DailyUsage
+}
+
+func NewClient() *MemoryClient {
+	return &MemoryClient{
+		rulesets:      make(map[string]*models.ConversationRuleSet),
+		conversations: make(map[string]*models.Conversation),
+		archive:       make(map[string]*models.Conversation),
+		callbacks:     make(map[string][]models.Callback),
+		deadLetters:   make(map[string]models.DeadLetter),
+		usage:         make(map[string]models.DailyUsage),
+	}
+}
+
+func key(rulesetID string, conversationID string) string {
+	return rulesetID + "/" + conversationID
+}
+
+// clone deep copies a document, so callers can't change what is stored
+// without going through the client, just like with Firestore.
+func clone[T any](value *T) (*T, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var copied T
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+func (m *MemoryClient) AddRuleset(ctx context.Context, ruleset *models.ConversationRuleSet) error {
+	stored, err := clone(ruleset)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rulesets[ruleset.ID] = stored
+	return nil
+}
+
+func (m *MemoryClient) GetRuleSet(ctx context.Context, rulesetID string) (*models.ConversationRuleSet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ruleset, ok := m.rulesets[rulesetID]
+	if !ok {
+		return nil, fmt.Errorf("ruleset %s not found", rulesetID)
+	}
+	return clone(ruleset)
+}
+
+func (m *MemoryClient) AddConversation(ctx context.Context, rulesetID string, conversation *models.Conversation) error {
+	stored, err := clone(conversation)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conversations[key(rulesetID, conversation.ID)] = stored
+	return nil
+}
+
+func (m *MemoryClient) GetConversation(ctx context.Context, rulesetID string, conversationID string) (*models.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, ok := m.conversations[key(rulesetID, conversationID)]
+	if !ok {
+		return nil, fmt.Errorf("conversation %s not found", conversationID)
+	}
+	return clone(conversation)
+}
+
+func (m *MemoryClient) DeleteConversation(ctx context.Context, rulesetID string, conversationID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.conversations, key(rulesetID, conversationID))
+	return nil
+}
+
+func (m *MemoryClient) ArchiveConversation(ctx context.Context, rulesetID string, conversation *models.Conversation) error {
+	stored, err := clone(conversation)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.archive[key(rulesetID, conversation.ID)] = stored
+	delete(m.conversations, key(rulesetID, conversation.ID))
+	return nil
+}
+
+// GetArchived returns the archived conversation, or nil when it wasn't archived.
+func (m *MemoryClient) GetArchived(rulesetID string, conversationID string) *models.Conversation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, ok := m.archive[key(rulesetID, conversationID)]
+	if !ok {
+		return nil
+	}
+	copied, _ := clone(conversation)
+	return copied
+}
+
+func (m *MemoryClient) AddCallback(ctx context.Context, rulesetID string, callback *models.Callback) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callbacks[rulesetID] = append(m.callbacks[rulesetID], *callback)
+	return nil
+}
+
+// GetCallbacks returns the callbacks queued for the ruleset.
+func (m *MemoryClient) GetCallbacks(rulesetID string) []models.Callback {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.Callback(nil), m.callbacks[rulesetID]...)
+}
+
+// update applies change to the stored conversation.
+func (m *MemoryClient) update(rulesetID string, conversationID string, change func(conversation *models.Conversation)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, ok := m.conversations[key(rulesetID, conversationID)]
+	if !ok {
+		return fmt.Errorf("conversation %s not found", conversationID)
+	}
+	change(conversation)
+	return nil
+}
+
+func (m *MemoryClient) SetCurrentStep(ctx context.Context, rulesetID string, conversationID string, step int, totalSteps int) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.CurrentStep = step
+		conversation.TotalSteps = totalSteps
+	})
+}
+
+func (m *MemoryClient) AddResponse(ctx context.Context, rulesetID string, conversationID string, response *models.ConversationStepResponse) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		if conversation.Responses == nil {
+			conversation.Responses = make(map[string]string)
+		}
+		if conversation.Confidences == nil {
+			conversation.Confidences = make(map[string]float64)
+		}
+		conversation.Responses[response.Purpose] = response.Response
+		conversation.Confidences[response.Purpose] = response.Confidence
+		if response.PromptVersion != "" {
+			if conversation.PromptVersions == nil {
+				conversation.PromptVersions = make(map[string]string)
+			}
+			conversation.PromptVersions[response.Purpose] = response.PromptVersion
+		}
+	})
+}
+
+func (m *MemoryClient) SetRecording(ctx context.Context, rulesetID string, conversationID string, recording *models.Recording) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Recordings = append(conversation.Recordings, *recording)
+	})
+}
+
+func (m *MemoryClient) SetConversationDone(ctx context.Context, rulesetID string, conversationID string, endedAt time.Time) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.ConversationDone = true
+		conversation.EndedAt = endedAt
+	})
+}
+
+func (m *MemoryClient) AddFailure(ctx context.Context, rulesetID string, conversationID string, failure *models.Failure) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Failures = append(conversation.Failures, *failure)
+	})
+}
+
+func (m *MemoryClient) SetCallbackRequested(ctx context.Context, rulesetID string, conversationID string) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.CallbackRequested = true
+	})
+}
+
+func (m *MemoryClient) SetIntent(ctx context.Context, rulesetID string, conversationID string, intent string) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Intent = intent
+	})
+}
+
+func (m *MemoryClient) SetLanguage(ctx context.Context, rulesetID string, conversationID string, language string) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Language = language
+	})
+}
+
+func (m *MemoryClient) AddEmergencyTrigger(ctx context.Context, rulesetID string, conversationID string, trigger *models.EmergencyTrigger) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Urgent = true
+		conversation.EmergencyTriggers = append(conversation.EmergencyTriggers, *trigger)
+	})
+}
+
+func (m *MemoryClient) SetSummary(ctx context.Context, rulesetID string, conversationID string, summary *models.CallSummary) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Summary = summary
+	})
+}
+
+func (m *MemoryClient) AddRecordingError(ctx context.Context, rulesetID string, conversationID string, reason string) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.RecordingErrors = append(conversation.RecordingErrors, reason)
+	})
+}
+
+func (m *MemoryClient) AddTranscriptLine(ctx context.Context, rulesetID string, conversationID string, line *models.TranscriptLine) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Transcript = append(conversation.Transcript, *line)
+	})
+}
+
+func (m *MemoryClient) SetExternalReference(ctx context.Context, rulesetID string, conversationID string, system string, reference string) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		if conversation.ExternalReferences == nil {
+			conversation.ExternalReferences = make(map[string]string)
+		}
+		conversation.ExternalReferences[system] = reference
+	})
+}
+
+func (m *MemoryClient) ClaimReport(ctx context.Context, rulesetID string, conversationID string) (bool, error) {
+	claimed := false
+	err := m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		claimed = !conversation.Reported
+		conversation.Reported = true
+	})
+	return claimed, err
+}
+
+func (m *MemoryClient) ReleaseReport(ctx context.Context, rulesetID string, conversationID string) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		conversation.Reported = false
+	})
+}
+
+func (m *MemoryClient) GetUnreported(ctx context.Context, rulesetID string) ([]models.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversations := []models.Conversation{}
+	for stored, conversation := range m.conversations {
+		if !strings.HasPrefix(stored, key(rulesetID, "")) || !conversation.ConversationDone || conversation.Reported {
+			continue
+		}
+		copied, err := clone(conversation)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, *copied)
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].EndedAt.Before(conversations[j].EndedAt)
+	})
+	return conversations, nil
+}
+
+func (m *MemoryClient) GetRecordings(ctx context.Context, rulesetID string, conversationID string) ([]models.Recording, error) {
+	conversation, err := m.GetConversation(ctx, rulesetID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return conversation.Recordings, nil
+}
+
+func (m *MemoryClient) AddUsage(ctx context.Context, rulesetID string, conversationID string, usage *models.Usage) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		billing.Add(&conversation.Usage, *usage)
+	})
+}
+
+func (m *MemoryClient) AddRedactions(ctx context.Context, rulesetID string, conversationID string, counts map[string]int) error {
+	return m.update(rulesetID, conversationID, func(conversation *models.Conversation) {
+		if conversation.Redactions == nil {
+			conversation.Redactions = make(map[string]int)
+		}
+		for kind, count := range counts {
+			conversation.Redactions[kind] += count
+		}
+	})
+}
+
+func (m *MemoryClient) AddDailyUsage(ctx context.Context, usage *models.DailyUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.usage[key(usage.RulesetID, usage.Day)]
+	if !ok {
+		stored = models.DailyUsage{RulesetID: usage.RulesetID, Day: usage.Day}
+	}
+	stored.Customer = usage.Customer
+	billing.Add(&stored.Usage, usage.Usage)
+	m.usage[key(usage.RulesetID, usage.Day)] = stored
+	return nil
+}
+
+func (m *MemoryClient) GetDailyUsage(ctx context.Context, from string, to string) ([]models.DailyUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	days := []models.DailyUsage{}
+	for _, day := range m.usage {
+		if day.Day >= from && day.Day <= to {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return key(days[i].RulesetID, days[i].Day) < key(days[j].RulesetID, days[j].Day)
+	})
+	return days, nil
+}
+
+func (m *MemoryClient) AddDeadLetter(ctx context.Context, rulesetID string, deadLetter *models.DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadLetters[key(rulesetID, deadLetter.ID)] = *deadLetter
+	return nil
+}
+
+func (m *MemoryClient) GetDeadLetters(ctx context.Context, rulesetID string) ([]models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deadLetters := []models.DeadLetter{}
+	for _, deadLetter := range m.deadLetters {
+		if deadLetter.RulesetID == rulesetID {
+			deadLetters = append(deadLetters, deadLetter)
+		}
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].CreatedAt.Before(deadLetters[j].CreatedAt)
+	})
+	return deadLetters, nil
+}
+
+func (m *MemoryClient) GetDeadLetter(ctx context.Context, rulesetID string, deadLetterID string) (*models.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deadLetter, ok := m.deadLetters[key(rulesetID, deadLetterID)]
+	if !ok {
+		return nil, fmt.Errorf("dead letter %s not found", deadLetterID)
+	}
+	return &deadLetter, nil
+}
+
+func (m *MemoryClient) DeleteDeadLetter(ctx context.Context, rulesetID string, deadLetterID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.deadLetters, key(rulesetID, deadLetterID))
+	return nil
+}
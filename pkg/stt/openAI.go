@@ -0,0 +1,71 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// OpenAITranscriber uses the /audio/transcriptions endpoint of the OpenAI API,
+// or of a server with a compatible API such as a local whisper server.
+type OpenAITranscriber struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAITranscriber creates a transcriber for the OpenAI API, or for a
+// compatible server at baseURL. Without a model it uses whisper-1.
+func NewOpenAITranscriber(apiKey string, baseURL string, model string) *OpenAITranscriber {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	if model == "" {
+		model = openai.Whisper1
+	}
+	return &OpenAITranscriber{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+	}
+}
+
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, audio *Audio) ([]Segment, error) {
+	response, err := t.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    t.model,
+		FilePath: audio.Name,
+		Reader:   bytes.NewReader(audio.Data),
+		Prompt:   audio.Prompt,
+		Language: audio.Language,
+		Format:   openai.AudioResponseFormatVerboseJSON,
+	})
+	if err != nil {
+		log.Printf("Error transcribing %s: %v", audio.Name, err)
+		return nil, err
+	}
+
+	var segments []Segment
+	for _, segment := range response.Segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		segments = append(segments, Segment{
+			Start: seconds(segment.Start),
+			End:   seconds(segment.End),
+			Text:  text,
+		})
+	}
+	if len(segments) == 0 && strings.TrimSpace(response.Text) != "" {
+		// Servers that don't return segments still return the text
+		segments = append(segments, Segment{End: seconds(response.Duration), Text: strings.TrimSpace(response.Text)})
+	}
+	return segments, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
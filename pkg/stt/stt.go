@@ -0,0 +1,102 @@
+// Package stt transcribes call recordings after the call with a batch
+// speech-to-text backend, which hears more than the live transcription of
+// the call provider does.
+package stt
+
+import (
+	"context"
+	"fmt"
+	"goVoice/internal/config"
+	"sort"
+	"time"
+)
+
+const (
+	ProviderOpenAI     = "openai"
+	ProviderCompatible = "compatible"
+)
+
+// Audio is a recording to transcribe.
+type Audio struct {
+	Data []byte
+	// Name is the file name of the recording, its extension tells the format
+	Name string
+	// Language is the ISO-639-1 code of what is spoken, detected when empty
+	Language string
+	// Prompt helps the backend with the spelling of names and places
+	Prompt string
+}
+
+// Segment is a stretch of speech in the recording.
+type Segment struct {
+	// Channel the speech was on, -1 when the channels weren't split
+	Channel int
+	Start   time.Duration
+	End     time.Duration
+	Text    string
+}
+
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio *Audio) ([]Segment, error)
+}
+
+// InitiateTranscriber creates the transcriber of STT_PROVIDER, or returns nil
+// when there is none and recordings aren't transcribed again.
+func InitiateTranscriber(cfg *config.Config) (Transcriber, error) {
+	switch cfg.STTProvider {
+	case "":
+		return nil, nil
+	case ProviderOpenAI:
+		key := cfg.STTKey
+		if key == "" {
+			key = cfg.OpenAIKey
+		}
+		return NewOpenAITranscriber(key, "", cfg.STTModel), nil
+	case ProviderCompatible:
+		if cfg.STTBaseURL == "" {
+			return nil, fmt.Errorf("STT provider %s needs a base URL", cfg.STTProvider)
+		}
+		return NewOpenAITranscriber(cfg.STTKey, cfg.STTBaseURL, cfg.STTModel), nil
+	default:
+		return nil, fmt.Errorf("unknown STT provider %q", cfg.STTProvider)
+	}
+}
+
+// TranscribeChannels transcribes every channel of a wav recording on its own,
+// so the segments tell who spoke. Other recordings are transcribed as they
+// are, with the channels mixed.
+func TranscribeChannels(ctx context.Context, transcriber Transcriber, audio *Audio) ([]Segment, error) {
+	if !IsWav(audio.Data) {
+		segments, err := transcriber.Transcribe(ctx, audio)
+		if err != nil {
+			return nil, err
+		}
+		for i := range segments {
+			segments[i].Channel = -1
+		}
+		return segments, nil
+	}
+
+	channels, err := SplitChannels(audio.Data)
+	if err != nil {
+		return nil, err
+	}
+	var segments []Segment
+	for channel, data := range channels {
+		mono := *audio
+		mono.Data = data
+		mono.Name = fmt.Sprintf("channel-%d-%s", channel, audio.Name)
+		transcribed, err := transcriber.Transcribe(ctx, &mono)
+		if err != nil {
+			return nil, fmt.Errorf("error transcribing channel %d: %w", channel, err)
+		}
+		for _, segment := range transcribed {
+			segment.Channel = channel
+			segments = append(segments, segment)
+		}
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].Start < segments[j].Start
+	})
+	return segments, nil
+}
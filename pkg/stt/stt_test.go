@@ -0,0 +1,92 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// stereo is a 16 bit wav with the samples on the left and right channel
+func stereo(left []int16, right []int16) []byte {
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:2], 1)
+	binary.LittleEndian.PutUint16(format[2:4], 2)
+	binary.LittleEndian.PutUint32(format[4:8], 8000)
+	binary.LittleEndian.PutUint32(format[8:12], 8000*4)
+	binary.LittleEndian.PutUint16(format[12:14], 4)
+	binary.LittleEndian.PutUint16(format[14:16], 16)
+	var samples bytes.Buffer
+	for i := range left {
+		binary.Write(&samples, binary.LittleEndian, left[i])
+		binary.Write(&samples, binary.LittleEndian, right[i])
+	}
+	return wavFile(format, samples.Bytes())
+}
+
+func samples(t *testing.T, wav []byte) []int16 {
+	t.Helper()
+	if !IsWav(wav) || string(wav[36:40]) != "data" {
+		t.Fatalf("Expected a wav file, got % x", wav[:12])
+	}
+	if channels := binary.LittleEndian.Uint16(wav[22:24]); channels != 1 {
+		t.Errorf("Expected a single channel, got %d", channels)
+	}
+	data := wav[44:]
+	values := make([]int16, len(data)/2)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, values)
+	return values
+}
+
+func TestSplitChannels(t *testing.T) {
+	channels, err := SplitChannels(stereo([]int16{1, 2, 3}, []int16{-1, -2, -3}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(channels) != 2 {
+		t.Fatalf("Expected 2 channels, got %d", len(channels))
+	}
+	if left := samples(t, channels[0]); !reflect.DeepEqual(left, []int16{1, 2, 3}) {
+		t.Errorf("Unexpected left channel %v", left)
+	}
+	if right := samples(t, channels[1]); !reflect.DeepEqual(right, []int16{-1, -2, -3}) {
+		t.Errorf("Unexpected right channel %v", right)
+	}
+
+	if _, err := SplitChannels([]byte("ID3 an mp3")); err == nil {
+		t.Error("Expected an error for an mp3")
+	}
+}
+
+// scripted transcribes every channel as a segment with its first sample in
+// seconds as start
+type scripted struct{}
+
+func (scripted) Transcribe(ctx context.Context, audio *Audio) ([]Segment, error) {
+	if !IsWav(audio.Data) {
+		return []Segment{{Text: "gemengd"}}, nil
+	}
+	first := time.Duration(int16(binary.LittleEndian.Uint16(audio.Data[44:46]))) * time.Second
+	return []Segment{{Start: first, Text: audio.Name}}, nil
+}
+
+func TestTranscribeChannels(t *testing.T) {
+	segments, err := TranscribeChannels(context.Background(), scripted{}, &Audio{Name: "opname.wav", Data: stereo([]int16{5, 0}, []int16{2, 0})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Segment{
+		{Channel: 1, Start: 2 * time.Second, Text: "channel-1-opname.wav"},
+		{Channel: 0, Start: 5 * time.Second, Text: "channel-0-opname.wav"},
+	}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, segments)
+	}
+
+	segments, err = TranscribeChannels(context.Background(), scripted{}, &Audio{Name: "opname.mp3", Data: []byte("ID3")})
+	if err != nil || len(segments) != 1 || segments[0].Channel != -1 {
+		t.Errorf("Expected a single mixed segment, got %+v (%v)", segments, err)
+	}
+}
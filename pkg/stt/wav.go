@@ -0,0 +1,90 @@
+package stt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// IsWav tells whether the data is a RIFF WAVE file.
+func IsWav(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// SplitChannels splits a wav file with interleaved channels into a wav file
+// per channel, in the same encoding.
+func SplitChannels(data []byte) ([][]byte, error) {
+	if !IsWav(data) {
+		return nil, errors.New("not a wav file")
+	}
+	var format, samples []byte
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		start := offset + 8
+		end := start + size
+		if end > len(data) {
+			// Recordings that were cut off still have their samples
+			end = len(data)
+		}
+		switch id {
+		case "fmt ":
+			format = data[start:end]
+		case "data":
+			samples = data[start:end]
+		}
+		// Chunks are padded to an even size
+		offset = start + size + size%2
+	}
+	if len(format) < 16 || samples == nil {
+		return nil, errors.New("wav file without format or data")
+	}
+
+	channels := int(binary.LittleEndian.Uint16(format[2:4]))
+	sampleRate := binary.LittleEndian.Uint32(format[4:8])
+	blockAlign := int(binary.LittleEndian.Uint16(format[12:14]))
+	if channels == 0 || blockAlign == 0 || blockAlign%channels != 0 {
+		return nil, fmt.Errorf("wav file with %d channels in blocks of %d bytes", channels, blockAlign)
+	}
+	width := blockAlign / channels
+
+	split := make([][]byte, channels)
+	for channel := range split {
+		mono := make([]byte, 0, len(samples)/channels)
+		for block := 0; block+blockAlign <= len(samples); block += blockAlign {
+			mono = append(mono, samples[block+channel*width:block+(channel+1)*width]...)
+		}
+
+		monoFormat := append([]byte(nil), format...)
+		binary.LittleEndian.PutUint16(monoFormat[2:4], 1)
+		binary.LittleEndian.PutUint32(monoFormat[8:12], sampleRate*uint32(width))
+		binary.LittleEndian.PutUint16(monoFormat[12:14], uint16(width))
+		if binary.LittleEndian.Uint16(format[0:2]) == 0xFFFE && len(monoFormat) >= 24 {
+			// WAVE_FORMAT_EXTENSIBLE, the speaker positions no longer apply
+			binary.LittleEndian.PutUint32(monoFormat[20:24], 0)
+		}
+		split[channel] = wavFile(monoFormat, mono)
+	}
+	return split, nil
+}
+
+func wavFile(format []byte, samples []byte) []byte {
+	var buf bytes.Buffer
+	chunk := func(id string, data []byte) {
+		buf.WriteString(id)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+		if len(data)%2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	buf.WriteString("WAVE")
+	chunk("fmt ", format)
+	chunk("data", samples)
+	file := buf.Bytes()
+	binary.LittleEndian.PutUint32(file[4:8], uint32(len(file)-8))
+	return file
+}